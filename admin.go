@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+)
+
+// adminOnly guards admin endpoints that expose stored data. Requests must
+// carry ADMIN_API_KEY as an ApiKey authorization header; if it isn't set,
+// the endpoints are disabled.
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedKey := os.Getenv("ADMIN_API_KEY")
+		apiKey, err := getAuthHeaderItem(r, "ApiKey")
+
+		if expectedKey == "" || err != nil || subtle.ConstantTimeCompare([]byte(apiKey), []byte(expectedKey)) != 1 {
+			errorResponse(w, http.StatusUnauthorized, "Admin API key required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
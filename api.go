@@ -5,14 +5,32 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/ajpotts01/go-chirpy/internal/blobstore"
 	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entitlements"
+	"github.com/ajpotts01/go-chirpy/internal/ratelimit"
+	"github.com/ajpotts01/go-chirpy/internal/search"
+	"github.com/ajpotts01/go-chirpy/internal/stream"
+	"github.com/ajpotts01/go-chirpy/internal/unfurl"
+	"github.com/ajpotts01/go-chirpy/internal/webhooks"
 )
 
 type apiConfig struct {
-	serverHits int
-	jwtSecret  string
-	DbConn     *database.Database
+	serverHits            int
+	jwtSecret             string
+	accountDeletionPolicy database.DeletionPolicy
+	plans                 entitlements.Plans
+	limiter               *ratelimit.Limiter
+	twoFactorLimiter      *ratelimit.Limiter
+	webhookProviders      *webhooks.Registry
+	hub                   *stream.Hub
+	searchIndex           *search.Index
+	userIndex             *search.UserIndex
+	blobStore             blobstore.BlobStore
+	unfurler              *unfurl.Unfurler
+	DbConn                *database.Database
 }
 
 func (cfg *apiConfig) metrics(next http.Handler) http.Handler {
@@ -64,3 +82,35 @@ func errorResponse(w http.ResponseWriter, code int, errorMsg string) {
 
 	validResponse(w, code, errorObj)
 }
+
+// pageParams reads ?cursor= and ?limit=, writing a 400 if either is invalid.
+// A missing limit falls back to the database default.
+func pageParams(w http.ResponseWriter, r *http.Request) (*database.Cursor, int, bool) {
+	cursor, err := database.DecodeCursor(r.URL.Query().Get("cursor"))
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return nil, 0, false
+	}
+
+	limit, ok := pageLimit(w, r)
+	return cursor, limit, ok
+}
+
+// pageLimit reads ?limit= on its own, for feeds that aren't paged by time.
+func pageLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	providedLimit := r.URL.Query().Get("limit")
+
+	if providedLimit == "" {
+		return 0, true
+	}
+
+	limit, err := strconv.Atoi(providedLimit)
+
+	if err != nil || limit < 1 || limit > database.MaxPageSize {
+		errorResponse(w, http.StatusBadRequest, "Invalid limit")
+		return 0, false
+	}
+
+	return limit, true
+}
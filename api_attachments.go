@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/blobstore"
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/media"
+	"github.com/go-chi/chi/v5"
+)
+
+const blobTimeout = 30 * time.Second
+
+// Uploads that haven't been attached to a chirp or draft by then are
+// removed, checking this often
+const unattachedUploadLifetime = 24 * time.Hour
+const uploadExpiryInterval = 10 * time.Minute
+
+type attachmentReturn struct {
+	Id           int    `json:"id"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	Size         int    `json:"size,omitempty"`
+}
+
+// newAttachmentReturn builds the URLs for an attachment, which are all a
+// chirp on its own can give. The rest is filled in from the record.
+func newAttachmentReturn(id int) attachmentReturn {
+	return attachmentReturn{
+		Id:           id,
+		Url:          fmt.Sprintf("/api/attachments/%v", id),
+		ThumbnailUrl: fmt.Sprintf("/api/attachments/%v/thumbnail", id),
+	}
+}
+
+func newAttachmentReturnFrom(attachment database.Attachment) attachmentReturn {
+	result := newAttachmentReturn(attachment.Id)
+	result.ContentType = attachment.ContentType
+	result.Width = attachment.Width
+	result.Height = attachment.Height
+	result.Size = attachment.Size
+	return result
+}
+
+// attachmentReturns describes a chirp's attachments, in the order they were
+// posted, using records already loaded by ReadAttachments.
+func attachmentReturns(ids []int, records map[int]database.Attachment) []attachmentReturn {
+	result := make([]attachmentReturn, 0, len(ids))
+
+	for _, id := range ids {
+		if attachment, ok := records[id]; ok {
+			result = append(result, newAttachmentReturnFrom(attachment))
+		} else {
+			result = append(result, newAttachmentReturn(id))
+		}
+	}
+
+	return result
+}
+
+// blobCleaner deletes the blobs behind removed attachments. Deletes run in
+// the background, since listeners are called with the database locked.
+type blobCleaner struct {
+	store blobstore.BlobStore
+}
+
+func (cleaner blobCleaner) AttachmentDeleted(attachment database.Attachment) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), blobTimeout)
+		defer cancel()
+
+		for _, key := range []string{attachment.OriginalKey(), attachment.ThumbnailKey()} {
+			err := cleaner.store.Delete(ctx, key)
+
+			if err != nil {
+				log.Printf("Error deleting blob %v: %v\n", key, err.Error())
+			}
+		}
+	}()
+}
+
+// expireUploads runs in the background for the life of the server,
+// removing uploads that were never attached to anything, along with their
+// blobs.
+func (config *apiConfig) expireUploads(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := config.DbConn.ExpireAttachments(time.Now().UTC().Add(-unattachedUploadLifetime))
+
+		if err != nil {
+			log.Printf("Error expiring uploads: %v", err)
+		} else if expired > 0 {
+			log.Printf("Expired %v unattached uploads", expired)
+		}
+
+		<-ticker.C
+	}
+}
+
+// POST /api/attachments
+func (config *apiConfig) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	plan, err := config.planFor(userId)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !config.checkRateLimit(w, userId, plan) {
+		return
+	}
+
+	// Leave some room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadSize+64<<10)
+	data, err := readUploadedFile(r)
+
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) || err == media.ErrTooLarge {
+		errorResponse(w, http.StatusRequestEntityTooLarge, media.ErrTooLarge.Error())
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	processed, err := media.Process(data)
+
+	switch err {
+	case nil:
+	case media.ErrTooLarge:
+		errorResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case media.ErrUnsupportedType:
+		errorResponse(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	default:
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	blobKey, err := generateBlobKey()
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	record := database.Attachment{
+		BlobKey:              blobKey,
+		OwnerId:              userId,
+		ContentType:          processed.Original.ContentType,
+		Size:                 len(processed.Original.Data),
+		Width:                processed.Original.Width,
+		Height:               processed.Original.Height,
+		ThumbnailContentType: processed.Thumbnail.ContentType,
+	}
+
+	// The blobs are stored before the record, so nothing can see an
+	// attachment whose blobs are missing
+	ctx, cancel := context.WithTimeout(r.Context(), blobTimeout)
+	defer cancel()
+
+	err = config.blobStore.Put(ctx, record.OriginalKey(), processed.Original.ContentType, processed.Original.Data)
+
+	if err == nil {
+		err = config.blobStore.Put(ctx, record.ThumbnailKey(), processed.Thumbnail.ContentType, processed.Thumbnail.Data)
+	}
+
+	if err != nil {
+		log.Printf("Error storing blobs %v: %v\n", blobKey, err.Error())
+		blobCleaner{store: config.blobStore}.AttachmentDeleted(record)
+		errorResponse(w, http.StatusInternalServerError, "Couldn't store attachment")
+		return
+	}
+
+	attachment, err := config.DbConn.CreateAttachment(record)
+
+	if err != nil {
+		blobCleaner{store: config.blobStore}.AttachmentDeleted(record)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusCreated, newAttachmentReturnFrom(attachment))
+}
+
+func generateBlobKey() (string, error) {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+// readUploadedFile reads the "file" part of a multipart upload, stopping
+// one byte past the size limit so oversized files are caught without
+// reading them in full.
+func readUploadedFile(r *http.Request) ([]byte, error) {
+	reader, err := r.MultipartReader()
+
+	if err != nil {
+		return nil, errors.New("expected a multipart/form-data upload")
+	}
+
+	for {
+		part, err := reader.NextPart()
+
+		if err == io.EOF {
+			return nil, errors.New("missing file field")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, media.MaxUploadSize+1))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > media.MaxUploadSize {
+			return nil, media.ErrTooLarge
+		}
+
+		return data, nil
+	}
+}
+
+// GET /api/attachments/{id}
+func (config *apiConfig) readAttachment(w http.ResponseWriter, r *http.Request) {
+	config.serveAttachment(w, r, false)
+}
+
+// GET /api/attachments/{id}/thumbnail
+func (config *apiConfig) readAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	config.serveAttachment(w, r, true)
+}
+
+// serveAttachment streams an attachment from the blob store. Attachments
+// that haven't been posted yet are only visible to their owner.
+func (config *apiConfig) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	attachment, err := config.DbConn.ReadAttachment(id)
+
+	if err == os.ErrNotExist {
+		errorResponse(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Attachments on drafts and scheduled chirps aren't posted yet either
+	posted := false
+
+	if attachment.ChirpId != nil {
+		_, err = config.DbConn.ReadSingleChirp(*attachment.ChirpId)
+		posted = err == nil
+	}
+
+	if !posted && config.optionalViewer(r) != attachment.OwnerId {
+		errorResponse(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	key, contentType := attachment.OriginalKey(), attachment.ContentType
+
+	if thumbnail {
+		key, contentType = attachment.ThumbnailKey(), attachment.ThumbnailContentType
+	}
+
+	// The blob key names the bytes, so it makes a strong validator. URLs
+	// are by ID, so caches still check back in case it's been deleted.
+	etag := `"` + key + `"`
+
+	if posted {
+		w.Header().Set("Cache-Control", "public, no-cache")
+		w.Header().Set("ETag", etag)
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+
+	blob, err := config.blobStore.Get(r.Context(), key)
+
+	if err == blobstore.ErrNotFound {
+		errorResponse(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error reading blob %v: %v\n", key, err.Error())
+		errorResponse(w, http.StatusInternalServerError, "Couldn't read attachment")
+		return
+	}
+
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, blob)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+// How often lapsed subscriptions are checked for
+const subscriptionExpiryInterval = 10 * time.Minute
+
+// expireSubscriptions runs in the background for the life of the server,
+// downgrading users whose subscriptions have lapsed.
+func (config *apiConfig) expireSubscriptions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := config.DbConn.ExpireSubscriptions(time.Now().UTC())
+
+		if err != nil {
+			log.Printf("Error expiring subscriptions: %v", err)
+		} else if expired > 0 {
+			log.Printf("Expired %v lapsed subscriptions", expired)
+		}
+
+		<-ticker.C
+	}
+}
+
+// GET /api/users/me/billing
+func (config *apiConfig) readBillingHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, scopeUsersRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	history, err := config.DbConn.ReadBillingHistory(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if history == nil {
+		history = []database.BillingEvent{}
+	}
+
+	validResponse(w, http.StatusOK, history)
+	return
+}
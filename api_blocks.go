@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+// POST /api/users/{id}/block
+func (config *apiConfig) blockUser(w http.ResponseWriter, r *http.Request) {
+	config.setRelationship(w, r, config.DbConn.Block)
+}
+
+// DELETE /api/users/{id}/block
+func (config *apiConfig) unblockUser(w http.ResponseWriter, r *http.Request) {
+	config.setRelationship(w, r, config.DbConn.Unblock)
+}
+
+// POST /api/users/{id}/mute
+func (config *apiConfig) muteUser(w http.ResponseWriter, r *http.Request) {
+	config.setRelationship(w, r, config.DbConn.Mute)
+}
+
+// DELETE /api/users/{id}/mute
+func (config *apiConfig) unmuteUser(w http.ResponseWriter, r *http.Request) {
+	config.setRelationship(w, r, config.DbConn.Unmute)
+}
+
+func (config *apiConfig) setRelationship(w http.ResponseWriter, r *http.Request, set func(int, int) error) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	targetId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	err = set(userId, targetId)
+
+	if err != nil {
+		switch err {
+		case os.ErrNotExist:
+			errorResponse(w, http.StatusNotFound, "User not found")
+		case database.ErrSelfBlock:
+			errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/users/me/blocks
+func (config *apiConfig) readBlocked(w http.ResponseWriter, r *http.Request) {
+	config.readRelationships(w, r, config.DbConn.ReadBlocked)
+}
+
+// GET /api/users/me/mutes
+func (config *apiConfig) readMuted(w http.ResponseWriter, r *http.Request) {
+	config.readRelationships(w, r, config.DbConn.ReadMuted)
+}
+
+// Unlike follow lists, blocks and mutes are only shown to the user who made
+// them.
+func (config *apiConfig) readRelationships(w http.ResponseWriter, r *http.Request, list func(int) ([]int, error)) {
+	userId, err := config.authenticate(r, scopeUsersRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	ids, err := list(userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.userProfileReturns(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+}
+
+// visibleChirps drops chirps by anyone the viewer has blocked or muted, or
+// who has blocked them. Anonymous viewers see everything.
+func (config *apiConfig) visibleChirps(chirps []database.Chirp, viewerId int) ([]database.Chirp, error) {
+	if viewerId == 0 || len(chirps) == 0 {
+		return chirps, nil
+	}
+
+	hidden, err := config.DbConn.ReadHiddenAuthors(viewerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]database.Chirp, 0, len(chirps))
+
+	for _, chirp := range chirps {
+		if !hidden[chirp.AuthorId] {
+			visible = append(visible, chirp)
+		}
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/password"
+	"github.com/ajpotts01/go-chirpy/internal/stream"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestConfig returns a config backed by an empty database, with count
+// users and an access token for each.
+func newTestConfig(t *testing.T, count int) (*apiConfig, []int, []string) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "secret")
+
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "database.json"))
+
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+
+	hasher, err := password.NewBcrypt(4)
+
+	if err != nil {
+		t.Fatalf("NewBcrypt: %v", err)
+	}
+
+	db.SetPasswordHasher(hasher)
+
+	var ids []int
+	var tokens []string
+
+	for i := 0; i < count; i++ {
+		user, err := db.CreateUser(fmt.Sprintf("user%d@example.com", i+1), "password")
+
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		token, err := getJwt("chirpy-access", time.Now().Add(time.Hour), strconv.Itoa(user.Id))
+
+		if err != nil {
+			t.Fatalf("getJwt: %v", err)
+		}
+
+		ids = append(ids, user.Id)
+		tokens = append(tokens, token)
+	}
+
+	return &apiConfig{DbConn: db}, ids, tokens
+}
+
+func newTestRequest(target string, token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return r
+}
+
+func createTestChirp(t *testing.T, config *apiConfig, authorId int, inReplyTo *int) int {
+	t.Helper()
+
+	chirp, err := config.DbConn.CreateChirp("chirp", authorId, database.ChirpOptions{InReplyTo: inReplyTo})
+
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+
+	return chirp.Id
+}
+
+// threadIds flattens a thread's replies into each chirp's ID mapped to its
+// parent's.
+func threadIds(node *threadNodeReturn, parents map[int]int) {
+	for _, reply := range node.Replies {
+		parents[reply.Id] = node.Id
+		threadIds(reply, parents)
+	}
+}
+
+func TestReadThreadHidesBlockedAuthors(t *testing.T) {
+	config, users, tokens := newTestConfig(t, 4)
+	a, b, c := users[0], users[1], users[2]
+
+	// root (a) <- top (c) <- middle (b) <- bottom (c), and root <- side (c)
+	root := createTestChirp(t, config, a, nil)
+	top := createTestChirp(t, config, c, &root)
+	middle := createTestChirp(t, config, b, &top)
+	bottom := createTestChirp(t, config, c, &middle)
+	side := createTestChirp(t, config, c, &root)
+
+	err := config.DbConn.Mute(users[3], b)
+
+	if err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	err = config.DbConn.Block(b, a)
+
+	if err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Get("/api/chirps/{id}/thread", config.readThread)
+
+	tests := []struct {
+		name      string
+		chirpId   int
+		token     string
+		status    int
+		ancestors int
+		replies   map[int]int
+	}{
+		{"signed out", root, "", http.StatusOK, 0, map[int]int{top: root, middle: top, bottom: middle, side: root}},
+		{"unrelated viewer", root, tokens[2], http.StatusOK, 0, map[int]int{top: root, middle: top, bottom: middle, side: root}},
+		{"muted reply takes its replies with it", root, tokens[3], http.StatusOK, 0, map[int]int{top: root, side: root}},
+		{"blocked reply takes its replies with it", root, tokens[0], http.StatusOK, 0, map[int]int{top: root, side: root}},
+		{"blocked ancestor", bottom, tokens[0], http.StatusOK, 2, map[int]int{}},
+		{"blocked root", middle, tokens[0], http.StatusNotFound, 0, nil},
+		{"blocked by the root's author", root, tokens[1], http.StatusNotFound, 0, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newTestRequest(fmt.Sprintf("/api/chirps/%v/thread", test.chirpId), test.token))
+
+			if recorder.Code != test.status {
+				t.Fatalf("status = %v, want %v: %v", recorder.Code, test.status, recorder.Body)
+			}
+
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var thread threadReturn
+			err := json.Unmarshal(recorder.Body.Bytes(), &thread)
+
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if len(thread.Ancestors) != test.ancestors {
+				t.Errorf("%v ancestors, want %v", len(thread.Ancestors), test.ancestors)
+			}
+
+			parents := map[int]int{}
+			threadIds(thread.Chirp, parents)
+
+			if fmt.Sprint(parents) != fmt.Sprint(test.replies) {
+				t.Errorf("replies = %v, want %v", parents, test.replies)
+			}
+		})
+	}
+}
+
+func TestStreamFilterHidesBlockedAuthors(t *testing.T) {
+	config, users, tokens := newTestConfig(t, 3)
+	a, b, c := users[0], users[1], users[2]
+
+	err := config.DbConn.Follow(a, c)
+
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+
+	err = config.DbConn.Block(b, a)
+
+	if err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		token  string
+		status int
+		want   map[int]bool
+	}{
+		{"signed out", "", "", 0, nil},
+		{"signed out, one author", "?author_id=2", "", 0, map[int]bool{a: false, b: true, c: false}},
+		{"everyone", "", tokens[0], 0, map[int]bool{a: true, b: false, c: true}},
+		{"blocker's chirps", "?author_id=2", tokens[0], 0, map[int]bool{a: false, b: false, c: false}},
+		{"blocked user's view", "", tokens[1], 0, map[int]bool{a: false, b: true, c: true}},
+		{"timeline", "?timeline=true", tokens[0], 0, map[int]bool{a: true, b: false, c: true}},
+		{"timeline signed out", "?timeline=true", "", http.StatusUnauthorized, nil},
+		{"bad author", "?author_id=x", "", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, status, err := config.streamFilter(newTestRequest("/api/stream"+test.query, test.token))
+
+			if status != test.status || (err != nil) != (test.status != 0) {
+				t.Fatalf("streamFilter = %v, %v, want status %v", status, err, test.status)
+			}
+
+			if test.want == nil {
+				if filter != nil {
+					t.Fatalf("got a filter, want everything")
+				}
+				return
+			}
+
+			for authorId, want := range test.want {
+				if got := filter(stream.Event{AuthorId: authorId}); got != want {
+					t.Errorf("filter(author %v) = %v, want %v", authorId, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadBookmarksHidesBlockedAuthors(t *testing.T) {
+	config, users, tokens := newTestConfig(t, 3)
+	mine := createTestChirp(t, config, users[1], nil)
+	muted := createTestChirp(t, config, users[2], nil)
+
+	for _, chirpId := range []int{mine, muted} {
+		if err := config.DbConn.Bookmark(users[0], chirpId); err != nil {
+			t.Fatalf("Bookmark: %v", err)
+		}
+	}
+
+	if err := config.DbConn.Mute(users[0], users[2]); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	config.readBookmarks(recorder, newTestRequest("/api/users/me/bookmarks", tokens[0]))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	var page chirpPageReturn
+	err := json.Unmarshal(recorder.Body.Bytes(), &page)
+
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if len(page.Chirps) != 1 || page.Chirps[0].Id != mine {
+		t.Fatalf("bookmarks = %+v, want only chirp %v", page.Chirps, mine)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+)
+
+// POST /api/chirps/{id}/bookmark
+func (config *apiConfig) bookmarkChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Bookmark)
+}
+
+// DELETE /api/chirps/{id}/bookmark
+func (config *apiConfig) unbookmarkChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Unbookmark)
+}
+
+// GET /api/users/me/bookmarks
+// Bookmarks are private, so there's only ever the caller's own.
+func (config *apiConfig) readBookmarks(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadBookmarks(userId, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visible, err := config.visibleChirps(page.Items, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.newChirpReturns(visible, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, chirpPageReturn{Chirps: chirps, NextCursor: page.NextCursor})
+}
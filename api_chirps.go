@@ -2,45 +2,201 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+	"github.com/ajpotts01/go-chirpy/internal/moderation"
+	"github.com/ajpotts01/go-chirpy/internal/unfurl"
 	"github.com/go-chi/chi/v5"
 )
 
 type chirpReturn struct {
-	Body     string `json:"body"`
-	AuthorId int    `json:"author_id"`
-	Id       int    `json:"id"`
+	Body      string     `json:"body"`
+	AuthorId  int        `json:"author_id"`
+	Id        int        `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	InReplyTo *int       `json:"in_reply_to,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+
+	Entities    []entities.Entity  `json:"entities"`
+	Attachments []attachmentReturn `json:"attachments"`
+	Preview     *unfurl.Preview    `json:"preview,omitempty"`
+	Poll        *pollReturn        `json:"poll,omitempty"`
+
+	ReplyCount     int   `json:"reply_count"`
+	LikeCount      int   `json:"like_count"`
+	RechirpCount   int   `json:"rechirp_count"`
+	LikedByMe      *bool `json:"liked_by_me,omitempty"`
+	RechirpedByMe  *bool `json:"rechirped_by_me,omitempty"`
+	BookmarkedByMe *bool `json:"bookmarked_by_me,omitempty"`
+}
+
+// One page of a paginated chirp feed
+type chirpPageReturn struct {
+	Chirps     []chirpReturn `json:"chirps"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Deletions only say which chirp went, so the body of a chirp isn't sent out
+// again just as its author has removed it
+type chirpDeletedReturn struct {
+	Id       int `json:"id"`
+	AuthorId int `json:"author_id"`
+}
+
+func newChirpDeletedReturn(chirp database.Chirp) chirpDeletedReturn {
+	return chirpDeletedReturn{Id: chirp.Id, AuthorId: chirp.AuthorId}
+}
+
+// chirpDeletedEvent builds the event for a chirp removed along with its
+// author's account.
+func chirpDeletedEvent(chirp database.Chirp) (database.OutboundEvent, error) {
+	payload, err := newOutboundEventPayload(eventChirpDeleted, newChirpDeletedReturn(chirp))
+
+	if err != nil {
+		return database.OutboundEvent{}, err
+	}
+
+	return database.OutboundEvent{Event: eventChirpDeleted, SubjectUserId: chirp.AuthorId, Public: true, Payload: payload}, nil
 }
 
 type chirpParams struct {
-	Body string `json:"body"`
+	Body          string `json:"body"`
+	InReplyTo     *int   `json:"in_reply_to"`
+	AttachmentIds []int  `json:"attachment_ids"`
+
+	// Leave both out to publish now. A publish_at on its own schedules
+	// the chirp.
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+
+	Poll *pollParams `json:"poll"`
 }
 
-func profanityFilter(body string) string {
-	profanity := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+func newChirpReturn(chirp database.Chirp) chirpReturn {
+	result := chirpReturn{
+		Body:      chirp.Body,
+		AuthorId:  chirp.AuthorId,
+		Id:        chirp.Id,
+		CreatedAt: chirp.CreatedAt,
+		EditedAt:  chirp.EditedAt,
+		InReplyTo: chirp.InReplyTo,
+		Deleted:   chirp.Deleted,
+		Status:    chirp.Status,
+		PublishAt: chirp.PublishAt,
+		Entities:  chirp.Entities,
 	}
 
-	censor := "****"
+	if result.Status == "" {
+		result.Status = database.ChirpPublished
+	}
+
+	if result.Entities == nil {
+		result.Entities = []entities.Entity{}
+	}
 
-	words := strings.Split(body, " ")
+	result.Attachments = attachmentReturns(chirp.AttachmentIds, nil)
+	result.Poll = newPollReturn(chirp.Poll, nil)
+	return result
+}
+
+// newChirpReturns builds responses for chirps along with their engagement
+// counters. viewerId is the signed-in caller, or 0 for anonymous readers, who
+// don't get the liked_by_me, rechirped_by_me and bookmarked_by_me flags.
+func (config *apiConfig) newChirpReturns(chirps []database.Chirp, viewerId int) ([]chirpReturn, error) {
+	ids := make([]int, 0, len(chirps))
+	var attachmentIds []int
+
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.Id)
+		attachmentIds = append(attachmentIds, chirp.AttachmentIds...)
+	}
 
-	for idx, word := range words {
-		if _, ok := profanity[strings.ToLower(word)]; ok {
-			words[idx] = censor
+	stats, err := config.DbConn.ReadChirpStats(ids, viewerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := config.DbConn.ReadAttachments(attachmentIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	polls, err := config.DbConn.ReadPollResults(ids, viewerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]chirpReturn, 0, len(chirps))
+
+	for _, chirp := range chirps {
+		chirpStats := stats[chirp.Id]
+		item := newChirpReturn(chirp)
+		item.ReplyCount = chirpStats.ReplyCount
+		item.LikeCount = chirpStats.LikeCount
+		item.RechirpCount = chirpStats.RechirpCount
+		item.Attachments = attachmentReturns(chirp.AttachmentIds, attachments)
+		item.Preview = config.chirpPreview(chirp)
+
+		if results, ok := polls[chirp.Id]; ok {
+			item.Poll = newPollReturn(chirp.Poll, &results)
+		}
+
+		if viewerId != 0 {
+			item.LikedByMe = &chirpStats.LikedByViewer
+			item.RechirpedByMe = &chirpStats.RechirpedByViewer
+			item.BookmarkedByMe = &chirpStats.BookmarkedByViewer
 		}
+
+		result = append(result, item)
 	}
 
-	result := strings.Join(words, " ")
-	return result
+	return result, nil
+}
+
+// newChirpReturnFor is newChirpReturns for a single chirp.
+func (config *apiConfig) newChirpReturnFor(chirp database.Chirp, viewerId int) (chirpReturn, error) {
+	result, err := config.newChirpReturns([]database.Chirp{chirp}, viewerId)
+
+	if err != nil {
+		return chirpReturn{}, err
+	}
+
+	return result[0], nil
+}
+
+// chirpPageResponse writes a page of a public chirp feed, without the
+// chirps the viewer shouldn't see. The page can come up short as a result,
+// but the cursor still follows on from the chirps that were read.
+func (config *apiConfig) chirpPageResponse(w http.ResponseWriter, r *http.Request, page database.Page[database.Chirp]) {
+	viewerId := config.optionalViewer(r)
+	visible, err := config.visibleChirps(page.Items, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.newChirpReturns(visible, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, chirpPageReturn{Chirps: chirps, NextCursor: page.NextCursor})
 }
 
 func (config *apiConfig) readChirp(w http.ResponseWriter, r *http.Request) {
@@ -51,6 +207,8 @@ func (config *apiConfig) readChirp(w http.ResponseWriter, r *http.Request) {
 		id = 0
 	}
 
+	viewerId := config.optionalViewer(r)
+
 	if id == 0 {
 		chirps, err := config.DbConn.ReadChirps()
 
@@ -60,9 +218,21 @@ func (config *apiConfig) readChirp(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		fmt.Printf("Chirps: %v\n", chirps)
+		chirps, err = config.visibleChirps(chirps, viewerId)
 
-		validResponse(w, http.StatusOK, chirps)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		result, err := config.newChirpReturns(chirps, viewerId)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		validResponse(w, http.StatusOK, result)
 		return
 
 	} else {
@@ -79,27 +249,45 @@ func (config *apiConfig) readChirp(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		validResponse(w, http.StatusOK, chirp)
+		visible, err := config.visibleChirps([]database.Chirp{chirp}, viewerId)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Hidden chirps look the same as missing ones
+		if len(visible) == 0 {
+			errorResponse(w, http.StatusNotFound, os.ErrNotExist.Error())
+			return
+		}
+
+		result, err := config.newChirpReturnFor(chirp, viewerId)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		validResponse(w, http.StatusOK, result)
 		return
 	}
 }
 
 func (config *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
-	suppliedToken, err := getAuthHeaderItem(r, "Bearer")
+	authorId, err := config.authenticate(r, scopeChirpsWrite)
 	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, "Bad authorization header")
+		errorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	claims, err := checkToken(suppliedToken, "chirpy-access")
+	plan, err := config.planFor(authorId)
 	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, "Bad token")
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	authorId, err := strconv.Atoi(claims.Subject)
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Could not determine author ID")
+	if !config.checkRateLimit(w, authorId, plan) {
 		return
 	}
 
@@ -115,15 +303,46 @@ func (config *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	cleanedBody := profanityFilter(params.Body)
+	cleanedBody := moderation.Censor(params.Body)
 	log.Printf("Received chirp with length of %v\n", len(params.Body))
 
-	if len(cleanedBody) > 140 {
+	if utf8.RuneCountInString(cleanedBody) > plan.MaxChirpLength {
 		errorResponse(w, http.StatusBadRequest, "Chirp is too long")
 		return
 	}
 
-	newChirp, err := config.DbConn.CreateChirp(cleanedBody, authorId)
+	if params.Status == "" && params.PublishAt != nil {
+		params.Status = database.ChirpScheduled
+	}
+
+	if !checkSchedule(w, plan, params.Status, params.PublishAt) {
+		return
+	}
+
+	poll, ok := checkPoll(w, params.Poll, params.PublishAt)
+
+	if !ok {
+		return
+	}
+
+	newChirp, err := config.DbConn.CreateChirp(cleanedBody, authorId, database.ChirpOptions{
+		InReplyTo:     params.InReplyTo,
+		AttachmentIds: params.AttachmentIds,
+		Status:        params.Status,
+		PublishAt:     params.PublishAt,
+		Poll:          poll,
+	})
+
+	if err == database.ErrParentNotExist || err == database.ErrTooManyAttachments || err == database.ErrAttachmentNotAvailable ||
+		err == database.ErrInvalidStatus || err == database.ErrPublishAtRequired || err == database.ErrInvalidPoll {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err == database.ErrBlocked {
+		errorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
 
 	if err != nil {
 		log.Printf("Error creating new Chirp: %v", err.Error())
@@ -131,34 +350,107 @@ func (config *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validResponse(w, http.StatusCreated, chirpReturn{
-		Id:       newChirp.Id,
-		Body:     newChirp.Body,
-		AuthorId: authorId,
-	})
+	result, err := config.newChirpReturnFor(newChirp, 0)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusCreated, result)
 	return
 }
 
-func (config *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-	suppliedToken, err := getAuthHeaderItem(r, "Bearer")
+// PUT /api/chirps/{id}
+func (config *apiConfig) updateChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
 	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, "Bad authorization header")
+		errorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	claims, err := checkToken(suppliedToken, "chirpy-access")
+	plan, err := config.planFor(userId)
 	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, "Bad token")
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	userId, err := strconv.Atoi(claims.Subject)
+	if !config.checkRateLimit(w, userId, plan) {
+		return
+	}
+
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "id"))
 
 	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	chirp, err := config.DbConn.ReadSingleChirp(chirpId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if chirp.AuthorId != userId {
+		errorResponse(w, http.StatusForbidden, "Cannot edit a chirp you didn't post")
+		return
+	}
+
+	if !plan.CanEditChirps {
+		errorResponse(w, http.StatusForbidden, "Your plan does not include editing chirps")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := chirpParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		errorResponse(w, http.StatusBadRequest, "Invalid chirp")
+		return
+	}
+
+	cleanedBody := moderation.Censor(params.Body)
+
+	if utf8.RuneCountInString(cleanedBody) > plan.MaxChirpLength {
+		errorResponse(w, http.StatusBadRequest, "Chirp is too long")
+		return
+	}
+
+	updatedChirp, err := config.DbConn.UpdateChirp(chirpId, cleanedBody)
+
+	if err != nil {
+		log.Printf("Error editing Chirp: %v", err.Error())
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.newChirpReturnFor(updatedChirp, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+	return
+}
+
+func (config *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
 	providedChirpId := chi.URLParam(r, "id")
 	chirpId, err := strconv.Atoi(providedChirpId)
 
@@ -170,6 +462,11 @@ func (config *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 	chirp, err := config.DbConn.ReadSingleChirp(chirpId)
 
 	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -186,6 +483,8 @@ func (config *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	config.emitEvent(eventChirpDeleted, userId, true, newChirpDeletedReturn(chirp))
+
 	w.WriteHeader(http.StatusOK)
 	return
 }
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entitlements"
+	"github.com/ajpotts01/go-chirpy/internal/moderation"
+	"github.com/go-chi/chi/v5"
+)
+
+const scheduledPublishInterval = 5 * time.Second
+
+type unpublishedChirpParams struct {
+	Body      *string    `json:"body"`
+	Status    *string    `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// chirpCreatedEvent builds the webhook event for a chirp going out. The
+// database queues it in the write that publishes the chirp, whether it was
+// posted directly, published from drafts or published on schedule. A new
+// chirp has no replies, likes or votes, so there are no counts to read.
+func (config *apiConfig) chirpCreatedEvent(chirp database.Chirp, attachments map[int]database.Attachment) (database.OutboundEvent, error) {
+	result := newChirpReturn(chirp)
+	result.Attachments = attachmentReturns(chirp.AttachmentIds, attachments)
+	result.Preview = config.chirpPreview(chirp)
+	result.Poll = newPollReturn(chirp.Poll, nil)
+
+	payload, err := newOutboundEventPayload(eventChirpCreated, result)
+
+	if err != nil {
+		return database.OutboundEvent{}, err
+	}
+
+	return database.OutboundEvent{Event: eventChirpCreated, SubjectUserId: chirp.AuthorId, Public: true, Payload: payload}, nil
+}
+
+// publishScheduledChirps runs in the background for the life of the server,
+// publishing scheduled chirps as they fall due. Chirps that came due while
+// the server was down go out on the first run.
+func (config *apiConfig) publishScheduledChirps(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := config.DbConn.PublishDueChirps(time.Now().UTC())
+
+		if err != nil {
+			log.Printf("Error publishing scheduled chirps: %v", err)
+		} else if len(published) > 0 {
+			log.Printf("Published %v scheduled chirps", len(published))
+		}
+
+		<-ticker.C
+	}
+}
+
+// checkSchedule validates a chirp's publish time, writing an error and
+// returning false if it can't be scheduled.
+func checkSchedule(w http.ResponseWriter, plan entitlements.Plan, status string, publishAt *time.Time) bool {
+	if status != database.ChirpScheduled {
+		if publishAt != nil {
+			errorResponse(w, http.StatusBadRequest, "publish_at is only for scheduled chirps")
+			return false
+		}
+
+		return true
+	}
+
+	if !plan.CanScheduleChirps {
+		errorResponse(w, http.StatusForbidden, "Your plan does not include scheduling chirps")
+		return false
+	}
+
+	if publishAt == nil {
+		errorResponse(w, http.StatusBadRequest, database.ErrPublishAtRequired.Error())
+		return false
+	}
+
+	if !publishAt.After(time.Now()) {
+		errorResponse(w, http.StatusBadRequest, "publish_at must be in the future")
+		return false
+	}
+
+	return true
+}
+
+// readOwnedUnpublishedChirp loads the draft or scheduled chirp in the URL,
+// writing a 404 and returning false if it doesn't exist or belongs to
+// someone else.
+func (config *apiConfig) readOwnedUnpublishedChirp(w http.ResponseWriter, r *http.Request, userId int) (database.Chirp, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Draft not found")
+		return database.Chirp{}, false
+	}
+
+	chirp, err := config.DbConn.ReadUnpublishedChirp(id)
+
+	if err == os.ErrNotExist || (err == nil && chirp.AuthorId != userId) {
+		errorResponse(w, http.StatusNotFound, "Draft not found")
+		return database.Chirp{}, false
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+// readAllUnpublishedChirps collects every page of a user's drafts and
+// scheduled chirps, for exports.
+func (config *apiConfig) readAllUnpublishedChirps(userId int) ([]database.Chirp, error) {
+	chirps := []database.Chirp{}
+	var cursor *database.Cursor
+
+	for {
+		page, err := config.DbConn.ReadUnpublishedChirps(userId, "", cursor, database.MaxPageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		chirps = append(chirps, page.Items...)
+
+		if page.NextCursor == "" {
+			return chirps, nil
+		}
+
+		cursor, err = database.DecodeCursor(page.NextCursor)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// GET /api/users/me/drafts
+// Lists drafts and scheduled chirps; ?status= narrows it to one or the other.
+func (config *apiConfig) readUnpublishedChirps(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsRead)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+
+	if status != "" && status != database.ChirpDraft && status != database.ChirpScheduled {
+		errorResponse(w, http.StatusBadRequest, "status must be draft or scheduled")
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadUnpublishedChirps(userId, status, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.newChirpReturns(page.Items, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, chirpPageReturn{Chirps: chirps, NextCursor: page.NextCursor})
+}
+
+// PUT /api/users/me/drafts/{id}
+// Edits a draft or scheduled chirp. A status of "published" posts it now.
+func (config *apiConfig) updateUnpublishedChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	plan, err := config.planFor(userId)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !config.checkRateLimit(w, userId, plan) {
+		return
+	}
+
+	chirp, ok := config.readOwnedUnpublishedChirp(w, r, userId)
+
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := unpublishedChirpParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid draft")
+		return
+	}
+
+	if params.Body != nil {
+		cleanedBody := moderation.Censor(*params.Body)
+
+		if utf8.RuneCountInString(cleanedBody) > plan.MaxChirpLength {
+			errorResponse(w, http.StatusBadRequest, "Chirp is too long")
+			return
+		}
+
+		params.Body = &cleanedBody
+	}
+
+	// Moving the time of a scheduled chirp keeps it scheduled
+	status := chirp.Status
+
+	if params.Status != nil {
+		status = *params.Status
+	} else if params.PublishAt != nil {
+		status = database.ChirpScheduled
+		params.Status = &status
+	}
+
+	if status == database.ChirpScheduled && (params.Status != nil || params.PublishAt != nil) {
+		publishAt := chirp.PublishAt
+
+		if params.PublishAt != nil {
+			publishAt = params.PublishAt
+		}
+
+		if !checkSchedule(w, plan, status, publishAt) {
+			return
+		}
+
+		if chirp.Poll != nil && !chirp.Poll.ExpiresAt.After(*publishAt) {
+			errorResponse(w, http.StatusBadRequest, "The poll would close before the chirp is published")
+			return
+		}
+	} else if params.PublishAt != nil {
+		errorResponse(w, http.StatusBadRequest, "publish_at is only for scheduled chirps")
+		return
+	}
+
+	updated, err := config.DbConn.UpdateUnpublishedChirp(chirp.Id, database.UnpublishedUpdate{
+		Body:      params.Body,
+		Status:    params.Status,
+		PublishAt: params.PublishAt,
+	})
+
+	if err == os.ErrNotExist {
+		// The scheduler got to it first
+		errorResponse(w, http.StatusConflict, "Chirp has already been published")
+		return
+	}
+
+	if err == database.ErrInvalidStatus || err == database.ErrPublishAtRequired || err == database.ErrParentNotExist || err == database.ErrPollClosed {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err == database.ErrBlocked {
+		errorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.newChirpReturnFor(updated, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+}
+
+// DELETE /api/users/me/drafts/{id}
+// Cancels a draft or scheduled chirp.
+func (config *apiConfig) deleteUnpublishedChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirp, ok := config.readOwnedUnpublishedChirp(w, r, userId)
+
+	if !ok {
+		return
+	}
+
+	err = config.DbConn.DeleteUnpublishedChirp(chirp.Id)
+
+	if err == os.ErrNotExist {
+		errorResponse(w, http.StatusConflict, "Chirp has already been published")
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
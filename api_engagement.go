@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// POST /api/chirps/{id}/like
+func (config *apiConfig) likeChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Like)
+}
+
+// DELETE /api/chirps/{id}/like
+func (config *apiConfig) unlikeChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Unlike)
+}
+
+// POST /api/chirps/{id}/rechirp
+func (config *apiConfig) rechirpChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Rechirp)
+}
+
+// DELETE /api/chirps/{id}/rechirp
+func (config *apiConfig) unrechirpChirp(w http.ResponseWriter, r *http.Request) {
+	config.engageChirp(w, r, config.DbConn.Unrechirp)
+}
+
+// engageChirp applies a like, rechirp or bookmark change for the caller and
+// returns the chirp with its updated counters.
+func (config *apiConfig) engageChirp(w http.ResponseWriter, r *http.Request, engage func(userId int, chirpId int) error) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	plan, err := config.planFor(userId)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !config.checkRateLimit(w, userId, plan) {
+		return
+	}
+
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	err = engage(userId, chirpId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirp, err := config.DbConn.ReadSingleChirp(chirpId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.newChirpReturnFor(chirp, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+	return
+}
+
+// GET /api/users/{id}/likes
+func (config *apiConfig) readLikedChirps(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	_, err := config.DbConn.ReadUser(userId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadLikedChirps(userId, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	config.chirpPageResponse(w, r, page)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /api/hashtags/{tag}/chirps
+func (config *apiConfig) readHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := chi.URLParam(r, "tag")
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadChirpsByHashtag(tag, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	config.chirpPageResponse(w, r, page)
+}
+
+// GET /api/users/{id}/mentions
+func (config *apiConfig) readMentions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	_, err := config.DbConn.ReadUser(userId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadMentions(userId, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	config.chirpPageResponse(w, r, page)
+}
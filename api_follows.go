@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+// readFollowCount is used to fill in the counts on a single profile.
+func (config *apiConfig) readFollowCount(userId int) (database.FollowCount, error) {
+	counts, err := config.DbConn.ReadFollowCounts([]int{userId})
+
+	if err != nil {
+		return database.FollowCount{}, err
+	}
+
+	return counts[userId], nil
+}
+
+// POST /api/users/{id}/follow
+func (config *apiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	followeeId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	err = config.DbConn.Follow(userId, followeeId)
+
+	if err != nil {
+		switch err {
+		case os.ErrNotExist:
+			errorResponse(w, http.StatusNotFound, "User not found")
+		case database.ErrSelfFollow:
+			errorResponse(w, http.StatusBadRequest, err.Error())
+		case database.ErrBlocked:
+			errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// DELETE /api/users/{id}/follow
+func (config *apiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	followeeId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	err = config.DbConn.Unfollow(userId, followeeId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// GET /api/users/{id}/followers
+func (config *apiConfig) readFollowers(w http.ResponseWriter, r *http.Request) {
+	config.readFollowList(w, r, config.DbConn.ReadFollowers)
+}
+
+// GET /api/users/{id}/following
+func (config *apiConfig) readFollowing(w http.ResponseWriter, r *http.Request) {
+	config.readFollowList(w, r, config.DbConn.ReadFollowing)
+}
+
+// Follow lists are public, like the profiles they're made of
+func (config *apiConfig) readFollowList(w http.ResponseWriter, r *http.Request, list func(int) ([]int, error)) {
+	userId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	_, err := config.DbConn.ReadUser(userId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ids, err := list(userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.userProfileReturns(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+	return
+}
+
+// userProfileReturns builds the public profiles of the given users, with
+// their follow counts, in the same order. Deleted users are skipped.
+func (config *apiConfig) userProfileReturns(ids []int) ([]userProfileReturn, error) {
+	users, err := config.DbConn.ReadUsers(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := config.DbConn.ReadFollowCounts(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []userProfileReturn{}
+
+	for _, user := range users {
+		profile := newUserProfileReturn(user)
+		profile.FollowCount = counts[user.Id]
+		result = append(result, profile)
+	}
+
+	return result, nil
+}
+
+// GET /api/timeline
+func (config *apiConfig) readTimeline(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadTimeline(userId, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.newChirpReturns(page.Items, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, chirpPageReturn{Chirps: chirps, NextCursor: page.NextCursor})
+	return
+}
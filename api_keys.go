@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+const apiKeyPrefix = "chirpy_"
+
+// Shown in listings so users can tell their keys apart
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+const maxApiKeyNameLength = 50
+
+// Scopes that can be granted to API keys
+const (
+	scopeChirpsRead  = "chirps:read"
+	scopeChirpsWrite = "chirps:write"
+	scopeUsersRead   = "users:read"
+	scopeUsersWrite  = "users:write"
+)
+
+// sessionOnly marks endpoints that need a logged-in user, such as account
+// and credential management. API keys are never accepted for these.
+const sessionOnly = ""
+
+var apiKeyScopes = map[string]struct{}{
+	scopeChirpsRead:  {},
+	scopeChirpsWrite: {},
+	scopeUsersRead:   {},
+	scopeUsersWrite:  {},
+}
+
+type apiKeyParams struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// The hash is never returned, and the key itself only once on creation
+type apiKeyReturn struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func newApiKeyReturn(key database.ApiKey) apiKeyReturn {
+	return apiKeyReturn{
+		Id:         key.Id,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+func isApiKey(suppliedToken string) bool {
+	return strings.HasPrefix(suppliedToken, apiKeyPrefix)
+}
+
+// API keys are long and random, so a fast hash is enough to store them.
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateApiKey() (string, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + hex.EncodeToString(raw), nil
+}
+
+func (config *apiConfig) checkApiKey(suppliedKey string, scope string) (int, error) {
+	if scope == sessionOnly {
+		return 0, errors.New("API keys cannot be used for this endpoint")
+	}
+
+	key, err := config.DbConn.FindApiKey(hashApiKey(suppliedKey))
+	if err != nil {
+		return 0, errors.New("invalid API key")
+	}
+
+	if !key.HasScope(scope) {
+		return 0, fmt.Errorf("API key is missing the %v scope", scope)
+	}
+
+	return key.UserId, nil
+}
+
+// POST /api/users/me/keys
+func (config *apiConfig) createApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := apiKeyParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Invalid API key parameters")
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+
+	if params.Name == "" || len(params.Name) > maxApiKeyNameLength {
+		errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Name must be between 1 and %d characters", maxApiKeyNameLength))
+		return
+	}
+
+	if len(params.Scopes) == 0 {
+		errorResponse(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	for _, scope := range params.Scopes {
+		if _, ok := apiKeyScopes[scope]; !ok {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope: %v", scope))
+			return
+		}
+	}
+
+	key, err := generateApiKey()
+
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	apiKey, err := config.DbConn.CreateApiKey(userId, params.Name, key[:apiKeyDisplayLength], hashApiKey(key), params.Scopes)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := newApiKeyReturn(apiKey)
+	result.Key = key
+
+	validResponse(w, http.StatusCreated, result)
+	return
+}
+
+// GET /api/users/me/keys
+func (config *apiConfig) readApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	keys, err := config.DbConn.ReadUserApiKeys(userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := []apiKeyReturn{}
+
+	for _, key := range keys {
+		results = append(results, newApiKeyReturn(key))
+	}
+
+	validResponse(w, http.StatusOK, results)
+	return
+}
+
+// DELETE /api/users/me/keys/{id}
+func (config *apiConfig) revokeApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	keyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	err = config.DbConn.RevokeApiKey(userId, keyId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "API key not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashApiKey(t *testing.T) {
+	key, err := generateApiKey()
+
+	if err != nil {
+		t.Fatalf("generateApiKey: %v", err)
+	}
+
+	if !isApiKey(key) || len(key) != len(apiKeyPrefix)+64 {
+		t.Fatalf("generateApiKey = %q, want %q and 32 random bytes in hex", key, apiKeyPrefix)
+	}
+
+	hash := hashApiKey(key)
+
+	if hash != hashApiKey(key) || len(hash) != 64 || strings.Contains(hash, key[len(apiKeyPrefix):]) {
+		t.Fatalf("hashApiKey = %q, want a stable SHA-256 hex digest", hash)
+	}
+
+	if hashApiKey(key+"x") == hash {
+		t.Fatalf("different keys hashed the same")
+	}
+
+	if isApiKey("eyJhbGciOiJIUzI1NiJ9") {
+		t.Fatalf("a JWT was mistaken for an API key")
+	}
+}
+
+func TestCheckApiKey(t *testing.T) {
+	config, users, _ := newTestConfig(t, 1)
+
+	key, err := generateApiKey()
+
+	if err != nil {
+		t.Fatalf("generateApiKey: %v", err)
+	}
+
+	created, err := config.DbConn.CreateApiKey(users[0], "bot", key[:apiKeyDisplayLength], hashApiKey(key), []string{scopeChirpsRead})
+
+	if err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		scope string
+		ok    bool
+	}{
+		{"granted scope", key, scopeChirpsRead, true},
+		{"missing scope", key, scopeChirpsWrite, false},
+		{"session only", key, sessionOnly, false},
+		{"unknown key", key + "0", scopeChirpsRead, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userId, err := config.checkApiKey(test.key, test.scope)
+
+			if test.ok && (err != nil || userId != users[0]) {
+				t.Fatalf("checkApiKey = %v, %v, want user %v", userId, err, users[0])
+			}
+
+			if !test.ok && err == nil {
+				t.Fatalf("checkApiKey = %v, want an error", userId)
+			}
+		})
+	}
+
+	if err := config.DbConn.RevokeApiKey(users[0], created.Id); err != nil {
+		t.Fatalf("RevokeApiKey: %v", err)
+	}
+
+	if _, err := config.checkApiKey(key, scopeChirpsRead); err == nil {
+		t.Fatalf("revoked key was accepted")
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxListNameLength = 50
+const maxListDescriptionLength = 200
+
+type listReturn struct {
+	Id          int       `json:"id"`
+	OwnerId     int       `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Private     bool      `json:"private"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type listParams struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Private     *bool   `json:"private"`
+}
+
+func newListReturn(list database.UserList) listReturn {
+	return listReturn{
+		Id:          list.Id,
+		OwnerId:     list.OwnerId,
+		Name:        list.Name,
+		Description: list.Description,
+		Private:     list.Private,
+		MemberCount: len(list.Members),
+		CreatedAt:   list.CreatedAt,
+	}
+}
+
+// validListParams trims and checks list fields, returning an error message
+// if any are invalid.
+func validListParams(params *listParams) string {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+
+		if name == "" || utf8.RuneCountInString(name) > maxListNameLength {
+			return fmt.Sprintf("List names must be between 1 and %v characters", maxListNameLength)
+		}
+
+		params.Name = &name
+	}
+
+	if params.Description != nil {
+		description := strings.TrimSpace(*params.Description)
+
+		if utf8.RuneCountInString(description) > maxListDescriptionLength {
+			return fmt.Sprintf("List descriptions can be at most %v characters", maxListDescriptionLength)
+		}
+
+		params.Description = &description
+	}
+
+	return ""
+}
+
+// readVisibleList loads the list in the URL, writing a 404 and returning
+// false if it doesn't exist or is someone else's private list.
+func (config *apiConfig) readVisibleList(w http.ResponseWriter, r *http.Request, viewerId int) (database.UserList, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "List not found")
+		return database.UserList{}, false
+	}
+
+	list, err := config.DbConn.ReadList(id)
+
+	if err == os.ErrNotExist || (err == nil && !list.VisibleTo(viewerId)) {
+		errorResponse(w, http.StatusNotFound, "List not found")
+		return database.UserList{}, false
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return database.UserList{}, false
+	}
+
+	return list, true
+}
+
+// readOwnedList is readVisibleList for changes, which only the owner can
+// make.
+func (config *apiConfig) readOwnedList(w http.ResponseWriter, r *http.Request) (database.UserList, bool) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return database.UserList{}, false
+	}
+
+	list, ok := config.readVisibleList(w, r, userId)
+
+	if !ok {
+		return database.UserList{}, false
+	}
+
+	if list.OwnerId != userId {
+		errorResponse(w, http.StatusForbidden, "Cannot change a list you don't own")
+		return database.UserList{}, false
+	}
+
+	return list, true
+}
+
+// POST /api/lists
+func (config *apiConfig) createList(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := listParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil || params.Name == nil {
+		errorResponse(w, http.StatusBadRequest, "A list name is required")
+		return
+	}
+
+	if message := validListParams(&params); message != "" {
+		errorResponse(w, http.StatusBadRequest, message)
+		return
+	}
+
+	description := ""
+
+	if params.Description != nil {
+		description = *params.Description
+	}
+
+	list, err := config.DbConn.CreateList(userId, *params.Name, description, params.Private != nil && *params.Private)
+
+	if err == database.ErrTooManyLists {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusCreated, newListReturn(list))
+}
+
+// GET /api/users/{id}/lists
+// Private lists are only included for their owner.
+func (config *apiConfig) readUserLists(w http.ResponseWriter, r *http.Request) {
+	ownerId, ok := userIdParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	_, err := config.DbConn.ReadUser(ownerId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	lists, err := config.DbConn.ReadUserLists(ownerId, config.optionalViewer(r))
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := []listReturn{}
+
+	for _, list := range lists {
+		result = append(result, newListReturn(list))
+	}
+
+	validResponse(w, http.StatusOK, result)
+}
+
+// GET /api/lists/{id}
+func (config *apiConfig) readList(w http.ResponseWriter, r *http.Request) {
+	list, ok := config.readVisibleList(w, r, config.optionalViewer(r))
+
+	if !ok {
+		return
+	}
+
+	validResponse(w, http.StatusOK, newListReturn(list))
+}
+
+// PUT /api/lists/{id}
+func (config *apiConfig) updateList(w http.ResponseWriter, r *http.Request) {
+	list, ok := config.readOwnedList(w, r)
+
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := listParams{}
+	err := decoder.Decode(&params)
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid list")
+		return
+	}
+
+	if message := validListParams(&params); message != "" {
+		errorResponse(w, http.StatusBadRequest, message)
+		return
+	}
+
+	updated, err := config.DbConn.UpdateList(list.Id, database.ListUpdate{
+		Name:        params.Name,
+		Description: params.Description,
+		Private:     params.Private,
+	})
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, newListReturn(updated))
+}
+
+// DELETE /api/lists/{id}
+func (config *apiConfig) deleteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := config.readOwnedList(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := config.DbConn.DeleteList(list.Id)
+
+	if err != nil && err != os.ErrNotExist {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/lists/{id}/members
+func (config *apiConfig) readListMembers(w http.ResponseWriter, r *http.Request) {
+	list, ok := config.readVisibleList(w, r, config.optionalViewer(r))
+
+	if !ok {
+		return
+	}
+
+	ids, err := config.DbConn.ReadListMembers(list.Id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.userProfileReturns(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+}
+
+// PUT /api/lists/{id}/members/{userId}
+func (config *apiConfig) addListMember(w http.ResponseWriter, r *http.Request) {
+	config.changeListMember(w, r, config.DbConn.AddListMember)
+}
+
+// DELETE /api/lists/{id}/members/{userId}
+func (config *apiConfig) removeListMember(w http.ResponseWriter, r *http.Request) {
+	config.changeListMember(w, r, config.DbConn.RemoveListMember)
+}
+
+func (config *apiConfig) changeListMember(w http.ResponseWriter, r *http.Request, change func(id int, userId int) (database.UserList, error)) {
+	list, ok := config.readOwnedList(w, r)
+
+	if !ok {
+		return
+	}
+
+	memberId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	updated, err := change(list.Id, memberId)
+
+	switch err {
+	case nil:
+	case database.ErrMemberNotExist:
+		errorResponse(w, http.StatusNotFound, "User not found")
+		return
+	case database.ErrListFull:
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	case os.ErrNotExist:
+		errorResponse(w, http.StatusNotFound, "List not found")
+		return
+	default:
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, newListReturn(updated))
+}
+
+// GET /api/lists/{id}/chirps
+func (config *apiConfig) readListTimeline(w http.ResponseWriter, r *http.Request) {
+	viewerId := config.optionalViewer(r)
+	list, ok := config.readVisibleList(w, r, viewerId)
+
+	if !ok {
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	page, err := config.DbConn.ReadListTimeline(list.Id, cursor, limit)
+
+	if err == os.ErrNotExist {
+		errorResponse(w, http.StatusNotFound, "List not found")
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visible, err := config.visibleChirps(page.Items, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.newChirpReturns(visible, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, chirpPageReturn{Chirps: chirps, NextCursor: page.NextCursor})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+type notificationsReturn struct {
+	Notifications []database.Notification `json:"notifications"`
+	UnreadCount   int                     `json:"unread_count"`
+	NextCursor    string                  `json:"next_cursor,omitempty"`
+}
+
+type notificationsReadReturn struct {
+	Marked int `json:"marked"`
+}
+
+// GET /api/notifications
+func (config *apiConfig) readNotifications(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	cursor, limit, ok := pageParams(w, r)
+
+	if !ok {
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	page, unread, err := config.DbConn.ReadNotifications(userId, unreadOnly, cursor, limit)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, notificationsReturn{
+		Notifications: page.Items,
+		UnreadCount:   unread,
+		NextCursor:    page.NextCursor,
+	})
+	return
+}
+
+// POST /api/notifications/{id}/read
+func (config *apiConfig) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+
+	err = config.DbConn.MarkNotificationRead(userId, id)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Notification not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// POST /api/notifications/read
+func (config *apiConfig) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	marked, err := config.DbConn.MarkAllNotificationsRead(userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, notificationsReadReturn{Marked: marked})
+	return
+}
+
+// GET /api/notifications/preferences
+func (config *apiConfig) readNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	preferences, err := config.DbConn.ReadNotificationPreferences(userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, allNotificationPreferences(preferences))
+	return
+}
+
+// PUT /api/notifications/preferences
+func (config *apiConfig) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := database.NotificationPreferences{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Invalid preferences")
+		return
+	}
+
+	for notificationType := range params {
+		if !slices.Contains(database.NotificationTypes, notificationType) {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Unknown notification type: %v", notificationType))
+			return
+		}
+	}
+
+	preferences, err := config.DbConn.UpdateNotificationPreferences(userId, params)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, allNotificationPreferences(preferences))
+	return
+}
+
+// allNotificationPreferences spells out every type, so clients see the
+// defaults as well as the settings a user has changed.
+func allNotificationPreferences(preferences database.NotificationPreferences) database.NotificationPreferences {
+	result := make(database.NotificationPreferences)
+
+	for _, notificationType := range database.NotificationTypes {
+		result[notificationType] = preferences.Enabled(notificationType)
+	}
+
+	return result
+}
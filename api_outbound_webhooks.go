@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// Events that outbound webhooks can subscribe to
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserCreated  = "user.created"
+	eventUserUpgraded = "user.upgraded"
+)
+
+var outboundEvents = map[string]struct{}{
+	eventChirpCreated: {},
+	eventChirpDeleted: {},
+	eventUserCreated:  {},
+	eventUserUpgraded: {},
+}
+
+const maxWebhookEndpointsPerUser = 10
+
+// How often the outbound queue is checked for due deliveries
+const webhookDispatchInterval = 2 * time.Second
+
+type webhookEndpointParams struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// The signing secret is only returned when the endpoint is created
+type webhookEndpointReturn struct {
+	Id        int       `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+type outboundEventPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookOwner works out whose endpoints a request is managing, so the
+// same handlers serve both /api/users/me/webhooks and /admin/webhooks.
+type webhookOwner func(r *http.Request) (int, error)
+
+func newWebhookEndpointReturn(endpoint database.WebhookEndpoint) webhookEndpointReturn {
+	return webhookEndpointReturn{
+		Id:        endpoint.Id,
+		Url:       endpoint.Url,
+		Events:    endpoint.Events,
+		CreatedAt: endpoint.CreatedAt,
+	}
+}
+
+func (config *apiConfig) userWebhookOwner(r *http.Request) (int, error) {
+	return config.authenticate(r, sessionOnly)
+}
+
+// Admin routes are already guarded by adminOnly
+func adminWebhookOwner(r *http.Request) (int, error) {
+	return database.AdminOwnerId, nil
+}
+
+// emitEvent queues an event for outbound webhooks. Public events go to every
+// subscriber; private ones only to admins and to subjectUserId's endpoints.
+// Failures are logged rather than failing the request that caused them.
+func (config *apiConfig) emitEvent(event string, subjectUserId int, public bool, data interface{}) {
+	payload, err := newOutboundEventPayload(event, data)
+
+	if err != nil {
+		log.Printf("Error marshalling %v event: %v", event, err)
+		return
+	}
+
+	queued, err := config.DbConn.EnqueueWebhookEvent(event, subjectUserId, public, payload)
+
+	if err != nil {
+		log.Printf("Error queueing %v event: %v", event, err)
+		return
+	}
+
+	if queued > 0 {
+		log.Printf("Queued %v event for %v webhook endpoints", event, queued)
+	}
+}
+
+func newOutboundEventPayload(event string, data interface{}) ([]byte, error) {
+	return json.Marshal(outboundEventPayload{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+}
+
+// readOwnedWebhookEndpoint loads the endpoint in the URL, writing a 404 and
+// returning false if it doesn't exist or belongs to someone else.
+func (config *apiConfig) readOwnedWebhookEndpoint(w http.ResponseWriter, r *http.Request, ownerId int) (database.WebhookEndpoint, bool) {
+	endpointId, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Webhook endpoint not found")
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := config.DbConn.ReadWebhookEndpoint(endpointId)
+
+	if err != nil || endpoint.OwnerId != ownerId {
+		errorResponse(w, http.StatusNotFound, "Webhook endpoint not found")
+		return database.WebhookEndpoint{}, false
+	}
+
+	return endpoint, true
+}
+
+// POST /api/users/me/webhooks, POST /admin/webhooks/endpoints
+func (config *apiConfig) createWebhookEndpoint(owner webhookOwner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerId, err := owner(r)
+
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := webhookEndpointParams{}
+		err = decoder.Decode(&params)
+
+		if err != nil {
+			log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+			errorResponse(w, http.StatusBadRequest, "Invalid webhook endpoint")
+			return
+		}
+
+		endpointUrl, err := url.Parse(params.Url)
+
+		if err != nil || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") || endpointUrl.Host == "" {
+			errorResponse(w, http.StatusBadRequest, "URL must be an absolute http or https URL")
+			return
+		}
+
+		if len(params.Events) == 0 {
+			errorResponse(w, http.StatusBadRequest, "At least one event is required")
+			return
+		}
+
+		for _, event := range params.Events {
+			if _, ok := outboundEvents[event]; !ok {
+				errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Unknown event: %v", event))
+				return
+			}
+		}
+
+		existing, err := config.DbConn.ReadWebhookEndpoints(ownerId)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if ownerId != database.AdminOwnerId && len(existing) >= maxWebhookEndpointsPerUser {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("At most %d webhook endpoints are allowed", maxWebhookEndpointsPerUser))
+			return
+		}
+
+		rawSecret := make([]byte, 32)
+		_, err = rand.Read(rawSecret)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		secret := "whsec_" + hex.EncodeToString(rawSecret)
+		endpoint, err := config.DbConn.CreateWebhookEndpoint(ownerId, endpointUrl.String(), secret, params.Events)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		result := newWebhookEndpointReturn(endpoint)
+		result.Secret = endpoint.Secret
+
+		validResponse(w, http.StatusCreated, result)
+		return
+	}
+}
+
+// GET /api/users/me/webhooks, GET /admin/webhooks/endpoints
+func (config *apiConfig) readWebhookEndpoints(owner webhookOwner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerId, err := owner(r)
+
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		endpoints, err := config.DbConn.ReadWebhookEndpoints(ownerId)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		results := []webhookEndpointReturn{}
+
+		for _, endpoint := range endpoints {
+			results = append(results, newWebhookEndpointReturn(endpoint))
+		}
+
+		validResponse(w, http.StatusOK, results)
+		return
+	}
+}
+
+// DELETE /api/users/me/webhooks/{id}, DELETE /admin/webhooks/endpoints/{id}
+func (config *apiConfig) deleteWebhookEndpoint(owner webhookOwner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerId, err := owner(r)
+
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		endpoint, ok := config.readOwnedWebhookEndpoint(w, r, ownerId)
+
+		if !ok {
+			return
+		}
+
+		err = config.DbConn.DeleteWebhookEndpoint(endpoint.Id)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// GET /api/users/me/webhooks/{id}/deliveries
+// GET /admin/webhooks/endpoints/{id}/deliveries
+func (config *apiConfig) readWebhookDeliveries(owner webhookOwner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerId, err := owner(r)
+
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		endpoint, ok := config.readOwnedWebhookEndpoint(w, r, ownerId)
+
+		if !ok {
+			return
+		}
+
+		deliveries, err := config.DbConn.ReadWebhookDeliveries(endpoint.Id)
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []database.WebhookDelivery{}
+		}
+
+		validResponse(w, http.StatusOK, deliveries)
+		return
+	}
+}
+
+// POST /api/users/me/webhooks/{id}/deliveries/{deliveryId}/redeliver
+// POST /admin/webhooks/endpoints/{id}/deliveries/{deliveryId}/redeliver
+func (config *apiConfig) redeliverWebhook(owner webhookOwner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerId, err := owner(r)
+
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		endpoint, ok := config.readOwnedWebhookEndpoint(w, r, ownerId)
+
+		if !ok {
+			return
+		}
+
+		deliveryId, err := strconv.Atoi(chi.URLParam(r, "deliveryId"))
+
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "Delivery not found")
+			return
+		}
+
+		delivery, err := config.DbConn.RedeliverWebhook(endpoint.Id, deliveryId)
+
+		if err != nil {
+			if err == os.ErrNotExist {
+				errorResponse(w, http.StatusNotFound, "Delivery not found")
+				return
+			}
+
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		validResponse(w, http.StatusAccepted, delivery)
+		return
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/moderation"
+	"github.com/go-chi/chi/v5"
+)
+
+// Polls can run for up to a week after the chirp goes out
+const maxPollDuration = 7 * 24 * time.Hour
+
+type pollParams struct {
+	Options   []string   `json:"options"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type voteParams struct {
+	Option *int `json:"option"`
+}
+
+type pollOptionReturn struct {
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+// Vote counts are left out until the viewer has voted or the poll closes,
+// so early results don't sway anyone.
+type pollReturn struct {
+	Options    []pollOptionReturn `json:"options"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	Closed     bool               `json:"closed"`
+	TotalVotes *int               `json:"total_votes,omitempty"`
+	MyVote     *int               `json:"my_vote,omitempty"`
+}
+
+// newPollReturn describes a poll. results may be nil, in which case no
+// counts are shown.
+func newPollReturn(poll *database.Poll, results *database.PollResults) *pollReturn {
+	if poll == nil {
+		return nil
+	}
+
+	result := &pollReturn{
+		Options:   make([]pollOptionReturn, 0, len(poll.Options)),
+		ExpiresAt: poll.ExpiresAt,
+		Closed:    poll.Closed(time.Now()),
+	}
+
+	for _, option := range poll.Options {
+		result.Options = append(result.Options, pollOptionReturn{Text: option})
+	}
+
+	if results == nil {
+		return result
+	}
+
+	result.MyVote = results.ViewerVote
+
+	if results.ViewerVote == nil && !result.Closed {
+		return result
+	}
+
+	for i := range result.Options {
+		if i < len(results.Counts) {
+			count := results.Counts[i]
+			result.Options[i].Votes = &count
+		}
+	}
+
+	total := results.Total
+	result.TotalVotes = &total
+	return result
+}
+
+// checkPoll validates a new poll, writing an error and returning false if
+// it isn't valid. publishAt is when the chirp goes out, or nil for now.
+func checkPoll(w http.ResponseWriter, params *pollParams, publishAt *time.Time) (*database.Poll, bool) {
+	if params == nil {
+		return nil, true
+	}
+
+	if params.ExpiresAt == nil {
+		errorResponse(w, http.StatusBadRequest, "Polls need an expires_at time")
+		return nil, false
+	}
+
+	start := time.Now()
+
+	if publishAt != nil {
+		start = *publishAt
+	}
+
+	if !params.ExpiresAt.After(start) || params.ExpiresAt.Sub(start) > maxPollDuration {
+		errorResponse(w, http.StatusBadRequest, "Polls must close after the chirp is published, and within a week")
+		return nil, false
+	}
+
+	poll := &database.Poll{ExpiresAt: params.ExpiresAt.UTC()}
+
+	for _, option := range params.Options {
+		poll.Options = append(poll.Options, moderation.Censor(option))
+	}
+
+	return poll, true
+}
+
+// POST /api/chirps/{id}/votes
+func (config *apiConfig) voteInPoll(w http.ResponseWriter, r *http.Request) {
+	userId, err := config.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	plan, err := config.planFor(userId)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !config.checkRateLimit(w, userId, plan) {
+		return
+	}
+
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Poll not found")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := voteParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil || params.Option == nil {
+		errorResponse(w, http.StatusBadRequest, "An option is required")
+		return
+	}
+
+	err = config.DbConn.Vote(userId, chirpId, *params.Option)
+
+	switch err {
+	case nil:
+	case os.ErrNotExist:
+		errorResponse(w, http.StatusNotFound, "Poll not found")
+		return
+	case database.ErrInvalidOption:
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	case database.ErrPollClosed, database.ErrAlreadyVoted:
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	default:
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirp, err := config.DbConn.ReadSingleChirp(chirpId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := config.newChirpReturnFor(chirp, userId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusCreated, result)
+}
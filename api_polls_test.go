@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+func TestNewPollReturn(t *testing.T) {
+	open := &database.Poll{Options: []string{"yes", "no"}, ExpiresAt: time.Now().Add(time.Hour)}
+	closed := &database.Poll{Options: []string{"yes", "no"}, ExpiresAt: time.Now().Add(-time.Hour)}
+	voted := 1
+	counts := database.PollResults{Counts: []int{3, 4}, Total: 7}
+	withVote := database.PollResults{Counts: []int{3, 4}, Total: 7, ViewerVote: &voted}
+
+	tests := []struct {
+		name    string
+		poll    *database.Poll
+		results *database.PollResults
+		counts  bool
+	}{
+		{"open, not voted", open, &counts, false},
+		{"open, voted", open, &withVote, true},
+		{"closed, not voted", closed, &counts, true},
+		{"without results", closed, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := newPollReturn(test.poll, test.results)
+
+			if len(result.Options) != 2 || result.Options[1].Text != "no" || result.Closed != (test.poll == closed) {
+				t.Fatalf("poll = %+v", result)
+			}
+
+			shown := result.TotalVotes != nil && result.Options[0].Votes != nil && result.Options[1].Votes != nil
+
+			if !test.counts && (result.TotalVotes != nil || result.Options[0].Votes != nil || result.Options[1].Votes != nil) {
+				t.Fatalf("counts shown: %+v", result)
+			}
+
+			if test.counts && (!shown || *result.TotalVotes != 7 || *result.Options[1].Votes != 4) {
+				t.Fatalf("counts = %+v, want 3 and 4 of 7", result)
+			}
+		})
+	}
+
+	if newPollReturn(nil, nil) != nil {
+		t.Fatalf("chirp without a poll got one")
+	}
+}
+
+func TestCheckPoll(t *testing.T) {
+	now := time.Now()
+	hour := now.Add(time.Hour)
+	past := now.Add(-time.Minute)
+	tooLong := now.Add(maxPollDuration + time.Hour)
+	publishAt := now.Add(2 * maxPollDuration)
+	afterPublish := publishAt.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		params    *pollParams
+		publishAt *time.Time
+		ok        bool
+	}{
+		{"no poll", nil, nil, true},
+		{"valid", &pollParams{Options: []string{"yes", "no"}, ExpiresAt: &hour}, nil, true},
+		{"no expiry", &pollParams{Options: []string{"yes", "no"}}, nil, false},
+		{"already closed", &pollParams{Options: []string{"yes", "no"}, ExpiresAt: &past}, nil, false},
+		{"longer than a week", &pollParams{Options: []string{"yes", "no"}, ExpiresAt: &tooLong}, nil, false},
+		{"scheduled chirp", &pollParams{Options: []string{"yes", "no"}, ExpiresAt: &afterPublish}, &publishAt, true},
+		{"closes before a scheduled chirp", &pollParams{Options: []string{"yes", "no"}, ExpiresAt: &hour}, &publishAt, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			poll, ok := checkPoll(recorder, test.params, test.publishAt)
+
+			if ok != test.ok {
+				t.Fatalf("checkPoll ok = %v, want %v: %v", ok, test.ok, recorder.Body)
+			}
+
+			if !ok && recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %v, want %v", recorder.Code, http.StatusBadRequest)
+			}
+
+			if ok && (test.params == nil) != (poll == nil) {
+				t.Fatalf("poll = %+v", poll)
+			}
+		})
+	}
+
+	poll, _ := checkPoll(httptest.NewRecorder(), &pollParams{Options: []string{"kerfuffle", "fine"}, ExpiresAt: &hour}, nil)
+
+	if poll.Options[0] != "****" || poll.ExpiresAt.Location() != time.UTC {
+		t.Fatalf("poll = %+v, want options censored and the expiry in UTC", poll)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+	"github.com/ajpotts01/go-chirpy/internal/unfurl"
+)
+
+// linkUnfurler queues the links in new and edited chirps for previews, so
+// they're usually ready by the time anyone reads the chirp.
+type linkUnfurler struct {
+	unfurler *unfurl.Unfurler
+}
+
+func (listener linkUnfurler) ChirpCreated(chirp database.Chirp) {
+	if link := previewLink(chirp); link != "" {
+		listener.unfurler.Enqueue(link)
+	}
+}
+
+func (listener linkUnfurler) ChirpUpdated(chirp database.Chirp) {
+	listener.ChirpCreated(chirp)
+}
+
+func (listener linkUnfurler) ChirpDeleted(chirp database.Chirp) {}
+
+// previewLink is the link a chirp's preview is for: the first one in it.
+func previewLink(chirp database.Chirp) string {
+	for _, entity := range chirp.Entities {
+		if entity.Type == entities.TypeUrl {
+			return entity.Url
+		}
+	}
+
+	return ""
+}
+
+// chirpPreview returns a chirp's link preview, if one has been fetched.
+// Links in drafts aren't fetched, so nobody hears about them early.
+func (config *apiConfig) chirpPreview(chirp database.Chirp) *unfurl.Preview {
+	link := previewLink(chirp)
+
+	if link == "" || config.unfurler == nil || !chirp.Published() {
+		return nil
+	}
+
+	preview, ok := config.unfurler.Lookup(link)
+
+	if !ok {
+		return nil
+	}
+
+	return &preview
+}
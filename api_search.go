@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+	"github.com/ajpotts01/go-chirpy/internal/search"
+)
+
+// chirpIndexer keeps the search index in step with the database.
+type chirpIndexer struct {
+	index *search.Index
+}
+
+func (indexer chirpIndexer) ChirpCreated(chirp database.Chirp) {
+	indexer.index.Add(searchDocument(chirp))
+}
+
+func (indexer chirpIndexer) ChirpUpdated(chirp database.Chirp) {
+	indexer.index.Add(searchDocument(chirp))
+}
+
+func (indexer chirpIndexer) ChirpDeleted(chirp database.Chirp) {
+	indexer.index.Remove(chirp.Id)
+}
+
+func searchDocument(chirp database.Chirp) search.Document {
+	doc := search.Document{
+		Id:        chirp.Id,
+		AuthorId:  chirp.AuthorId,
+		Body:      chirp.Body,
+		CreatedAt: chirp.CreatedAt,
+	}
+
+	for _, entity := range chirp.Entities {
+		if entity.Type == entities.TypeHashtag {
+			doc.Tags = append(doc.Tags, entity.Tag)
+		}
+	}
+
+	return doc
+}
+
+// buildSearchIndex indexes every existing chirp. The index lives in memory,
+// so this runs on every start.
+func buildSearchIndex(db *database.Database) (*search.Index, error) {
+	index := search.NewIndex()
+	chirps, err := db.ReadChirps()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chirp := range chirps {
+		index.Add(searchDocument(chirp))
+	}
+
+	return index, nil
+}
+
+// GET /api/search/chirps
+func (config *apiConfig) searchChirps(w http.ResponseWriter, r *http.Request) {
+	query := search.ParseQuery(r.URL.Query().Get("q"))
+
+	if query.Empty() {
+		errorResponse(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	limit, ok := pageLimit(w, r)
+
+	if !ok {
+		return
+	}
+
+	if limit == 0 {
+		limit = database.DefaultPageSize
+	}
+
+	// Results are ranked rather than time ordered, so the cursor is an offset
+	offset, err := decodeSearchCursor(r.URL.Query().Get("cursor"))
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if query.Author != "" {
+		query.AuthorId, err = config.resolveAuthor(query.Author)
+
+		if err == os.ErrNotExist {
+			validResponse(w, http.StatusOK, chirpPageReturn{Chirps: []chirpReturn{}})
+			return
+		}
+
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	results := config.searchIndex.Search(query, time.Now().UTC())
+	page := chirpPageReturn{Chirps: []chirpReturn{}}
+
+	if offset < len(results) {
+		end := min(offset+limit, len(results))
+
+		if end < len(results) {
+			page.NextCursor = encodeSearchCursor(end)
+		}
+
+		results = results[offset:end]
+	} else {
+		results = nil
+	}
+
+	ids := make([]int, 0, len(results))
+
+	for _, result := range results {
+		ids = append(ids, result.Id)
+	}
+
+	chirps, err := config.DbConn.ReadChirpsById(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	viewerId := config.optionalViewer(r)
+	chirps, err = config.visibleChirps(chirps, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page.Chirps, err = config.newChirpReturns(chirps, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, page)
+	return
+}
+
+// resolveAuthor turns the value of an author: filter, a user ID or handle,
+// into a user ID.
+func (config *apiConfig) resolveAuthor(author string) (int, error) {
+	if id, err := strconv.Atoi(author); err == nil {
+		_, err = config.DbConn.ReadUser(id)
+		return id, err
+	}
+
+	user, err := config.DbConn.ReadUserByHandle(author)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return user.Id, nil
+}
+
+func encodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeSearchCursor(encoded string) (int, error) {
+	if encoded == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return 0, database.ErrBadCursor
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+
+	if err != nil || offset < 0 {
+		return 0, database.ErrBadCursor
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+func TestSearchChirps(t *testing.T) {
+	config, users, _ := newTestConfig(t, 2)
+	handle := "alice"
+
+	if _, err := config.DbConn.UpdateProfile(users[0], database.ProfileUpdate{Handle: &handle}); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	// Chirps from before the server started are indexed on start, and later
+	// ones as they're posted
+	before, err := config.DbConn.CreateChirp("hello from #golang", users[0], database.ChirpOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+
+	config.searchIndex, err = buildSearchIndex(config.DbConn)
+
+	if err != nil {
+		t.Fatalf("buildSearchIndex: %v", err)
+	}
+
+	config.DbConn.AddChirpListener(chirpIndexer{index: config.searchIndex})
+	edited := createTestChirp(t, config, users[0], nil)
+	other, err := config.DbConn.CreateChirp("hello from bob", users[1], database.ChirpOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+
+	search := func(q string) []int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		config.searchChirps(recorder, newTestRequest("/api/search/chirps?q="+url.QueryEscape(q), ""))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("search %q: status = %v: %v", q, recorder.Code, recorder.Body)
+		}
+
+		var page chirpPageReturn
+
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+
+		ids := []int{}
+
+		for _, chirp := range page.Chirps {
+			ids = append(ids, chirp.Id)
+		}
+
+		return ids
+	}
+
+	if got := search("hello"); len(got) != 2 {
+		t.Fatalf("hello = %v, want both chirps saying it", got)
+	}
+
+	if got := search("hello author:@alice"); !reflect.DeepEqual(got, []int{before.Id}) {
+		t.Fatalf("author by handle = %v, want [%v]", got, before.Id)
+	}
+
+	if got := search("hello author:" + strconv.Itoa(users[1])); !reflect.DeepEqual(got, []int{other.Id}) {
+		t.Fatalf("author by ID = %v, want [%v]", got, other.Id)
+	}
+
+	if got := search("author:nobody"); len(got) != 0 {
+		t.Fatalf("unknown author = %v, want nothing", got)
+	}
+
+	if got := search("#GoLang"); !reflect.DeepEqual(got, []int{before.Id}) {
+		t.Fatalf("hashtag = %v, want [%v]", got, before.Id)
+	}
+
+	if _, err := config.DbConn.UpdateChirp(edited, "rewritten entirely"); err != nil {
+		t.Fatalf("UpdateChirp: %v", err)
+	}
+
+	if got := search("chirp"); len(got) != 0 {
+		t.Fatalf("old body = %v, want nothing after the edit", got)
+	}
+
+	if got := search(`"rewritten entirely"`); !reflect.DeepEqual(got, []int{edited}) {
+		t.Fatalf("new body = %v, want [%v]", got, edited)
+	}
+
+	if err := config.DbConn.DeleteSingleChirp(before.Id); err != nil {
+		t.Fatalf("DeleteSingleChirp: %v", err)
+	}
+
+	if got := search("hello"); !reflect.DeepEqual(got, []int{other.Id}) {
+		t.Fatalf("hello after deleting = %v, want [%v]", got, other.Id)
+	}
+}
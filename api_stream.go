@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/stream"
+	"github.com/ajpotts01/go-chirpy/internal/websocket"
+)
+
+// Keeps idle connections from being closed by proxies, and notices clients
+// that have gone away
+const streamHeartbeatInterval = 15 * time.Second
+
+// WebSocket messages use the same envelope as outbound webhooks
+type streamMessageReturn struct {
+	Id    uint64 `json:"id"`
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// chirpPublisher feeds chirp changes from the database into the stream hub.
+type chirpPublisher struct {
+	hub *stream.Hub
+}
+
+func (publisher chirpPublisher) ChirpCreated(chirp database.Chirp) {
+	publisher.hub.Publish(stream.Event{Type: eventChirpCreated, AuthorId: chirp.AuthorId, Data: newChirpReturn(chirp)})
+}
+
+// Edits aren't streamed
+func (publisher chirpPublisher) ChirpUpdated(chirp database.Chirp) {}
+
+func (publisher chirpPublisher) ChirpDeleted(chirp database.Chirp) {
+	publisher.hub.Publish(stream.Event{Type: eventChirpDeleted, AuthorId: chirp.AuthorId, Data: newChirpDeletedReturn(chirp)})
+}
+
+// streamFilter builds the filter for a stream request. ?author_id= limits
+// the stream to one author; ?timeline=true limits it to the caller and the
+// people they follow when they connected. Signed-in callers never see
+// authors hidden from them when they connected, whichever stream they ask
+// for.
+func (config *apiConfig) streamFilter(r *http.Request) (stream.Filter, int, error) {
+	query := r.URL.Query()
+	var authors map[int]bool
+
+	if providedAuthor := query.Get("author_id"); providedAuthor != "" {
+		authorId, err := strconv.Atoi(providedAuthor)
+
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("Invalid author_id")
+		}
+
+		authors = map[int]bool{authorId: true}
+	}
+
+	viewerId := 0
+
+	if query.Get("timeline") == "true" {
+		userId, err := config.authenticate(r, scopeChirpsRead)
+
+		if err != nil {
+			return nil, http.StatusUnauthorized, err
+		}
+
+		following, err := config.DbConn.ReadFollowing(userId)
+
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		timeline := map[int]bool{userId: true}
+
+		for _, id := range following {
+			timeline[id] = true
+		}
+
+		// Both filters given means authors on the timeline only
+		if authors != nil {
+			for id := range authors {
+				authors[id] = timeline[id]
+			}
+		} else {
+			authors = timeline
+		}
+
+		viewerId = userId
+	} else {
+		viewerId = config.optionalViewer(r)
+	}
+
+	hidden := map[int]bool{}
+
+	if viewerId != 0 {
+		var err error
+		hidden, err = config.DbConn.ReadHiddenAuthors(viewerId)
+
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	if authors == nil && len(hidden) == 0 {
+		return nil, 0, nil
+	}
+
+	return func(event stream.Event) bool {
+		if hidden[event.AuthorId] {
+			return false
+		}
+
+		return authors == nil || authors[event.AuthorId]
+	}, 0, nil
+}
+
+// GET /api/stream
+func (config *apiConfig) streamChirps(w http.ResponseWriter, r *http.Request) {
+	filter, code, err := config.streamFilter(r)
+
+	if err != nil {
+		errorResponse(w, code, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		errorResponse(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	subscription := config.hub.Subscribe(filter)
+	defer config.hub.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, open := <-subscription.Events:
+			if !open {
+				if subscription.Dropped() {
+					fmt.Fprint(w, "event: error\ndata: {\"error\":\"Client too slow, reconnect to resume\"}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+
+			data, err := json.Marshal(event.Data)
+
+			if err != nil {
+				log.Printf("Error marshalling stream event: %v", err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// GET /api/stream/ws
+func (config *apiConfig) streamChirpsWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, code, err := config.streamFilter(r)
+
+	if err != nil {
+		errorResponse(w, code, err.Error())
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A no-op if the connection has already been closed with a better code
+	defer conn.Close(websocket.CloseGoingAway, "")
+
+	subscription := config.hub.Subscribe(filter)
+	defer config.hub.Unsubscribe(subscription)
+
+	closed := make(chan struct{})
+
+	go func() {
+		conn.ReadLoop()
+		close(closed)
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, open := <-subscription.Events:
+			if !open {
+				if subscription.Dropped() {
+					conn.Close(websocket.CloseTryAgainLater, "client too slow")
+				}
+				return
+			}
+
+			message, err := json.Marshal(streamMessageReturn{Id: event.Id, Event: event.Type, Data: event.Data})
+
+			if err != nil {
+				log.Printf("Error marshalling stream event: %v", err)
+				continue
+			}
+
+			if conn.WriteText(message) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if conn.Ping() != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+func TestPageParams(t *testing.T) {
+	cursor := database.Cursor{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Id: 7}
+
+	tests := []struct {
+		name   string
+		query  string
+		cursor *database.Cursor
+		limit  int
+		ok     bool
+	}{
+		{"defaults", "", nil, 0, true},
+		{"cursor and limit", "?cursor=" + cursor.Encode() + "&limit=5", &cursor, 5, true},
+		{"largest limit", "?limit=100", nil, database.MaxPageSize, true},
+		{"limit too large", "?limit=101", nil, 0, false},
+		{"zero limit", "?limit=0", nil, 0, false},
+		{"limit not a number", "?limit=ten", nil, 0, false},
+		{"bad cursor", "?cursor=nope!", nil, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			gotCursor, limit, ok := pageParams(recorder, httptest.NewRequest(http.MethodGet, "/api/chirps"+test.query, nil))
+
+			if ok != test.ok {
+				t.Fatalf("pageParams ok = %v, want %v", ok, test.ok)
+			}
+
+			if !ok {
+				if recorder.Code != http.StatusBadRequest {
+					t.Fatalf("status = %v, want 400", recorder.Code)
+				}
+				return
+			}
+
+			if limit != test.limit {
+				t.Errorf("limit = %v, want %v", limit, test.limit)
+			}
+
+			if (gotCursor == nil) != (test.cursor == nil) || (gotCursor != nil && (!gotCursor.Time.Equal(test.cursor.Time) || gotCursor.Id != test.cursor.Id)) {
+				t.Errorf("cursor = %+v, want %+v", gotCursor, test.cursor)
+			}
+		})
+	}
+}
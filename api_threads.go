@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// A chirp with its replies nested beneath it
+type threadNodeReturn struct {
+	chirpReturn
+	Replies []*threadNodeReturn `json:"replies"`
+}
+
+type threadReturn struct {
+	Ancestors []chirpReturn     `json:"ancestors"`
+	Chirp     *threadNodeReturn `json:"chirp"`
+}
+
+// GET /api/chirps/{id}/thread
+func (config *apiConfig) readThread(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	thread, err := config.DbConn.ReadThread(chirpId)
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	viewerId := config.optionalViewer(r)
+	visible, err := config.visibleChirps([]database.Chirp{thread.Chirp}, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Hidden chirps look the same as missing ones
+	if len(visible) == 0 {
+		errorResponse(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	visibleAncestors, err := config.visibleChirps(thread.Ancestors, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visibleDescendants, err := config.visibleChirps(thread.Descendants, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ancestors, err := config.newChirpReturns(visibleAncestors, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirp, err := config.newChirpReturnFor(thread.Chirp, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	descendants, err := config.newChirpReturns(visibleDescendants, viewerId)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Descendants come oldest first, so every parent is seen before its
+	// replies. A hidden reply takes its replies with it, whoever wrote them.
+	root := &threadNodeReturn{chirpReturn: chirp, Replies: []*threadNodeReturn{}}
+	nodes := map[int]*threadNodeReturn{chirp.Id: root}
+
+	for _, descendant := range descendants {
+		parent, ok := nodes[*descendant.InReplyTo]
+
+		if !ok {
+			continue
+		}
+
+		node := &threadNodeReturn{chirpReturn: descendant, Replies: []*threadNodeReturn{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[descendant.Id] = node
+	}
+
+	validResponse(w, http.StatusOK, threadReturn{Ancestors: ancestors, Chirp: root})
+	return
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ajpotts01/go-chirpy/internal/database"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -33,6 +37,60 @@ func checkToken(suppliedToken string, expectedIssuer string) (*jwt.RegisteredCla
 	return nil, errors.New("could not parse token claims")
 }
 
+// authenticate checks the credentials on a request and returns the ID of the
+// user they belong to. Access tokens carry every scope; API keys must have
+// been granted scope. Pass sessionOnly to refuse API keys altogether.
+// Credentials belonging to deleted users are rejected.
+func (config *apiConfig) authenticate(r *http.Request, scope string) (int, error) {
+	suppliedToken, err := getAuthHeaderItem(r, "Bearer")
+	if err != nil {
+		return 0, err
+	}
+
+	var userId int
+
+	if isApiKey(suppliedToken) {
+		userId, err = config.checkApiKey(suppliedToken, scope)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		claims, err := checkToken(suppliedToken, "chirpy-access")
+		if err != nil {
+			return 0, err
+		}
+
+		userId, err = strconv.Atoi(claims.Subject)
+		if err != nil {
+			return 0, errors.New("could not determine user ID")
+		}
+	}
+
+	_, err = config.DbConn.ReadUser(userId)
+	if err != nil {
+		return 0, errors.New("user no longer exists")
+	}
+
+	return userId, nil
+}
+
+// optionalViewer identifies the caller on endpoints that anonymous users can
+// also read. Missing or invalid credentials mean an anonymous reader (0)
+// rather than an error.
+func (config *apiConfig) optionalViewer(r *http.Request) int {
+	if r.Header.Get("Authorization") == "" {
+		return 0
+	}
+
+	userId, err := config.authenticate(r, scopeChirpsRead)
+
+	if err != nil {
+		return 0
+	}
+
+	return userId
+}
+
 // POST /api/refresh
 func (config *apiConfig) refreshToken(w http.ResponseWriter, r *http.Request) {
 	// No body, just check headers
@@ -55,7 +113,14 @@ func (config *apiConfig) refreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := getJwt("chirpy-refresh", getRefreshTokenExpiry(), claims.Subject)
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, "could not determine user ID")
+		return
+	}
+
+	refreshExpiry := getRefreshTokenExpiry()
+	token, err := getJwt("chirpy-refresh", refreshExpiry, claims.Subject)
 
 	if err != nil {
 		log.Printf("%v error getting token: %v\n", http.StatusInternalServerError, err)
@@ -63,6 +128,21 @@ func (config *apiConfig) refreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Checked again under the update lock, in case the same token is being
+	// refreshed concurrently
+	_, err = config.DbConn.RefreshSession(userId, suppliedToken, token, refreshExpiry)
+
+	if err == database.ErrTokenRevoked {
+		errorResponse(w, http.StatusUnauthorized, "This refresh token has been revoked")
+		return
+	}
+
+	if err != nil {
+		log.Printf("%v error recording session: %v\n", http.StatusInternalServerError, err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	log.Printf("Returning valid refresh token.")
 	validResponse(w, http.StatusOK, refreshTokenReturn{
 		Token: token,
@@ -94,20 +174,31 @@ func getAccessTokenExpiry() time.Time {
 	return time.Now().UTC().Add(time.Duration(1 * int(time.Hour)))
 }
 
+// Challenge tokens only need to last long enough to type in a code
+func getChallengeTokenExpiry() time.Time {
+	return time.Now().UTC().Add(5 * time.Minute)
+}
+
 func getRefreshTokenExpiry() time.Time {
 	return time.Now().UTC().Add(time.Duration(60 * 24 * int(time.Hour)))
 }
 
 func getJwt(issuer string, expiresAt time.Time, subject string) (string, error) {
+	// A random ID keeps two tokens issued in the same second apart, so
+	// revoking one can't revoke the other
+	rawId := make([]byte, 16)
+	_, err := rand.Read(rawId)
+
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.RegisteredClaims{
-		Issuer: issuer,
-		IssuedAt: &jwt.NumericDate{
-			time.Now().UTC(),
-		},
-		ExpiresAt: &jwt.NumericDate{
-			expiresAt,
-		},
-		Subject: subject,
+		ID:        hex.EncodeToString(rawId),
+		Issuer:    issuer,
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		Subject:   subject,
 	}
 
 	log.Println("Claims set up")
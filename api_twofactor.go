@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/totp"
+)
+
+const totpIssuer = "Chirpy"
+const recoveryCodeCount = 10
+
+// Across all of a user's challenges, on top of the limit on each one
+const twoFactorAttemptsPerMinute = 10
+
+type twoFactorEnrollReturn struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+}
+
+type twoFactorCodeParams struct {
+	Code string `json:"code"`
+}
+
+type twoFactorConfirmReturn struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type twoFactorDisableParams struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type twoFactorChallengeReturn struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type twoFactorLoginParams struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// Recovery codes look like "abcde-fghij" so they're easy to read back
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		_, err := rand.Read(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// POST /api/users/me/2fa
+func (config *apiConfig) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := config.DbConn.ReadUser(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = config.DbConn.StartTotpEnrollment(id, secret)
+
+	if err != nil {
+		if err == database.ErrTotpAlreadyEnabled {
+			errorResponse(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, twoFactorEnrollReturn{
+		Secret:     secret,
+		OtpauthUri: totp.URI(secret, totpIssuer, user.Email),
+	})
+	return
+}
+
+// POST /api/users/me/2fa/confirm
+func (config *apiConfig) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := twoFactorCodeParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Code required")
+		return
+	}
+
+	recoveryCodes, err := generateRecoveryCodes()
+
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = config.DbConn.ConfirmTotpEnrollment(id, params.Code, recoveryCodes)
+
+	if err != nil {
+		switch err {
+		case database.ErrBadTotpCode:
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+		case database.ErrTotpAlreadyEnabled, database.ErrTotpNotEnrolled:
+			errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %v", id)
+	validResponse(w, http.StatusOK, twoFactorConfirmReturn{
+		RecoveryCodes: recoveryCodes,
+	})
+	return
+}
+
+// DELETE /api/users/me/2fa
+func (config *apiConfig) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := twoFactorDisableParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Password and code required")
+		return
+	}
+
+	// Shares the login limiter, so this can't be used to guess codes instead
+	allowed, wait := config.twoFactorLimiter.Allow(id, twoFactorAttemptsPerMinute)
+
+	if !allowed {
+		tooManyRequests(w, wait)
+		return
+	}
+
+	err = config.DbConn.CheckPassword(id, params.Password)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, "Incorrect password")
+		return
+	}
+
+	err = config.DbConn.VerifySecondFactor(id, params.Code)
+
+	if err != nil {
+		if err == database.ErrTotpNotEnrolled {
+			errorResponse(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	err = config.DbConn.DisableTotp(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %v", id)
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// POST /api/login/2fa
+func (config *apiConfig) authUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := twoFactorLoginParams{}
+	err := decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Challenge token and code required")
+		return
+	}
+
+	claims, err := checkToken(params.ChallengeToken, "chirpy-2fa")
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "Failed to parse user ID")
+		return
+	}
+
+	allowed, wait := config.twoFactorLimiter.Allow(id, twoFactorAttemptsPerMinute)
+
+	if !allowed {
+		tooManyRequests(w, wait)
+		return
+	}
+
+	// Challenges are single use, and are also used up by too many wrong codes
+	err = config.DbConn.VerifyChallenge(params.ChallengeToken, claims.ExpiresAt.Time, id, params.Code)
+
+	if err != nil {
+		log.Printf("%v error verifying second factor: %v\n", http.StatusUnauthorized, err)
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := config.DbConn.ReadUser(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user.Password = nil
+	config.issueTokens(w, user)
+	return
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/search"
+)
+
+// Autocomplete wants a handful of suggestions, not a full page
+const defaultUserSearchLimit = 10
+
+// userIndexer keeps the user search index in step with the database.
+type userIndexer struct {
+	index *search.UserIndex
+}
+
+func (indexer userIndexer) UserChanged(user database.User) {
+	indexer.index.Add(searchProfile(user))
+}
+
+func (indexer userIndexer) UserDeleted(id int) {
+	indexer.index.Remove(id)
+}
+
+func searchProfile(user database.User) search.Profile {
+	return search.Profile{
+		Id:          user.Id,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+	}
+}
+
+// buildUserIndex indexes every existing user. Like the chirp index, it
+// lives in memory and is rebuilt on every start.
+func buildUserIndex(db *database.Database) (*search.UserIndex, error) {
+	index := search.NewUserIndex()
+	users, err := db.ReadAllUsers()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		index.Add(searchProfile(user))
+	}
+
+	return index, nil
+}
+
+// GET /api/search/users
+func (config *apiConfig) searchUsers(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+
+	if prefix == "" {
+		errorResponse(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	limit, ok := pageLimit(w, r)
+
+	if !ok {
+		return
+	}
+
+	if limit == 0 {
+		limit = defaultUserSearchLimit
+	}
+
+	matches := config.userIndex.Search(prefix, limit)
+	ids := make([]int, 0, len(matches))
+
+	for _, match := range matches {
+		ids = append(ids, match.Id)
+	}
+
+	users, err := config.DbConn.ReadUsers(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	counts, err := config.DbConn.ReadFollowCounts(ids)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := []userProfileReturn{}
+
+	for _, user := range users {
+		profile := newUserProfileReturn(user)
+		profile.FollowCount = counts[user.Id]
+		result = append(result, profile)
+	}
+
+	validResponse(w, http.StatusOK, result)
+	return
+}
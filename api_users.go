@@ -2,14 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+	"github.com/ajpotts01/go-chirpy/internal/password"
 	"github.com/go-chi/chi/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type userParams struct {
@@ -24,9 +30,38 @@ type userAuthParams struct {
 
 // No token or passwords returned
 type userReturn struct {
-	Id          int    `json:"id"`
-	Email       string `json:"email"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Id          int       `json:"id"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+
+	database.FollowCount
+	Subscription *database.Subscription `json:"subscription,omitempty"`
+}
+
+// Public view of a user - no email, token or password
+type userProfileReturn struct {
+	Id          int       `json:"id"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+
+	database.FollowCount
+}
+
+// Pointers so that omitted fields are left alone
+type userProfileParams struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarUrl   *string `json:"avatar_url"`
+	Handle      *string `json:"handle"`
 }
 
 type userAuthReturn struct {
@@ -46,6 +81,92 @@ type refreshTokenReturn struct {
 	Token string `json:"token"`
 }
 
+const maxDisplayNameLength = 50
+const maxBioLength = 160
+
+func newUserReturn(user database.User) userReturn {
+	return userReturn{
+		Id:          user.Id,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+		CreatedAt:   user.CreatedAt,
+		Handle:      user.Handle,
+
+		Subscription: user.Subscription,
+	}
+}
+
+func newUserProfileReturn(user database.User) userProfileReturn {
+	return userProfileReturn{
+		Id:          user.Id,
+		IsChirpyRed: user.IsChirpyRed,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+		CreatedAt:   user.CreatedAt,
+		Handle:      user.Handle,
+	}
+}
+
+func validateProfileParams(params userProfileParams) error {
+	if params.DisplayName != nil && utf8.RuneCountInString(*params.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("display name must be at most %d characters", maxDisplayNameLength)
+	}
+
+	if params.Bio != nil && utf8.RuneCountInString(*params.Bio) > maxBioLength {
+		return fmt.Errorf("bio must be at most %d characters", maxBioLength)
+	}
+
+	if params.AvatarUrl != nil && *params.AvatarUrl != "" {
+		avatarUrl, err := url.Parse(*params.AvatarUrl)
+		if err != nil || (avatarUrl.Scheme != "http" && avatarUrl.Scheme != "https") || avatarUrl.Host == "" {
+			return errors.New("avatar URL must be an absolute http or https URL")
+		}
+	}
+
+	if params.Handle != nil && *params.Handle != "" && !entities.ValidHandle(*params.Handle) {
+		return fmt.Errorf("handle must be 1 to %d letters, numbers or underscores", entities.MaxHandleLength)
+	}
+
+	return nil
+}
+
+type userDeleteParams struct {
+	Password string `json:"password"`
+}
+
+// Refresh tokens themselves are never exported
+type sessionReturn struct {
+	Id         int       `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Revoked    bool      `json:"revoked"`
+}
+
+type userExportReturn struct {
+	Profile    userReturn       `json:"profile"`
+	Chirps     []database.Chirp `json:"chirps"`
+	Drafts     []database.Chirp `json:"drafts"`
+	Sessions   []sessionReturn  `json:"sessions"`
+	ExportedAt time.Time        `json:"exported_at"`
+}
+
+// userIdParam resolves the {id} URL param, writing a 404 if it is invalid.
+func userIdParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "User not found")
+		return 0, false
+	}
+
+	return id, true
+}
+
 // POST /api/users
 func (config *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 
@@ -69,11 +190,8 @@ func (config *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validResponse(w, http.StatusCreated, userReturn{
-		Id:          newUser.Id,
-		Email:       newUser.Email,
-		IsChirpyRed: newUser.IsChirpyRed,
-	})
+	config.emitEvent(eventUserCreated, newUser.Id, false, newUserProfileReturn(newUser))
+	validResponse(w, http.StatusCreated, newUserReturn(newUser))
 	return
 }
 
@@ -84,14 +202,15 @@ func (config *apiConfig) readUser(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(providedId)
 
 	if err != nil {
-		id = 0
+		errorResponse(w, http.StatusNotFound, "User not found")
+		return
 	}
 
 	user, err := config.DbConn.ReadUser(id)
 
 	if err != nil {
 		if err == os.ErrNotExist {
-			errorResponse(w, http.StatusNotFound, err.Error())
+			errorResponse(w, http.StatusNotFound, "User not found")
 			return
 		}
 
@@ -100,7 +219,90 @@ func (config *apiConfig) readUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validResponse(w, http.StatusOK, user)
+	profile := newUserProfileReturn(user)
+	profile.FollowCount, err = config.readFollowCount(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, profile)
+	return
+}
+
+// GET /api/users/me
+func (config *apiConfig) readCurrentUser(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, scopeUsersRead)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := config.DbConn.ReadUser(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := newUserReturn(user)
+	result.FollowCount, err = config.readFollowCount(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, result)
+	return
+}
+
+// PUT /api/users/me
+func (config *apiConfig) updateProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, scopeUsersWrite)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := userProfileParams{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Invalid profile")
+		return
+	}
+
+	err = validateProfileParams(params)
+
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updatedUser, err := config.DbConn.UpdateProfile(id, database.ProfileUpdate{
+		DisplayName: params.DisplayName,
+		Bio:         params.Bio,
+		AvatarUrl:   params.AvatarUrl,
+		Handle:      params.Handle,
+	})
+
+	if err == database.ErrHandleTaken {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, newUserReturn(updatedUser))
 	return
 }
 
@@ -121,7 +323,7 @@ func (config *apiConfig) authUser(w http.ResponseWriter, r *http.Request) {
 	authUser, err := config.DbConn.AuthUser(params.Email, params.Password)
 
 	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
+		if err == password.ErrMismatchedHashAndPassword {
 			log.Printf("%v error authorising user: %v\n", http.StatusUnauthorized, err)
 			errorResponse(w, http.StatusUnauthorized, err.Error())
 			return
@@ -132,6 +334,30 @@ func (config *apiConfig) authUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if authUser.TotpEnabled {
+		challengeToken, err := getJwt("chirpy-2fa", getChallengeTokenExpiry(), fmt.Sprint(authUser.Id))
+
+		if err != nil {
+			log.Printf("%v error getting challenge token: %v\n", http.StatusInternalServerError, err)
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		log.Printf("Returning two-factor challenge.")
+		validResponse(w, http.StatusOK, twoFactorChallengeReturn{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	config.issueTokens(w, authUser)
+	return
+}
+
+// issueTokens finishes a login by creating access and refresh tokens for a
+// user who has passed every authentication step.
+func (config *apiConfig) issueTokens(w http.ResponseWriter, authUser database.User) {
 	accessToken, err := getJwt("chirpy-access", getAccessTokenExpiry(), fmt.Sprint(authUser.Id))
 
 	if err != nil {
@@ -140,7 +366,8 @@ func (config *apiConfig) authUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshToken, err := getJwt("chirpy-refresh", getRefreshTokenExpiry(), fmt.Sprint(authUser.Id))
+	refreshExpiry := getRefreshTokenExpiry()
+	refreshToken, err := getJwt("chirpy-refresh", refreshExpiry, fmt.Sprint(authUser.Id))
 
 	if err != nil {
 		log.Printf("%v error getting refresh token: %v\n", http.StatusInternalServerError, err)
@@ -148,6 +375,14 @@ func (config *apiConfig) authUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, err = config.DbConn.CreateSession(authUser.Id, refreshToken, refreshExpiry)
+
+	if err != nil {
+		log.Printf("%v error recording session: %v\n", http.StatusInternalServerError, err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	log.Printf("Returning valid authorized user.")
 	validResponse(w, http.StatusOK, userAuthReturn{
 		Email:        authUser.Email,
@@ -156,7 +391,6 @@ func (config *apiConfig) authUser(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: refreshToken,
 		IsChirpyRed:  authUser.IsChirpyRed,
 	})
-	return
 }
 
 // PUT /api/users
@@ -173,39 +407,124 @@ func (config *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	suppliedToken, err := getAuthHeaderItem(r, "Bearer")
+	id, err := config.authenticate(r, sessionOnly)
 
 	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, "Bad authorization header")
+		errorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	claims, err := checkToken(suppliedToken, "chirpy-access")
+	updatedUser, err := config.DbConn.UpdateUser(id, params.Email, params.Password)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, newUserReturn(updatedUser))
+	return
+
+}
+
+// DELETE /api/users/me
+func (config *apiConfig) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, sessionOnly)
 
 	if err != nil {
 		errorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	id, err := strconv.Atoi(claims.Subject)
+	decoder := json.NewDecoder(r.Body)
+	params := userDeleteParams{}
+	err = decoder.Decode(&params)
 
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to parse user ID")
+		log.Printf("%v error getting parameters: %v\n", http.StatusBadRequest, err)
+		errorResponse(w, http.StatusBadRequest, "Password confirmation required")
 		return
 	}
 
-	updatedUser, err := config.DbConn.UpdateUser(id, params.Email, params.Password)
+	err = config.DbConn.CheckPassword(id, params.Password)
 
 	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, "Incorrect password")
+		return
+	}
+
+	err = config.DbConn.DeleteUser(id, config.accountDeletionPolicy)
+
+	if err != nil {
+		log.Printf("Error deleting user: %v", err)
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	validResponse(w, http.StatusOK, userReturn{
-		Id:          updatedUser.Id,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
-	})
+	log.Printf("User %v deleted with policy %v", id, config.accountDeletionPolicy)
+	w.WriteHeader(http.StatusNoContent)
 	return
+}
+
+// GET /api/users/me/export
+func (config *apiConfig) exportUser(w http.ResponseWriter, r *http.Request) {
+	id, err := config.authenticate(r, sessionOnly)
+
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := config.DbConn.ReadUser(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirps, err := config.DbConn.ReadChirpsByAuthor(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	unpublished, err := config.readAllUnpublishedChirps(id)
 
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sessions, err := config.DbConn.ReadUserSessions(id)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export := userExportReturn{
+		Profile:    newUserReturn(user),
+		Chirps:     chirps,
+		Drafts:     unpublished,
+		Sessions:   []sessionReturn{},
+		ExportedAt: time.Now().UTC(),
+	}
+
+	if export.Chirps == nil {
+		export.Chirps = []database.Chirp{}
+	}
+
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, sessionReturn{
+			Id:         session.Id,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Revoked:    session.RevokedAt != "",
+		})
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%d.json"`, id))
+	validResponse(w, http.StatusOK, export)
+	return
 }
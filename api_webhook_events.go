@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /admin/webhooks/events
+func (config *apiConfig) readWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := config.DbConn.ReadWebhookEvents(r.URL.Query().Get("outcome"))
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, events)
+	return
+}
+
+// GET /admin/webhooks/events/{id}
+func (config *apiConfig) readWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	event, err := config.DbConn.ReadWebhookEvent(chi.URLParam(r, "id"))
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Webhook event not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	validResponse(w, http.StatusOK, event)
+	return
+}
+
+// POST /admin/webhooks/events/{id}/replay
+// Reprocesses a stored event whatever its previous outcome was.
+func (config *apiConfig) replayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	record, err := config.DbConn.ReadWebhookEvent(chi.URLParam(r, "id"))
+
+	if err != nil {
+		if err == os.ErrNotExist {
+			errorResponse(w, http.StatusNotFound, "Webhook event not found")
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	provider, ok := config.webhookProviders.Get(record.Provider)
+
+	if !ok {
+		errorResponse(w, http.StatusUnprocessableEntity, "Webhook provider is no longer registered")
+		return
+	}
+
+	event, err := provider.Decode(http.Header{}, record.Payload)
+
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Replaying webhook %v", record.Id)
+	record.Error = ""
+	userId, change := webhookChange(event)
+	stored, user, err := config.DbConn.ReplayWebhookEvent(record, userId, change)
+	config.respondToWebhookEvent(w, record, stored, user, event, err)
+	return
+}
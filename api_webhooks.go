@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxWebhookBodyBytes = 1 << 20
+
+type userUpgradedData struct {
+	UserId       int                    `json:"user_id"`
+	Subscription *database.Subscription `json:"subscription"`
+}
+
+// POST /api/webhooks/{provider}
+func (config *apiConfig) receiveWebhook(w http.ResponseWriter, r *http.Request) {
+	config.handleWebhook(w, r, chi.URLParam(r, "provider"))
+}
+
+// POST /api/polka/webhooks
+// Kept so Polka doesn't need reconfiguring; same as /api/webhooks/polka.
+func (config *apiConfig) upgradeUser(w http.ResponseWriter, r *http.Request) {
+	config.handleWebhook(w, r, "polka")
+}
+
+func (config *apiConfig) handleWebhook(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, ok := config.webhookProviders.Get(providerName)
+
+	if !ok {
+		errorResponse(w, http.StatusNotFound, "Unknown webhook provider")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+
+	if err != nil {
+		log.Printf("Error reading webhook body: %s", err)
+		errorResponse(w, http.StatusBadRequest, "Could not read body")
+		return
+	}
+
+	nonce, err := provider.Verify(r, body)
+
+	if err != nil {
+		log.Printf("Error - rejected %v webhook: %v", providerName, err)
+
+		if err == webhooks.ErrUnauthorized || err == webhooks.ErrReplayed {
+			errorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	event, err := provider.Decode(r.Header, body)
+
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	payloadHash := sha256.Sum256(body)
+	ids := webhookEventIds(provider, event, payloadHash[:])
+	record := database.WebhookEvent{
+		Id:          ids[0],
+		Provider:    provider.Name(),
+		Event:       event.Type,
+		PayloadHash: hex.EncodeToString(payloadHash[:]),
+		Payload:     body,
+	}
+
+	userId, change := webhookChange(event)
+	stored, user, err := config.DbConn.ProcessWebhookEvent(ids, record, nonce, userId, change)
+
+	if err == database.ErrWebhookReplayed {
+		log.Printf("Error - rejected %v webhook: %v", providerName, err)
+		errorResponse(w, http.StatusUnauthorized, webhooks.ErrReplayed.Error())
+		return
+	}
+
+	if err == database.ErrWebhookEventCompleted {
+		if stored.PayloadHash != record.PayloadHash {
+			log.Printf("Webhook %v redelivered with a different payload - ignoring", record.Id)
+		}
+
+		log.Printf("Webhook %v already %v - acknowledging duplicate", record.Id, stored.Outcome)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	config.respondToWebhookEvent(w, record, stored, user, event, err)
+	return
+}
+
+// webhookEventIds identifies a delivery for deduplication. The first ID is
+// the one to log it under and the rest are other forms it may have been
+// logged under before. Event IDs are namespaced by provider, apart from
+// legacy providers', which keep the format they were first logged in but
+// may also have been logged namespaced. Payloads without an event ID are
+// identified by their hash.
+func webhookEventIds(provider webhooks.Provider, event webhooks.Event, payloadHash []byte) []string {
+	id := event.Id
+
+	if id == "" {
+		id = "sha256:" + hex.EncodeToString(payloadHash)
+	}
+
+	namespaced := provider.Name() + ":" + id
+
+	if legacy, ok := provider.(webhooks.LegacyProvider); ok && legacy.LegacyEventIds() {
+		return []string{id, namespaced}
+	}
+
+	return []string{namespaced}
+}
+
+// webhookChange returns the user and subscription change an event asks
+// for, or a nil change if it should only be acknowledged.
+func webhookChange(event webhooks.Event) (int, *database.SubscriptionChange) {
+	if event.Action == nil {
+		return 0, nil
+	}
+
+	return event.Action.UserId, &event.Action.SubscriptionChange
+}
+
+// respondToWebhookEvent reports how an event was processed. Events that can
+// never succeed, such as changes for unknown users, are acknowledged so the
+// provider stops retrying them.
+func (config *apiConfig) respondToWebhookEvent(w http.ResponseWriter, record database.WebhookEvent, stored database.WebhookEvent, user database.User, event webhooks.Event, err error) {
+	if stored.Outcome == "" {
+		log.Printf("Error saving webhook event %v: %v", record.Id, err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Webhook %v (%v) %v", stored.Id, stored.Event, stored.Outcome)
+
+	if err != nil && err != os.ErrNotExist {
+		log.Printf("Error changing subscription: %s", err)
+		errorResponse(w, http.StatusInternalServerError, stored.Error)
+		return
+	}
+
+	if stored.Outcome == database.WebhookOutcomeProcessed && event.Action.SubscriptionChange.Event == database.SubscriptionEventUpgraded {
+		config.emitEvent(eventUserUpgraded, user.Id, false, userUpgradedData{
+			UserId:       user.Id,
+			Subscription: user.Subscription,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/webhooks"
+)
+
+// testProvider accepts every delivery and decodes it as event
+type testProvider struct {
+	event webhooks.Event
+}
+
+func (testProvider) Name() string {
+	return "test"
+}
+
+func (testProvider) Verify(r *http.Request, body []byte) (*database.WebhookNonce, error) {
+	return nil, nil
+}
+
+func (provider testProvider) Decode(header http.Header, body []byte) (webhooks.Event, error) {
+	return provider.event, nil
+}
+
+func TestWebhookEventIds(t *testing.T) {
+	hash := []byte{0xab, 0xcd}
+
+	tests := []struct {
+		name     string
+		provider webhooks.Provider
+		event    webhooks.Event
+		want     []string
+	}{
+		{"legacy with ID", webhooks.Polka{}, webhooks.Event{Id: "evt_1"}, []string{"evt_1", "polka:evt_1"}},
+		{"legacy without ID", webhooks.Polka{}, webhooks.Event{}, []string{"sha256:abcd", "polka:sha256:abcd"}},
+		{"namespaced with ID", testProvider{}, webhooks.Event{Id: "evt_1"}, []string{"test:evt_1"}},
+		{"namespaced without ID", testProvider{}, webhooks.Event{}, []string{"test:sha256:abcd"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := webhookEventIds(test.provider, test.event, hash)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("webhookEventIds = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookAppliesDuplicatesOnce(t *testing.T) {
+	config, users, _ := newTestConfig(t, 1)
+	config.webhookProviders = webhooks.NewRegistry()
+	config.webhookProviders.Register(testProvider{event: webhooks.Event{
+		Id:   "evt_1",
+		Type: "user.upgraded",
+		Action: &webhooks.Action{
+			UserId:             users[0],
+			SubscriptionChange: database.SubscriptionChange{Event: database.SubscriptionEventUpgraded},
+		},
+	}})
+
+	// Every delivery of the same event races to be the one that applies it
+	const deliveries = 5
+	var wg sync.WaitGroup
+	statuses := make([]int, deliveries)
+
+	for i := 0; i < deliveries; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/webhooks/test", strings.NewReader(`{"id":"evt_1"}`))
+			config.handleWebhook(w, r, "test")
+			statuses[i] = w.Code
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("delivery %v: status = %v, want %v", i, status, http.StatusOK)
+		}
+	}
+
+	history, err := config.DbConn.ReadBillingHistory(users[0])
+
+	if err != nil {
+		t.Fatalf("ReadBillingHistory: %v", err)
+	}
+
+	if len(history) != 1 {
+		t.Fatalf("billing history = %+v, want exactly one event", history)
+	}
+
+	event, err := config.DbConn.ReadWebhookEvent("test:evt_1")
+
+	if err != nil || event.Outcome != database.WebhookOutcomeProcessed || event.Attempts != 1 {
+		t.Fatalf("webhook event = %+v, %v, want it processed on the first attempt", event, err)
+	}
+}
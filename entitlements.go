@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/entitlements"
+)
+
+// planFor looks up the limits that apply to a user right now.
+func (config *apiConfig) planFor(userId int) (entitlements.Plan, error) {
+	user, err := config.DbConn.ReadUser(userId)
+
+	if err != nil {
+		return entitlements.Plan{}, err
+	}
+
+	return config.plans.For(user.CurrentPlan(time.Now().UTC())), nil
+}
+
+// checkRateLimit counts a request against the user's plan limit. If they
+// are over it, it writes a 429 response and returns false.
+func (config *apiConfig) checkRateLimit(w http.ResponseWriter, userId int, plan entitlements.Plan) bool {
+	allowed, wait := config.limiter.Allow(userId, plan.RequestsPerMinute)
+
+	if allowed {
+		return true
+	}
+
+	tooManyRequests(w, wait)
+	return false
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	errorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+}
@@ -8,4 +8,6 @@ require golang.org/x/crypto v0.12.0
 
 require github.com/joho/godotenv v1.5.1
 
-require github.com/golang-jwt/jwt/v5 v5.0.0 // indirect
+require github.com/golang-jwt/jwt/v5 v5.0.0
+
+require golang.org/x/sys v0.11.0 // indirect
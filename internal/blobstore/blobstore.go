@@ -0,0 +1,70 @@
+// Package blobstore stores uploaded files. Callers keep track of what each
+// blob is, including its content type; stores only map keys to bytes.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+var ErrInvalidKey = errors.New("invalid blob key")
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds if the blob is already gone.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv builds the store named by BLOB_STORE: "local" (the default), which
+// keeps files under UPLOADS_DIR, or "s3", which is configured by the S3_*
+// variables.
+func FromEnv() (BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "local":
+		dir := os.Getenv("UPLOADS_DIR")
+
+		if dir == "" {
+			dir = "uploads"
+		}
+
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyId:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE: %v", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// validKey accepts slash-separated keys made of simple path segments, so a
+// key can't escape the store's directory or bucket prefix.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,100 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps blobs as files under a directory.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	err := os.MkdirAll(root, 0700)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{root: root}, nil
+}
+
+func (store *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(store.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first, so readers never see half a blob.
+func (store *Local) Put(ctx context.Context, key string, contentType string, data []byte) error {
+	path, err := store.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+func (store *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := store.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (store *Local) Delete(ctx context.Context, key string) error {
+	path, err := store.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,251 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config points at an S3-compatible service. Endpoint is its base URL,
+// such as https://s3.eu-west-2.amazonaws.com or http://localhost:9000 for a
+// local stand-in. Buckets are addressed path-style, which every
+// S3-compatible service supports.
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+}
+
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" || config.AccessKeyId == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 endpoint, bucket and credentials are required")
+	}
+
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", config.Endpoint)
+	}
+
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (store *S3) Put(ctx context.Context, key string, contentType string, data []byte) error {
+	response, err := store.do(ctx, http.MethodPut, key, contentType, data)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	return checkS3Response(response)
+}
+
+func (store *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	response, err := store.do(ctx, http.MethodGet, key, "", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	err = checkS3Response(response)
+
+	if err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (store *S3) Delete(ctx context.Context, key string) error {
+	response, err := store.do(ctx, http.MethodDelete, key, "", nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	// S3 itself answers 204 either way, but some stand-ins say 404
+	if response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return checkS3Response(response)
+}
+
+func (store *S3) do(ctx context.Context, method string, key string, contentType string, data []byte) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	target := *store.endpoint
+	target.Path = target.Path + "/" + store.config.Bucket + "/" + key
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	signV4(request, data, store.config, time.Now().UTC())
+	return store.client.Do(request)
+}
+
+func checkS3Response(response *http.Response) error {
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("S3 request failed with %v: %s", response.Status, body)
+}
+
+// signV4 adds AWS Signature Version 4 headers to a request for the S3
+// service. The payload is hashed rather than sent unsigned.
+func signV4(request *http.Request, payload []byte, config S3Config, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := emptyPayloadHash
+
+	if len(payload) > 0 {
+		payloadHash = sha256Hex(payload)
+	}
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Host isn't in request.Header, so it's added separately
+	headers := map[string]string{"host": request.URL.Host}
+
+	for name, values := range request.Header {
+		lower := strings.ToLower(name)
+
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+config.SecretAccessKey), date)
+	key = hmacSha256(key, config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		config.AccessKeyId, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var parts []string
+
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+
+		for _, value := range values {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters, which
+// is stricter than url.QueryEscape (that turns spaces into +).
+func awsEscape(value string) string {
+	escaped := strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+	return strings.ReplaceAll(escaped, "%7E", "~")
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
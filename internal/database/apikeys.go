@@ -0,0 +1,193 @@
+package database
+
+import (
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// LastUsedAt is only refreshed this often, so a busy bot doesn't rewrite the
+// database on every request.
+const apiKeyUsageResolution = time.Minute
+
+type ApiKey struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"hash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (key ApiKey) HasScope(scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (db *Database) CreateApiKey(userId int, name string, prefix string, hash string, scopes []string) (ApiKey, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	if database.ApiKeys == nil {
+		database.ApiKeys = make(map[int]ApiKey)
+	}
+
+	key := ApiKey{
+		Id:        nextId(&database, "api_keys", database.ApiKeys),
+		UserId:    userId,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	log.Printf("New API key:\n")
+	log.Printf("Id: %v\n", key.Id)
+	log.Printf("User Id: %v\n", key.UserId)
+	log.Printf("Scopes: %v\n", key.Scopes)
+
+	database.ApiKeys[key.Id] = key
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+func (db *Database) ReadUserApiKeys(userId int) ([]ApiKey, error) {
+	var keys []ApiKey
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return keys, err
+	}
+
+	for _, key := range database.ApiKeys {
+		if key.UserId == userId {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+// FindApiKey looks up an active key by the hash of its secret and records
+// that it was used. Most lookups only read; the write lock is taken when
+// LastUsedAt is due to be refreshed.
+func (db *Database) FindApiKey(hash string) (ApiKey, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	for _, key := range database.ApiKeys {
+		if key.Hash != hash {
+			continue
+		}
+
+		if key.RevokedAt != nil {
+			return ApiKey{}, os.ErrNotExist
+		}
+
+		if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyUsageResolution {
+			db.touchApiKey(key.Id)
+		}
+
+		return key, nil
+	}
+
+	return ApiKey{}, os.ErrNotExist
+}
+
+// touchApiKey records that a key was just used. Failing to do so shouldn't
+// fail the request, so errors are only logged.
+func (db *Database) touchApiKey(id int) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		log.Printf("Error loading database: %v\n", err.Error())
+		return
+	}
+
+	key, ok := database.ApiKeys[id]
+	now := time.Now().UTC()
+
+	// Another request may have refreshed it, or revoked the key, since it
+	// was read
+	if !ok || key.RevokedAt != nil || (key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) <= apiKeyUsageResolution) {
+		return
+	}
+
+	key.LastUsedAt = &now
+	database.ApiKeys[id] = key
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+	}
+}
+
+// RevokeApiKey revokes one of a user's keys. Keys belonging to other users
+// are reported as not existing.
+func (db *Database) RevokeApiKey(userId int, id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	key, ok := database.ApiKeys[id]
+
+	if !ok || key.UserId != userId {
+		return os.ErrNotExist
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		database.ApiKeys[id] = key
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// revokeUserApiKeys revokes every key belonging to a user. It only modifies
+// the loaded schema; callers are responsible for writing it.
+func revokeUserApiKeys(database *DatabaseSchema, userId int) {
+	now := time.Now().UTC()
+
+	for id, key := range database.ApiKeys {
+		if key.UserId == userId && key.RevokedAt == nil {
+			key.RevokedAt = &now
+			database.ApiKeys[id] = key
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFindApiKey(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 2)
+
+	created, err := db.CreateApiKey(users[0], "bot", "chirpy_abc", "hash", []string{"chirps:read"})
+
+	if err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+
+	if _, err := db.FindApiKey("other"); err != os.ErrNotExist {
+		t.Fatalf("FindApiKey(unknown hash): err = %v, want os.ErrNotExist", err)
+	}
+
+	key, err := db.FindApiKey("hash")
+
+	if err != nil || key.Id != created.Id {
+		t.Fatalf("FindApiKey = %+v, %v, want key %v", key, err, created.Id)
+	}
+
+	keys, err := db.ReadUserApiKeys(users[0])
+
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Fatalf("keys = %+v, %v, want one key with LastUsedAt set", keys, err)
+	}
+
+	firstUse := *keys[0].LastUsedAt
+
+	// A second use within the resolution leaves LastUsedAt alone
+	if _, err := db.FindApiKey("hash"); err != nil {
+		t.Fatalf("FindApiKey again: %v", err)
+	}
+
+	keys, _ = db.ReadUserApiKeys(users[0])
+
+	if !keys[0].LastUsedAt.Equal(firstUse) {
+		t.Fatalf("LastUsedAt = %v, want it unchanged from %v", keys[0].LastUsedAt, firstUse)
+	}
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 2)
+
+	key, err := db.CreateApiKey(users[0], "bot", "chirpy_abc", "hash", []string{"chirps:read"})
+
+	if err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+
+	if err := db.RevokeApiKey(users[1], key.Id); err != os.ErrNotExist {
+		t.Fatalf("revoking another user's key: err = %v, want os.ErrNotExist", err)
+	}
+
+	if _, err := db.FindApiKey("hash"); err != nil {
+		t.Fatalf("FindApiKey after a failed revoke: %v", err)
+	}
+
+	if err := db.RevokeApiKey(users[0], key.Id); err != nil {
+		t.Fatalf("RevokeApiKey: %v", err)
+	}
+
+	if _, err := db.FindApiKey("hash"); err != os.ErrNotExist {
+		t.Fatalf("FindApiKey after revoking: err = %v, want os.ErrNotExist", err)
+	}
+
+	keys, err := db.ReadUserApiKeys(users[0])
+
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Fatalf("keys = %+v, %v, want the key kept and marked revoked", keys, err)
+	}
+}
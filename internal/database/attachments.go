@@ -0,0 +1,257 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MaxChirpAttachments is how many images a single chirp can carry.
+const MaxChirpAttachments = 4
+
+var ErrTooManyAttachments = fmt.Errorf("a chirp can have at most %v attachments", MaxChirpAttachments)
+var ErrAttachmentNotAvailable = errors.New("attachment does not exist or is already in use")
+
+// Attachment describes an uploaded image. The bytes live in the blob store
+// under OriginalKey and ThumbnailKey.
+type Attachment struct {
+	Id                   int       `json:"id"`
+	OwnerId              int       `json:"owner_id"`
+	ContentType          string    `json:"content_type"`
+	Size                 int       `json:"size"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	ThumbnailContentType string    `json:"thumbnail_content_type"`
+	CreatedAt            time.Time `json:"created_at"`
+
+	// Random and never reused, so deleting one attachment's blobs can't
+	// remove another's. Attachments from before it was added have none.
+	BlobKey string `json:"blob_key,omitempty"`
+
+	// Set once the attachment is posted, after which it can't be reused
+	ChirpId *int `json:"chirp_id,omitempty"`
+}
+
+// AttachmentListener is told when attachments are removed, so their blobs
+// can be deleted, under the same rules as ChirpListener.
+type AttachmentListener interface {
+	AttachmentDeleted(attachment Attachment)
+}
+
+func (attachment Attachment) OriginalKey() string {
+	return fmt.Sprintf("attachments/%v/original", attachment.blobName())
+}
+
+func (attachment Attachment) ThumbnailKey() string {
+	return fmt.Sprintf("attachments/%v/thumbnail", attachment.blobName())
+}
+
+func (attachment Attachment) blobName() string {
+	if attachment.BlobKey == "" {
+		return strconv.Itoa(attachment.Id)
+	}
+
+	return attachment.BlobKey
+}
+
+// CreateAttachment records a new upload and assigns its ID. The caller
+// picks the BlobKey and stores the blobs first, so a record never points at
+// blobs that don't exist.
+func (db *Database) CreateAttachment(attachment Attachment) (Attachment, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	if database.Attachments == nil {
+		database.Attachments = make(map[int]Attachment)
+	}
+
+	attachment.Id = nextId(&database, "attachments", database.Attachments)
+	attachment.CreatedAt = time.Now().UTC()
+	attachment.ChirpId = nil
+	database.Attachments[attachment.Id] = attachment
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return Attachment{}, err
+	}
+
+	return attachment, nil
+}
+
+func (db *Database) ReadAttachment(id int) (Attachment, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	attachment, ok := database.Attachments[id]
+
+	if !ok {
+		return Attachment{}, os.ErrNotExist
+	}
+
+	return attachment, nil
+}
+
+// ReadAttachments returns the attachments with the given IDs, keyed by ID.
+// Missing IDs are left out.
+func (db *Database) ReadAttachments(ids []int) (map[int]Attachment, error) {
+	result := make(map[int]Attachment)
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, id := range ids {
+		if attachment, ok := database.Attachments[id]; ok {
+			result[id] = attachment
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteAttachment removes an attachment that hasn't been posted yet.
+func (db *Database) DeleteAttachment(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	attachment, ok := database.Attachments[id]
+
+	if !ok || attachment.ChirpId != nil {
+		return os.ErrNotExist
+	}
+
+	delete(database.Attachments, id)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	db.attachmentDeleted(attachment)
+	return nil
+}
+
+// ExpireAttachments removes uploads created before cutoff that were never
+// attached to a chirp or draft. It returns how many were removed.
+func (db *Database) ExpireAttachments(cutoff time.Time) (int, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var removed []Attachment
+
+	for id, attachment := range database.Attachments {
+		if attachment.ChirpId == nil && attachment.CreatedAt.Before(cutoff) {
+			removed = append(removed, attachment)
+			delete(database.Attachments, id)
+		}
+	}
+
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return 0, err
+	}
+
+	for _, attachment := range removed {
+		db.attachmentDeleted(attachment)
+	}
+
+	return len(removed), nil
+}
+
+// AddAttachmentListener registers a listener for removed attachments.
+// Listeners must be added before the server starts handling requests.
+func (db *Database) AddAttachmentListener(listener AttachmentListener) {
+	db.attachmentListeners = append(db.attachmentListeners, listener)
+}
+
+func (db *Database) attachmentDeleted(attachment Attachment) {
+	for _, listener := range db.attachmentListeners {
+		listener.AttachmentDeleted(attachment)
+	}
+}
+
+// attachToChirp claims the uploads in ids for a new chirp. Each must belong
+// to the author and not be on another chirp already.
+func attachToChirp(database *DatabaseSchema, chirpId int, authorId int, ids []int) error {
+	if len(ids) > MaxChirpAttachments {
+		return ErrTooManyAttachments
+	}
+
+	for i, id := range ids {
+		attachment, ok := database.Attachments[id]
+
+		if !ok || attachment.OwnerId != authorId || attachment.ChirpId != nil {
+			return ErrAttachmentNotAvailable
+		}
+
+		for _, other := range ids[:i] {
+			if other == id {
+				return ErrAttachmentNotAvailable
+			}
+		}
+	}
+
+	for _, id := range ids {
+		attachment := database.Attachments[id]
+		attachment.ChirpId = &chirpId
+		database.Attachments[id] = attachment
+	}
+
+	return nil
+}
+
+func removeChirpAttachments(database *DatabaseSchema, chirp Chirp) []Attachment {
+	var removed []Attachment
+
+	for _, id := range chirp.AttachmentIds {
+		if attachment, ok := database.Attachments[id]; ok {
+			removed = append(removed, attachment)
+			delete(database.Attachments, id)
+		}
+	}
+
+	return removed
+}
+
+// removeUserAttachments drops a deleted user's uploads that were never
+// posted. Posted ones go with their chirps.
+func removeUserAttachments(database *DatabaseSchema, userId int) []Attachment {
+	var removed []Attachment
+
+	for id, attachment := range database.Attachments {
+		if attachment.OwnerId == userId && attachment.ChirpId == nil {
+			removed = append(removed, attachment)
+			delete(database.Attachments, id)
+		}
+	}
+
+	return removed
+}
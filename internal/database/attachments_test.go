@@ -0,0 +1,86 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttachmentKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		attachment Attachment
+		original   string
+		thumbnail  string
+	}{
+		{"blob key", Attachment{Id: 3, BlobKey: "9f86d081"}, "attachments/9f86d081/original", "attachments/9f86d081/thumbnail"},
+		{"from before blob keys", Attachment{Id: 3}, "attachments/3/original", "attachments/3/thumbnail"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.attachment.OriginalKey(); got != test.original {
+				t.Errorf("OriginalKey = %v, want %v", got, test.original)
+			}
+
+			if got := test.attachment.ThumbnailKey(); got != test.thumbnail {
+				t.Errorf("ThumbnailKey = %v, want %v", got, test.thumbnail)
+			}
+		})
+	}
+}
+
+// testAttachmentListener records the attachments it's told were removed
+type testAttachmentListener struct {
+	deleted *[]int
+}
+
+func (listener testAttachmentListener) AttachmentDeleted(attachment Attachment) {
+	*listener.deleted = append(*listener.deleted, attachment.Id)
+}
+
+func TestExpireAttachments(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+
+	var deleted []int
+	db.AddAttachmentListener(testAttachmentListener{deleted: &deleted})
+
+	upload := func() Attachment {
+		t.Helper()
+		attachment, err := db.CreateAttachment(Attachment{OwnerId: users[0], ContentType: "image/png"})
+
+		if err != nil {
+			t.Fatalf("CreateAttachment: %v", err)
+		}
+
+		return attachment
+	}
+
+	posted := upload()
+	drafted := upload()
+	unattached := upload()
+	createTestChirp(t, db, users[0], "posted", ChirpOptions{AttachmentIds: []int{posted.Id}})
+	createTestChirp(t, db, users[0], "drafted", ChirpOptions{Status: ChirpDraft, AttachmentIds: []int{drafted.Id}})
+
+	expired, err := db.ExpireAttachments(unattached.CreatedAt)
+
+	if err != nil || expired != 0 {
+		t.Fatalf("ExpireAttachments(before any uploads) = %v, %v, want nothing expired", expired, err)
+	}
+
+	expired, err = db.ExpireAttachments(time.Now().Add(time.Minute))
+
+	if err != nil || expired != 1 {
+		t.Fatalf("ExpireAttachments = %v, %v, want only the unattached upload expired", expired, err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != unattached.Id {
+		t.Fatalf("listener was told about %v, want [%v]", deleted, unattached.Id)
+	}
+
+	remaining, err := db.ReadAttachments([]int{posted.Id, drafted.Id, unattached.Id})
+
+	if err != nil || len(remaining) != 2 {
+		t.Fatalf("ReadAttachments = %v, %v, want the posted and drafted uploads kept", remaining, err)
+	}
+}
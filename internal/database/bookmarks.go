@@ -0,0 +1,103 @@
+package database
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Bookmark saves a chirp for userId. Bookmarks are private, so nobody is
+// notified. Bookmarking a chirp twice is a no-op.
+func (db *Database) Bookmark(userId int, chirpId int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	chirp, ok := database.Chirps[chirpId]
+
+	if !ok || chirp.Deleted || hiddenAuthors(&database, userId)[chirp.AuthorId] {
+		return os.ErrNotExist
+	}
+
+	if _, ok := database.Bookmarks[userId][chirpId]; ok {
+		return nil
+	}
+
+	if database.Bookmarks == nil {
+		database.Bookmarks = make(map[int]map[int]time.Time)
+	}
+
+	if database.Bookmarks[userId] == nil {
+		database.Bookmarks[userId] = make(map[int]time.Time)
+	}
+
+	database.Bookmarks[userId][chirpId] = time.Now().UTC()
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (db *Database) Unbookmark(userId int, chirpId int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := database.Bookmarks[userId][chirpId]; !ok {
+		return nil
+	}
+
+	delete(database.Bookmarks[userId], chirpId)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadBookmarks returns a page of a user's bookmarked chirps, most recently
+// bookmarked first.
+func (db *Database) ReadBookmarks(userId int, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	bookmarks := database.Bookmarks[userId]
+	var chirps []Chirp
+
+	for chirpId := range bookmarks {
+		if chirp, ok := database.Chirps[chirpId]; ok && !chirp.Deleted {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return paginate(chirps, cursor, limit, func(chirp Chirp) Cursor {
+		return Cursor{Time: bookmarks[chirp.Id], Id: chirp.Id}
+	}), nil
+}
+
+// removeChirpBookmarks drops a deleted chirp from everyone's bookmarks.
+func removeChirpBookmarks(database *DatabaseSchema, chirpId int) {
+	for _, bookmarks := range database.Bookmarks {
+		delete(bookmarks, chirpId)
+	}
+}
+
+func removeUserBookmarks(database *DatabaseSchema, userId int) {
+	delete(database.Bookmarks, userId)
+}
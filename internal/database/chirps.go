@@ -1,44 +1,134 @@
 package database
 
 import (
+	"errors"
 	"log"
 	"os"
 	"sort"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
 )
 
 type Chirp struct {
-	Body     string `json:"body"`
-	Id       int    `json:"id"`
-	AuthorId int    `json:"author_id"`
+	Body      string     `json:"body"`
+	Id        int        `json:"id"`
+	AuthorId  int        `json:"author_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	InReplyTo *int       `json:"in_reply_to,omitempty"`
+	Status    string     `json:"status,omitempty"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+
+	Entities      []entities.Entity `json:"entities,omitempty"`
+	AttachmentIds []int             `json:"attachment_ids,omitempty"`
+	Poll          *Poll             `json:"poll,omitempty"`
+
+	// A deleted chirp with replies is kept as a tombstone, with its body and
+	// author cleared, so the rest of its thread stays connected
+	Deleted bool `json:"deleted,omitempty"`
 }
 
-func (db *Database) CreateChirp(body string, authorId int) (Chirp, error) {
+// ChirpOptions are the optional parts of a new chirp. Chirps are published
+// straight away unless Status says otherwise.
+type ChirpOptions struct {
+	InReplyTo     *int
+	AttachmentIds []int
+	Status        string
+	PublishAt     *time.Time
+	Poll          *Poll
+}
+
+var ErrParentNotExist = errors.New("chirp being replied to does not exist")
+
+// CreateChirp posts a chirp, or saves it as a draft or scheduled chirp,
+// which stay out of every public read until they're published.
+func (db *Database) CreateChirp(body string, authorId int, options ChirpOptions) (Chirp, error) {
 	var chirp Chirp
 
-	database, err := db.loadDatabase()
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
 
 	if err != nil {
 		return chirp, err
 	}
 
-	newId := len(database.Chirps) + 1
+	status := options.Status
+
+	switch status {
+	case "":
+		status = ChirpPublished
+	case ChirpDraft, ChirpPublished:
+	case ChirpScheduled:
+		if options.PublishAt == nil {
+			return chirp, ErrPublishAtRequired
+		}
+	default:
+		return chirp, ErrInvalidStatus
+	}
+
+	if options.Poll != nil && !validPoll(*options.Poll) {
+		return chirp, ErrInvalidPoll
+	}
+
+	if options.InReplyTo != nil {
+		parent, ok := database.Chirps[*options.InReplyTo]
+
+		if !ok || parent.Deleted {
+			return chirp, ErrParentNotExist
+		}
+
+		if hasBlocked(&database, parent.AuthorId, authorId) {
+			return chirp, ErrBlocked
+		}
+	}
+
+	newId := nextChirpId(&database)
+	err = attachToChirp(&database, newId, authorId, options.AttachmentIds)
+
+	if err != nil {
+		return chirp, err
+	}
 
 	chirp = Chirp{
-		Id:       newId,
-		Body:     body,
-		AuthorId: authorId,
+		Id:        newId,
+		Body:      body,
+		AuthorId:  authorId,
+		CreatedAt: time.Now().UTC(),
+		InReplyTo: options.InReplyTo,
+		Status:    status,
+		Entities:  parseEntities(&database, body, authorId),
+
+		AttachmentIds: options.AttachmentIds,
+		Poll:          options.Poll,
+	}
+
+	if status == ChirpScheduled {
+		chirp.PublishAt = options.PublishAt
 	}
 
 	log.Printf("New Chirp:\n")
 	log.Printf("Id: %v\n", chirp.Id)
 	log.Printf("Author Id: %v\n", chirp.AuthorId)
 	log.Printf("Body: %v\n", chirp.Body)
+	log.Printf("Status: %v\n", chirp.Status)
+
+	if status == ChirpPublished {
+		chirp, err = publishChirp(&database, chirp, chirp.CreatedAt)
 
-	if database.Chirps == nil {
-		database.Chirps = make(map[int]Chirp)
+		if err != nil {
+			return Chirp{}, err
+		}
+
+		db.queueChirpEvent(&database, chirp)
+	} else {
+		if database.Unpublished == nil {
+			database.Unpublished = make(map[int]Chirp)
+		}
+
+		database.Unpublished[newId] = chirp
 	}
 
-	database.Chirps[newId] = chirp
 	err = db.writeDatabase(database)
 
 	if err != nil {
@@ -46,6 +136,10 @@ func (db *Database) CreateChirp(body string, authorId int) (Chirp, error) {
 		return Chirp{}, err
 	}
 
+	if chirp.Published() {
+		db.chirpCreated(chirp)
+	}
+
 	return chirp, nil
 }
 
@@ -62,13 +156,50 @@ func (db *Database) ReadSingleChirp(id int) (Chirp, error) {
 
 	chirp, ok := database.Chirps[id]
 
-	if !ok {
+	if !ok || chirp.Deleted {
 		return Chirp{}, os.ErrNotExist
 	}
 
 	return chirp, nil
 }
 
+func (db *Database) UpdateChirp(id int, body string) (Chirp, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirp, ok := database.Chirps[id]
+
+	if !ok || chirp.Deleted {
+		return Chirp{}, os.ErrNotExist
+	}
+
+	previous := chirp
+	editedAt := time.Now().UTC()
+	chirp.Body = body
+	chirp.Entities = parseEntities(&database, body, chirp.AuthorId)
+	chirp.EditedAt = &editedAt
+
+	log.Printf("Edit Chirp:\n")
+	log.Printf("Id: %v\n", chirp.Id)
+	log.Printf("Body: %v\n", chirp.Body)
+
+	database.Chirps[id] = chirp
+	notifyChirp(&database, chirp, &previous)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return Chirp{}, err
+	}
+
+	db.chirpUpdated(chirp)
+	return chirp, nil
+}
+
 func (db *Database) ReadChirps() ([]Chirp, error) {
 	var chirps []Chirp
 	database, err := db.loadDatabase()
@@ -81,6 +212,10 @@ func (db *Database) ReadChirps() ([]Chirp, error) {
 	log.Printf("Chirps: %v\n", database.Chirps)
 
 	for _, val := range database.Chirps {
+		if val.Deleted {
+			continue
+		}
+
 		log.Printf("Loaded chirp: %v\n", val)
 		chirps = append(chirps, val)
 	}
@@ -90,23 +225,117 @@ func (db *Database) ReadChirps() ([]Chirp, error) {
 	return chirps, nil
 }
 
-func (db *Database) DeleteSingleChirp(id int) error {
+// ReadChirpsById returns the chirps with the given IDs, in the same order.
+// Missing and deleted chirps are skipped.
+func (db *Database) ReadChirpsById(ids []int) ([]Chirp, error) {
+	var chirps []Chirp
 	database, err := db.loadDatabase()
 
+	if err != nil {
+		return chirps, err
+	}
+
+	for _, id := range ids {
+		if chirp, ok := database.Chirps[id]; ok && !chirp.Deleted {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return chirps, nil
+}
+
+func (db *Database) ReadChirpsByAuthor(authorId int) ([]Chirp, error) {
+	var authored []Chirp
+	chirps, err := db.ReadChirps()
+
+	if err != nil {
+		return authored, err
+	}
+
+	for _, chirp := range chirps {
+		if chirp.AuthorId == authorId {
+			authored = append(authored, chirp)
+		}
+	}
+
+	return authored, nil
+}
+
+func (db *Database) DeleteSingleChirp(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
 	if err != nil {
 		log.Printf("Error loading database %v\n", err.Error())
 		return err
 	}
 
-	if _, ok := database.Chirps[id]; ok {
-		delete(database.Chirps, id)
+	if chirp, ok := database.Chirps[id]; ok && !chirp.Deleted {
+		removedAttachments := removeChirp(&database, id)
 		err = db.writeDatabase(database)
 
 		if err != nil {
 			log.Printf("Error writing database: %v\n", err.Error())
 			return err
 		}
+
+		db.chirpDeleted(chirp)
+
+		for _, attachment := range removedAttachments {
+			db.attachmentDeleted(attachment)
+		}
 	}
 
 	return nil
 }
+
+// removeChirp deletes a chirp from the loaded schema, leaving a tombstone if
+// it still has replies. Tombstones left without replies are cleaned up on
+// the way back up the thread. It returns the attachments that were removed
+// with it, whose blobs are left for the caller.
+func removeChirp(database *DatabaseSchema, id int) []Attachment {
+	chirp, ok := database.Chirps[id]
+
+	if !ok {
+		return nil
+	}
+
+	removeChirpEngagement(database, id)
+	removeChirpNotifications(database, id)
+	removeChirpVotes(database, id)
+	removeChirpBookmarks(database, id)
+	removed := removeChirpAttachments(database, chirp)
+
+	if hasReplies(database, id) {
+		database.Chirps[id] = Chirp{
+			Id:        id,
+			CreatedAt: chirp.CreatedAt,
+			InReplyTo: chirp.InReplyTo,
+			Deleted:   true,
+		}
+		return removed
+	}
+
+	delete(database.Chirps, id)
+
+	if chirp.InReplyTo != nil {
+		parent, ok := database.Chirps[*chirp.InReplyTo]
+
+		// Tombstones have no attachments left to collect
+		if ok && parent.Deleted && !hasReplies(database, parent.Id) {
+			removeChirp(database, parent.Id)
+		}
+	}
+
+	return removed
+}
+
+func hasReplies(database *DatabaseSchema, id int) bool {
+	for _, chirp := range database.Chirps {
+		if chirp.InReplyTo != nil && *chirp.InReplyTo == id {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,17 +5,102 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/password"
 )
 
 type Database struct {
-	path string
-	mux  *sync.RWMutex
+	path   string
+	mux    *sync.RWMutex
+	txMux  *sync.Mutex
+	hasher password.Hasher
+
+	chirpListeners      []ChirpListener
+	userListeners       []UserListener
+	attachmentListeners []AttachmentListener
+	chirpEvents         ChirpEventBuilder
+	chirpDeletedEvents  ChirpDeletedEventBuilder
+}
+
+// ChirpListener is told about chirps being posted, edited and deleted, once
+// the change has been written. Calls are made while the database is locked
+// for updates, so implementations must not block or call back into it.
+type ChirpListener interface {
+	ChirpCreated(chirp Chirp)
+	ChirpUpdated(chirp Chirp)
+	ChirpDeleted(chirp Chirp)
 }
 
 type DatabaseSchema struct {
-	Chirps        map[int]Chirp     `json:"chirps"`
-	Users         map[int]User      `json:"users"`
-	RevokedTokens map[string]string `json:"revoked_tokens"`
+	Chirps        map[int]Chirp           `json:"chirps"`
+	Users         map[int]User            `json:"users"`
+	RevokedTokens map[string]string       `json:"revoked_tokens"`
+	Sessions      map[int]Session         `json:"sessions"`
+	ApiKeys       map[int]ApiKey          `json:"api_keys"`
+	WebhookNonces map[string]time.Time    `json:"webhook_nonces"`
+	WebhookEvents map[string]WebhookEvent `json:"webhook_events"`
+	BillingEvents map[int]BillingEvent    `json:"billing_events"`
+
+	WebhookEndpoints  map[int]WebhookEndpoint `json:"webhook_endpoints"`
+	WebhookDeliveries map[int]WebhookDelivery `json:"webhook_deliveries"`
+
+	// Wrong codes given for login challenges, keyed by challenge token
+	ChallengeAttempts map[string]ChallengeAttempts `json:"challenge_attempts"`
+
+	Following map[int]map[int]time.Time `json:"following"`
+	Followers map[int]map[int]time.Time `json:"followers"`
+
+	// Keyed by chirp ID, then by the ID of the user who engaged
+	Likes    map[int]map[int]time.Time `json:"likes"`
+	Rechirps map[int]map[int]time.Time `json:"rechirps"`
+	Votes    map[int]map[int]Vote      `json:"votes"`
+
+	Notifications map[int]Notification `json:"notifications"`
+	Attachments   map[int]Attachment   `json:"attachments"`
+	Lists         map[int]UserList     `json:"lists"`
+
+	// Keyed by the ID of the user who saved the chirp, then by chirp ID
+	Bookmarks map[int]map[int]time.Time `json:"bookmarks"`
+
+	// Keyed by the ID of the user who blocked or muted, then by their target
+	Blocks map[int]map[int]time.Time `json:"blocks"`
+	Mutes  map[int]map[int]time.Time `json:"mutes"`
+
+	// Drafts and scheduled chirps are kept apart from Chirps, so nothing
+	// that reads chirps can show them before they're published
+	Unpublished map[int]Chirp `json:"unpublished"`
+
+	// The highest ID ever allocated in each table, see nextId
+	Sequences map[string]int `json:"sequences"`
+}
+
+// nextId allocates the ID for a new record in items, one more than the
+// highest ever allocated for table. That high-water mark is kept in the
+// schema, so deleting the newest record doesn't free its ID for the next
+// insert, and anything keyed or cached by ID can't be handed someone else's
+// record. Databases written before it was kept start from their highest key.
+func nextId[T any](database *DatabaseSchema, table string, items map[int]T) int {
+	id := max(database.Sequences[table], highestKey(items)) + 1
+
+	if database.Sequences == nil {
+		database.Sequences = make(map[string]int)
+	}
+
+	database.Sequences[table] = id
+	return id
+}
+
+func highestKey[T any](items map[int]T) int {
+	maxId := 0
+
+	for id := range items {
+		if id > maxId {
+			maxId = id
+		}
+	}
+
+	return maxId
 }
 
 func (db *Database) loadDatabase() (DatabaseSchema, error) {
@@ -46,6 +131,18 @@ func (db *Database) loadDatabase() (DatabaseSchema, error) {
 	return data, nil
 }
 
+// beginUpdate loads the database for a read-modify-write. Updates are
+// serialised until endUpdate, so two requests can't load the same state and
+// overwrite each other's changes. endUpdate must be called even on error.
+func (db *Database) beginUpdate() (DatabaseSchema, error) {
+	db.txMux.Lock()
+	return db.loadDatabase()
+}
+
+func (db *Database) endUpdate() {
+	db.txMux.Unlock()
+}
+
 func (db *Database) writeDatabase(data DatabaseSchema) error {
 	var rawData []byte
 
@@ -69,10 +166,67 @@ func (db *Database) writeDatabase(data DatabaseSchema) error {
 	return nil
 }
 
+// SetPasswordHasher changes the hasher used for new passwords. Existing
+// hashes are upgraded to it the next time their owner logs in.
+func (db *Database) SetPasswordHasher(hasher password.Hasher) {
+	db.hasher = hasher
+}
+
+// UserListener is told when a user is created, edited or deleted, under the
+// same rules as ChirpListener.
+type UserListener interface {
+	UserChanged(user User)
+	UserDeleted(id int)
+}
+
+// AddChirpListener registers a listener for chirp changes. Listeners must be
+// added before the server starts handling requests.
+func (db *Database) AddChirpListener(listener ChirpListener) {
+	db.chirpListeners = append(db.chirpListeners, listener)
+}
+
+func (db *Database) chirpCreated(chirp Chirp) {
+	for _, listener := range db.chirpListeners {
+		listener.ChirpCreated(chirp)
+	}
+}
+
+func (db *Database) chirpUpdated(chirp Chirp) {
+	for _, listener := range db.chirpListeners {
+		listener.ChirpUpdated(chirp)
+	}
+}
+
+func (db *Database) chirpDeleted(chirp Chirp) {
+	for _, listener := range db.chirpListeners {
+		listener.ChirpDeleted(chirp)
+	}
+}
+
+// AddUserListener registers a listener for user changes. Listeners must be
+// added before the server starts handling requests.
+func (db *Database) AddUserListener(listener UserListener) {
+	db.userListeners = append(db.userListeners, listener)
+}
+
+func (db *Database) userChanged(user User) {
+	for _, listener := range db.userListeners {
+		listener.UserChanged(user)
+	}
+}
+
+func (db *Database) userDeleted(id int) {
+	for _, listener := range db.userListeners {
+		listener.UserDeleted(id)
+	}
+}
+
 func NewDatabase(path string) (*Database, error) {
 	database := Database{
-		path: path,
-		mux:  &sync.RWMutex{},
+		path:   path,
+		mux:    &sync.RWMutex{},
+		txMux:  &sync.Mutex{},
+		hasher: password.DefaultArgon2id(),
 	}
 
 	// Attempt to create file-based DB
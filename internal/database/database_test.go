@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajpotts01/go-chirpy/internal/password"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "database.json"))
+
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+
+	// The cheapest hasher keeps tests that create users quick
+	hasher, err := password.NewBcrypt(4)
+
+	if err != nil {
+		t.Fatalf("NewBcrypt: %v", err)
+	}
+
+	db.SetPasswordHasher(hasher)
+	return db
+}
+
+// createTestUsers creates count users and returns their IDs in order.
+func createTestUsers(t *testing.T, db *Database, count int) []int {
+	t.Helper()
+
+	var ids []int
+
+	for i := 0; i < count; i++ {
+		user, err := db.CreateUser(fmt.Sprintf("user%d@example.com", len(ids)+1), "password")
+
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		ids = append(ids, user.Id)
+	}
+
+	return ids
+}
+
+func createTestChirp(t *testing.T, db *Database, authorId int, body string, options ChirpOptions) Chirp {
+	t.Helper()
+
+	chirp, err := db.CreateChirp(body, authorId, options)
+
+	if err != nil {
+		t.Fatalf("CreateChirp(%q): %v", body, err)
+	}
+
+	return chirp
+}
+
+func TestNextIdIsNotReusedAfterDelete(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+
+	createTestChirp(t, db, users[0], "first", ChirpOptions{})
+	second := createTestChirp(t, db, users[0], "second", ChirpOptions{})
+
+	err := db.DeleteSingleChirp(second.Id)
+
+	if err != nil {
+		t.Fatalf("DeleteSingleChirp: %v", err)
+	}
+
+	third := createTestChirp(t, db, users[0], "third", ChirpOptions{})
+
+	if third.Id == second.Id {
+		t.Fatalf("chirp ID %v was reused after the chirp was deleted", second.Id)
+	}
+
+	draft := createTestChirp(t, db, users[0], "draft", ChirpOptions{Status: ChirpDraft})
+
+	err = db.DeleteUnpublishedChirp(draft.Id)
+
+	if err != nil {
+		t.Fatalf("DeleteUnpublishedChirp: %v", err)
+	}
+
+	fourth := createTestChirp(t, db, users[0], "fourth", ChirpOptions{})
+
+	if fourth.Id <= draft.Id {
+		t.Fatalf("chirp ID %v was allocated after draft %v was deleted", fourth.Id, draft.Id)
+	}
+}
+
+func TestNextIdStartsFromExistingKeys(t *testing.T) {
+	// Databases written before sequences were kept have none
+	database := DatabaseSchema{Chirps: map[int]Chirp{1: {}, 7: {}}}
+
+	if id := nextId(&database, "chirps", database.Chirps); id != 8 {
+		t.Fatalf("nextId = %v, want 8", id)
+	}
+
+	delete(database.Chirps, 7)
+
+	if id := nextId(&database, "chirps", database.Chirps); id != 9 {
+		t.Fatalf("nextId after delete = %v, want 9", id)
+	}
+}
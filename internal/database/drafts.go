@@ -0,0 +1,303 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	ChirpDraft     = "draft"
+	ChirpScheduled = "scheduled"
+	ChirpPublished = "published"
+)
+
+var ErrInvalidStatus = errors.New("status must be draft, scheduled or published")
+var ErrPublishAtRequired = errors.New("scheduled chirps need a publish_at time")
+
+// UnpublishedUpdate changes a draft or scheduled chirp. Nil fields are left
+// unchanged. Setting Status to ChirpPublished publishes the chirp there and
+// then.
+type UnpublishedUpdate struct {
+	Body      *string
+	Status    *string
+	PublishAt *time.Time
+}
+
+// Published reports whether a chirp has gone out. Chirps from before
+// drafts existed have no status and are all published.
+func (chirp Chirp) Published() bool {
+	return chirp.Status == "" || chirp.Status == ChirpPublished
+}
+
+// nextChirpId allocates chirp IDs across published and unpublished chirps,
+// so a chirp keeps its ID when it's published.
+func nextChirpId(database *DatabaseSchema) int {
+	id := max(nextId(database, "chirps", database.Chirps), highestKey(database.Unpublished)+1)
+	database.Sequences["chirps"] = id
+	return id
+}
+
+// publishChirp moves a chirp into the public set and notifies anyone it
+// mentions or replies to. Everything that happens when a chirp goes out,
+// apart from the listeners called after writing, happens here. The parent
+// is checked again, since it may have been deleted, or its author may have
+// blocked this one, since the chirp was written, and so is the poll, which
+// may have expired.
+func publishChirp(database *DatabaseSchema, chirp Chirp, now time.Time) (Chirp, error) {
+	if chirp.Poll != nil && chirp.Poll.Closed(now) {
+		return Chirp{}, ErrPollClosed
+	}
+
+	if chirp.InReplyTo != nil {
+		parent, ok := database.Chirps[*chirp.InReplyTo]
+
+		if !ok || parent.Deleted {
+			return Chirp{}, ErrParentNotExist
+		}
+
+		if hasBlocked(database, parent.AuthorId, chirp.AuthorId) {
+			return Chirp{}, ErrBlocked
+		}
+	}
+
+	// Handles may have changed hands, or blocks been added, since a draft
+	// was written
+	chirp.Entities = parseEntities(database, chirp.Body, chirp.AuthorId)
+	chirp.Status = ChirpPublished
+	chirp.PublishAt = nil
+	chirp.CreatedAt = now
+
+	if database.Chirps == nil {
+		database.Chirps = make(map[int]Chirp)
+	}
+
+	delete(database.Unpublished, chirp.Id)
+	database.Chirps[chirp.Id] = chirp
+	notifyChirp(database, chirp, nil)
+
+	return chirp, nil
+}
+
+// ReadUnpublishedChirp returns a draft or scheduled chirp.
+func (db *Database) ReadUnpublishedChirp(id int) (Chirp, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirp, ok := database.Unpublished[id]
+
+	if !ok {
+		return Chirp{}, os.ErrNotExist
+	}
+
+	return chirp, nil
+}
+
+// ReadUnpublishedChirps returns a page of an author's drafts and scheduled
+// chirps, newest first. status narrows it to one or the other.
+func (db *Database) ReadUnpublishedChirps(authorId int, status string, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	var chirps []Chirp
+
+	for _, chirp := range database.Unpublished {
+		if chirp.AuthorId == authorId && (status == "" || chirp.Status == status) {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return paginate(chirps, cursor, limit, chirpCursor), nil
+}
+
+func (db *Database) UpdateUnpublishedChirp(id int, update UnpublishedUpdate) (Chirp, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	// Gone if the scheduler has already published it
+	chirp, ok := database.Unpublished[id]
+
+	if !ok {
+		return Chirp{}, os.ErrNotExist
+	}
+
+	if update.Body != nil {
+		chirp.Body = *update.Body
+		chirp.Entities = parseEntities(&database, chirp.Body, chirp.AuthorId)
+	}
+
+	if update.PublishAt != nil {
+		chirp.PublishAt = update.PublishAt
+	}
+
+	if update.Status != nil {
+		chirp.Status = *update.Status
+	}
+
+	switch chirp.Status {
+	case ChirpDraft:
+		chirp.PublishAt = nil
+	case ChirpScheduled:
+		if chirp.PublishAt == nil {
+			return Chirp{}, ErrPublishAtRequired
+		}
+	case ChirpPublished:
+		chirp, err = publishChirp(&database, chirp, time.Now().UTC())
+
+		if err != nil {
+			return Chirp{}, err
+		}
+
+		db.queueChirpEvent(&database, chirp)
+	default:
+		return Chirp{}, ErrInvalidStatus
+	}
+
+	log.Printf("Edit Unpublished Chirp:\n")
+	log.Printf("Id: %v\n", chirp.Id)
+	log.Printf("Status: %v\n", chirp.Status)
+
+	if chirp.Status != ChirpPublished {
+		database.Unpublished[id] = chirp
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return Chirp{}, err
+	}
+
+	if chirp.Status == ChirpPublished {
+		db.chirpCreated(chirp)
+	}
+
+	return chirp, nil
+}
+
+// DeleteUnpublishedChirp cancels a draft or scheduled chirp.
+func (db *Database) DeleteUnpublishedChirp(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	chirp, ok := database.Unpublished[id]
+
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	delete(database.Unpublished, id)
+	removedAttachments := removeChirpAttachments(&database, chirp)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	for _, attachment := range removedAttachments {
+		db.attachmentDeleted(attachment)
+	}
+
+	return nil
+}
+
+// PublishDueChirps publishes every scheduled chirp whose time has come, in
+// the order they were due, and returns them. Each is moved out of the
+// unpublished set, and its webhook event queued, in the same write that
+// publishes it, so a chirp can't go out twice, even if the server restarts
+// part way. A scheduled chirp that can no longer go out, because it replies
+// to a deleted chirp or someone who has since blocked its author, or its
+// poll has expired, goes back to being a draft.
+func (db *Database) PublishDueChirps(now time.Time) ([]Chirp, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Chirp
+
+	for _, chirp := range database.Unpublished {
+		if chirp.Status == ChirpScheduled && chirp.PublishAt != nil && !chirp.PublishAt.After(now) {
+			due = append(due, chirp)
+		}
+	}
+
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].PublishAt.Equal(*due[j].PublishAt) {
+			return due[i].Id < due[j].Id
+		}
+		return due[i].PublishAt.Before(*due[j].PublishAt)
+	})
+
+	var published []Chirp
+
+	for _, chirp := range due {
+		result, err := publishChirp(&database, chirp, now)
+
+		if err == ErrParentNotExist || err == ErrPollClosed || err == ErrBlocked {
+			log.Printf("Scheduled chirp %v can't be published (%v), moving it back to drafts\n", chirp.Id, err)
+			chirp.Status = ChirpDraft
+			chirp.PublishAt = nil
+			database.Unpublished[chirp.Id] = chirp
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		db.queueChirpEvent(&database, result)
+		published = append(published, result)
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return nil, err
+	}
+
+	for _, chirp := range published {
+		db.chirpCreated(chirp)
+	}
+
+	return published, nil
+}
+
+// removeUserUnpublished drops a deleted user's drafts and scheduled chirps,
+// returning their attachments.
+func removeUserUnpublished(database *DatabaseSchema, userId int) []Attachment {
+	var removed []Attachment
+
+	for id, chirp := range database.Unpublished {
+		if chirp.AuthorId == userId {
+			removed = append(removed, removeChirpAttachments(database, chirp)...)
+			delete(database.Unpublished, id)
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testChirpEvents queues each published chirp's ID and attachment count.
+func testChirpEvents(chirp Chirp, attachments map[int]Attachment) (OutboundEvent, error) {
+	count := 0
+
+	for _, id := range chirp.AttachmentIds {
+		if _, ok := attachments[id]; ok {
+			count += 1
+		}
+	}
+
+	payload := `{"id":` + strconv.Itoa(chirp.Id) + `,"attachments":` + strconv.Itoa(count) + `}`
+	return OutboundEvent{Event: "chirp.created", SubjectUserId: chirp.AuthorId, Public: true, Payload: []byte(payload)}, nil
+}
+
+func TestPublishDueChirps(t *testing.T) {
+	db := newTestDatabase(t)
+	db.SetChirpEventBuilder(testChirpEvents)
+	users := createTestUsers(t, db, 2)
+	parent := createTestChirp(t, db, users[1], "parent", ChirpOptions{})
+
+	endpoint, err := db.CreateWebhookEndpoint(AdminOwnerId, "https://example.com/hook", "secret", []string{"chirp.created"})
+
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %v", err)
+	}
+
+	attachment, err := db.CreateAttachment(Attachment{OwnerId: users[0], ContentType: "image/png"})
+
+	if err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+
+	now := time.Now().UTC()
+	earlier, later := now.Add(-2*time.Minute), now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	second := createTestChirp(t, db, users[0], "second", ChirpOptions{Status: ChirpScheduled, PublishAt: &later})
+	first := createTestChirp(t, db, users[0], "first", ChirpOptions{Status: ChirpScheduled, PublishAt: &earlier, AttachmentIds: []int{attachment.Id}})
+	notYet := createTestChirp(t, db, users[0], "not yet", ChirpOptions{Status: ChirpScheduled, PublishAt: &future})
+	orphan := createTestChirp(t, db, users[0], "orphan", ChirpOptions{Status: ChirpScheduled, PublishAt: &earlier, InReplyTo: &parent.Id})
+
+	err = db.DeleteSingleChirp(parent.Id)
+
+	if err != nil {
+		t.Fatalf("DeleteSingleChirp: %v", err)
+	}
+
+	published, err := db.PublishDueChirps(now)
+
+	if err != nil {
+		t.Fatalf("PublishDueChirps: %v", err)
+	}
+
+	if len(published) != 2 || published[0].Id != first.Id || published[1].Id != second.Id {
+		t.Fatalf("published %v, want chirps %v and %v in the order they were due", published, first.Id, second.Id)
+	}
+
+	for _, chirp := range published {
+		if chirp.Status != ChirpPublished || chirp.PublishAt != nil || !chirp.CreatedAt.Equal(now) {
+			t.Errorf("published chirp %v = %+v", chirp.Id, chirp)
+		}
+	}
+
+	deliveries, err := db.ReadWebhookDeliveries(endpoint.Id)
+
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("ReadWebhookDeliveries = %v, %v, want one per published chirp", deliveries, err)
+	}
+
+	payloads := map[string]bool{}
+
+	for _, delivery := range deliveries {
+		payloads[string(delivery.Payload)] = true
+	}
+
+	want := []string{
+		`{"id":` + strconv.Itoa(first.Id) + `,"attachments":1}`,
+		`{"id":` + strconv.Itoa(second.Id) + `,"attachments":0}`,
+	}
+
+	for _, payload := range want {
+		if !payloads[payload] {
+			t.Errorf("no delivery of %v in %v", payload, payloads)
+		}
+	}
+
+	// A scheduled reply to a deleted chirp goes back to drafts
+	draft, err := db.ReadUnpublishedChirp(orphan.Id)
+
+	if err != nil || draft.Status != ChirpDraft || draft.PublishAt != nil {
+		t.Fatalf("orphaned reply = %+v, %v, want a draft", draft, err)
+	}
+
+	_, err = db.ReadUnpublishedChirp(notYet.Id)
+
+	if err != nil {
+		t.Fatalf("chirp that isn't due yet: %v", err)
+	}
+
+	// Nothing goes out twice
+	published, err = db.PublishDueChirps(now.Add(time.Minute))
+
+	if err != nil || len(published) != 0 {
+		t.Fatalf("second PublishDueChirps = %v, %v, want nothing", published, err)
+	}
+
+	deliveries, err = db.ReadWebhookDeliveries(endpoint.Id)
+
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("ReadWebhookDeliveries after a second run = %v, %v", len(deliveries), err)
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// ChirpStats are the engagement counters for a chirp. The ByViewer flags are
+// only meaningful when stats were read for a signed-in viewer.
+type ChirpStats struct {
+	LikeCount          int
+	RechirpCount       int
+	ReplyCount         int
+	LikedByViewer      bool
+	RechirpedByViewer  bool
+	BookmarkedByViewer bool
+}
+
+type engagementKind int
+
+const (
+	engagementLike engagementKind = iota
+	engagementRechirp
+)
+
+// Like records that userId likes a chirp. Liking a chirp twice is a no-op.
+func (db *Database) Like(userId int, chirpId int) error {
+	return db.setEngagement(engagementLike, userId, chirpId, true)
+}
+
+func (db *Database) Unlike(userId int, chirpId int) error {
+	return db.setEngagement(engagementLike, userId, chirpId, false)
+}
+
+// Rechirp records that userId has shared a chirp. Rechirping twice is a no-op.
+func (db *Database) Rechirp(userId int, chirpId int) error {
+	return db.setEngagement(engagementRechirp, userId, chirpId, true)
+}
+
+func (db *Database) Unrechirp(userId int, chirpId int) error {
+	return db.setEngagement(engagementRechirp, userId, chirpId, false)
+}
+
+// engagements returns the likes or rechirps map, creating it if needed.
+func (database *DatabaseSchema) engagements(kind engagementKind) map[int]map[int]time.Time {
+	if kind == engagementRechirp {
+		if database.Rechirps == nil {
+			database.Rechirps = make(map[int]map[int]time.Time)
+		}
+		return database.Rechirps
+	}
+
+	if database.Likes == nil {
+		database.Likes = make(map[int]map[int]time.Time)
+	}
+	return database.Likes
+}
+
+// setEngagement adds or removes userId from a chirp's likes or rechirps.
+// Counters are derived from these sets rather than stored separately, so
+// they can't drift from them.
+func (db *Database) setEngagement(kind engagementKind, userId int, chirpId int, engaged bool) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	chirp, ok := database.Chirps[chirpId]
+
+	// Chirps by hidden authors can't be seen, so they can't be engaged with
+	if !ok || chirp.Deleted || hiddenAuthors(&database, userId)[chirp.AuthorId] {
+		return os.ErrNotExist
+	}
+
+	edges := database.engagements(kind)
+	_, already := edges[chirpId][userId]
+
+	if already == engaged {
+		return nil
+	}
+
+	if engaged {
+		if edges[chirpId] == nil {
+			edges[chirpId] = make(map[int]time.Time)
+		}
+
+		edges[chirpId][userId] = time.Now().UTC()
+
+		if kind == engagementLike {
+			notify(&database, Notification{
+				UserId:  chirp.AuthorId,
+				Type:    NotificationLike,
+				ActorId: userId,
+				ChirpId: &chirpId,
+			})
+		}
+	} else {
+		delete(edges[chirpId], userId)
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadChirpStats returns counters for each chirp in a single load. Pass a
+// viewerId of 0 for anonymous readers.
+func (db *Database) ReadChirpStats(chirpIds []int, viewerId int) (map[int]ChirpStats, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]ChirpStats)
+	replies := make(map[int]int)
+
+	// Tombstones don't count as replies
+	for _, chirp := range database.Chirps {
+		if chirp.InReplyTo != nil && !chirp.Deleted {
+			replies[*chirp.InReplyTo]++
+		}
+	}
+
+	for _, id := range chirpIds {
+		_, liked := database.Likes[id][viewerId]
+		_, rechirped := database.Rechirps[id][viewerId]
+		_, bookmarked := database.Bookmarks[viewerId][id]
+
+		stats[id] = ChirpStats{
+			LikeCount:          len(database.Likes[id]),
+			RechirpCount:       len(database.Rechirps[id]),
+			ReplyCount:         replies[id],
+			LikedByViewer:      viewerId != 0 && liked,
+			RechirpedByViewer:  viewerId != 0 && rechirped,
+			BookmarkedByViewer: viewerId != 0 && bookmarked,
+		}
+	}
+
+	return stats, nil
+}
+
+// ReadLikedChirps returns a page of chirps a user has liked, most recently
+// liked first.
+func (db *Database) ReadLikedChirps(userId int, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	// Chirps page by when they were liked, not when they were posted
+	likedAt := make(map[int]time.Time)
+	var chirps []Chirp
+
+	for chirpId, likers := range database.Likes {
+		chirp, ok := database.Chirps[chirpId]
+
+		if at, liked := likers[userId]; liked && ok && !chirp.Deleted {
+			likedAt[chirpId] = at
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return paginate(chirps, cursor, limit, func(chirp Chirp) Cursor {
+		return Cursor{Time: likedAt[chirp.Id], Id: chirp.Id}
+	}), nil
+}
+
+// removeChirpEngagement drops the likes and rechirps of a deleted chirp.
+func removeChirpEngagement(database *DatabaseSchema, chirpId int) {
+	delete(database.Likes, chirpId)
+	delete(database.Rechirps, chirpId)
+}
+
+// removeUserEngagement drops a deleted user's likes and rechirps so they no
+// longer count towards anyone's chirps.
+func removeUserEngagement(database *DatabaseSchema, userId int) {
+	for _, likers := range database.Likes {
+		delete(likers, userId)
+	}
+
+	for _, rechirpers := range database.Rechirps {
+		delete(rechirpers, userId)
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"os"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+)
+
+// findUserByHandle looks a user up by handle, ignoring case. Deleted users
+// and the empty handle never match.
+func findUserByHandle(database *DatabaseSchema, handle string) (User, bool) {
+	if handle == "" {
+		return User{}, false
+	}
+
+	normalised := entities.NormaliseHandle(handle)
+
+	for _, user := range database.Users {
+		if !user.Deleted && entities.NormaliseHandle(user.Handle) == normalised {
+			return user, true
+		}
+	}
+
+	return User{}, false
+}
+
+// ReadUserByHandle looks a user up by handle, ignoring case.
+func (db *Database) ReadUserByHandle(handle string) (User, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := findUserByHandle(&database, handle)
+
+	if !ok {
+		return User{}, os.ErrNotExist
+	}
+
+	return user, nil
+}
+
+// parseEntities extracts the entities from a chirp body and resolves its
+// mentions against the users in the loaded schema. Mentions of handles
+// nobody has are dropped, as are mentions of users who have blocked the
+// author.
+func parseEntities(database *DatabaseSchema, body string, authorId int) []entities.Entity {
+	var resolved []entities.Entity
+
+	for _, entity := range entities.Parse(body) {
+		if entity.Type == entities.TypeMention {
+			user, ok := findUserByHandle(database, entity.Handle)
+
+			if !ok || hasBlocked(database, user.Id, authorId) {
+				continue
+			}
+
+			entity.UserId = user.Id
+		}
+
+		resolved = append(resolved, entity)
+	}
+
+	return resolved
+}
+
+// ReadChirpsByHashtag returns a page of chirps tagged with tag, newest first.
+func (db *Database) ReadChirpsByHashtag(tag string, cursor *Cursor, limit int) (Page[Chirp], error) {
+	normalised := entities.NormaliseTag(tag)
+
+	return db.readChirpsWithEntity(func(entity entities.Entity) bool {
+		return entity.Type == entities.TypeHashtag && entity.Tag == normalised
+	}, cursor, limit)
+}
+
+// ReadMentions returns a page of chirps that mention a user, newest first.
+func (db *Database) ReadMentions(userId int, cursor *Cursor, limit int) (Page[Chirp], error) {
+	return db.readChirpsWithEntity(func(entity entities.Entity) bool {
+		return entity.Type == entities.TypeMention && entity.UserId == userId
+	}, cursor, limit)
+}
+
+func (db *Database) readChirpsWithEntity(match func(entities.Entity) bool, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	var chirps []Chirp
+
+	for _, chirp := range database.Chirps {
+		for _, entity := range chirp.Entities {
+			if match(entity) {
+				chirps = append(chirps, chirp)
+				break
+			}
+		}
+	}
+
+	return paginate(chirps, cursor, limit, chirpCursor), nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+)
+
+func TestMentionResolution(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 3)
+
+	for i, handle := range []string{"Alice", "bob"} {
+		handle := handle
+
+		if _, err := db.UpdateProfile(users[i], ProfileUpdate{Handle: &handle}); err != nil {
+			t.Fatalf("UpdateProfile: %v", err)
+		}
+	}
+
+	if err := db.DeleteUser(users[1], DeletionPolicyAnonymize); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	chirp := createTestChirp(t, db, users[2], "ünïcode @ALICE, @bob and @nobody #Go", ChirpOptions{})
+
+	var mentions []entities.Entity
+	var tags []entities.Entity
+
+	for _, entity := range chirp.Entities {
+		switch entity.Type {
+		case entities.TypeMention:
+			mentions = append(mentions, entity)
+		case entities.TypeHashtag:
+			tags = append(tags, entity)
+		}
+	}
+
+	// Deleted users and unknown handles are dropped
+	if len(mentions) != 1 || mentions[0].UserId != users[0] || mentions[0].Start != 8 || mentions[0].End != 14 {
+		t.Fatalf("mentions = %+v, want only @ALICE at 8-14, resolved to user %v", mentions, users[0])
+	}
+
+	if len(tags) != 1 || tags[0].Tag != "go" {
+		t.Fatalf("hashtags = %+v, want #go", tags)
+	}
+
+	page, err := db.ReadMentions(users[0], nil, 10)
+
+	if err != nil || len(page.Items) != 1 || page.Items[0].Id != chirp.Id {
+		t.Fatalf("ReadMentions = %+v, %v, want chirp %v", page.Items, err, chirp.Id)
+	}
+
+	page, err = db.ReadChirpsByHashtag("#GO", nil, 10)
+
+	if err != nil || len(page.Items) != 1 || page.Items[0].Id != chirp.Id {
+		t.Fatalf("ReadChirpsByHashtag = %+v, %v, want chirp %v", page.Items, err, chirp.Id)
+	}
+}
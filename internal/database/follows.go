@@ -0,0 +1,231 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+var ErrSelfFollow = errors.New("users cannot follow themselves")
+
+type FollowCount struct {
+	Followers int `json:"follower_count"`
+	Following int `json:"following_count"`
+}
+
+// Follow makes followerId follow followeeId. Following someone twice is a
+// no-op, and a block either way stops it.
+func (db *Database) Follow(followerId int, followeeId int) error {
+	if followerId == followeeId {
+		return ErrSelfFollow
+	}
+
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	followee, ok := database.Users[followeeId]
+
+	if !ok || followee.Deleted {
+		return os.ErrNotExist
+	}
+
+	if hasBlocked(&database, followeeId, followerId) || hasBlocked(&database, followerId, followeeId) {
+		return ErrBlocked
+	}
+
+	// Both directions are stored so either lookup is a single map access
+	if database.Following == nil {
+		database.Following = make(map[int]map[int]time.Time)
+	}
+
+	if database.Followers == nil {
+		database.Followers = make(map[int]map[int]time.Time)
+	}
+
+	if database.Following[followerId] == nil {
+		database.Following[followerId] = make(map[int]time.Time)
+	}
+
+	if database.Followers[followeeId] == nil {
+		database.Followers[followeeId] = make(map[int]time.Time)
+	}
+
+	if _, ok := database.Following[followerId][followeeId]; ok {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	database.Following[followerId][followeeId] = now
+	database.Followers[followeeId][followerId] = now
+
+	notify(&database, Notification{
+		UserId:  followeeId,
+		Type:    NotificationFollow,
+		ActorId: followerId,
+	})
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (db *Database) Unfollow(followerId int, followeeId int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := database.Following[followerId][followeeId]; !ok {
+		return nil
+	}
+
+	removeFollow(&database, followerId, followeeId)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadFollowers returns the IDs of a user's followers, most recent first.
+func (db *Database) ReadFollowers(userId int) ([]int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idsBySince(database.Followers[userId]), nil
+}
+
+// ReadFollowing returns the IDs of users someone follows, most recent first.
+func (db *Database) ReadFollowing(userId int) ([]int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idsBySince(database.Following[userId]), nil
+}
+
+func (db *Database) ReadFollowCounts(userIds []int) (map[int]FollowCount, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]FollowCount)
+
+	for _, id := range userIds {
+		counts[id] = FollowCount{
+			Followers: len(database.Followers[id]),
+			Following: len(database.Following[id]),
+		}
+	}
+
+	return counts, nil
+}
+
+// ReadUsers returns the users with the given IDs, in the same order.
+// Missing and deleted users are skipped.
+func (db *Database) ReadUsers(ids []int) ([]User, error) {
+	var users []User
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return users, err
+	}
+
+	for _, id := range ids {
+		if user, ok := database.Users[id]; ok && !user.Deleted {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// ReadTimeline returns a page of chirps by the user and the people they
+// follow, newest first. Muted users are left out even if they're followed.
+func (db *Database) ReadTimeline(userId int, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	following := database.Following[userId]
+	hidden := hiddenAuthors(&database, userId)
+	var chirps []Chirp
+
+	for _, chirp := range database.Chirps {
+		if chirp.Deleted || hidden[chirp.AuthorId] {
+			continue
+		}
+
+		if _, ok := following[chirp.AuthorId]; ok || chirp.AuthorId == userId {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return paginate(chirps, cursor, limit, chirpCursor), nil
+}
+
+func chirpCursor(chirp Chirp) Cursor {
+	return Cursor{Time: chirp.CreatedAt, Id: chirp.Id}
+}
+
+func idsBySince(edges map[int]time.Time) []int {
+	ids := []int{}
+
+	for id := range edges {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if edges[ids[i]].Equal(edges[ids[j]]) {
+			return ids[i] > ids[j]
+		}
+		return edges[ids[i]].After(edges[ids[j]])
+	})
+
+	return ids
+}
+
+func removeFollow(database *DatabaseSchema, followerId int, followeeId int) {
+	delete(database.Following[followerId], followeeId)
+	delete(database.Followers[followeeId], followerId)
+}
+
+// removeUserFollows drops every follow to or from a user. It only modifies
+// the loaded schema; callers are responsible for writing it.
+func removeUserFollows(database *DatabaseSchema, userId int) {
+	for followeeId := range database.Following[userId] {
+		delete(database.Followers[followeeId], userId)
+	}
+
+	for followerId := range database.Followers[userId] {
+		delete(database.Following[followerId], userId)
+	}
+
+	delete(database.Following, userId)
+	delete(database.Followers, userId)
+}
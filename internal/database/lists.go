@@ -0,0 +1,283 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+const MaxListsPerUser = 100
+const MaxListMembers = 500
+
+var ErrTooManyLists = fmt.Errorf("users can have at most %v lists", MaxListsPerUser)
+var ErrListFull = fmt.Errorf("lists can have at most %v members", MaxListMembers)
+var ErrMemberNotExist = errors.New("user does not exist")
+
+// UserList is a named set of accounts curated by its owner. Private lists
+// are only visible to the owner. Members aren't told they've been added.
+type UserList struct {
+	Id          int               `json:"id"`
+	OwnerId     int               `json:"owner_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Private     bool              `json:"private"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Members     map[int]time.Time `json:"members"`
+}
+
+// ListUpdate holds the editable list fields. Nil fields are left unchanged.
+type ListUpdate struct {
+	Name        *string
+	Description *string
+	Private     *bool
+}
+
+// VisibleTo reports whether viewerId, which is 0 for anonymous readers,
+// can see the list.
+func (list UserList) VisibleTo(viewerId int) bool {
+	return !list.Private || (viewerId != 0 && list.OwnerId == viewerId)
+}
+
+func (db *Database) CreateList(ownerId int, name string, description string, private bool) (UserList, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return UserList{}, err
+	}
+
+	owned := 0
+
+	for _, list := range database.Lists {
+		if list.OwnerId == ownerId {
+			owned++
+		}
+	}
+
+	if owned >= MaxListsPerUser {
+		return UserList{}, ErrTooManyLists
+	}
+
+	if database.Lists == nil {
+		database.Lists = make(map[int]UserList)
+	}
+
+	list := UserList{
+		Id:          nextId(&database, "lists", database.Lists),
+		OwnerId:     ownerId,
+		Name:        name,
+		Description: description,
+		Private:     private,
+		CreatedAt:   time.Now().UTC(),
+		Members:     make(map[int]time.Time),
+	}
+
+	database.Lists[list.Id] = list
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return UserList{}, err
+	}
+
+	return list, nil
+}
+
+func (db *Database) ReadList(id int) (UserList, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return UserList{}, err
+	}
+
+	list, ok := database.Lists[id]
+
+	if !ok {
+		return UserList{}, os.ErrNotExist
+	}
+
+	return list, nil
+}
+
+// ReadUserLists returns the lists a user owns that viewerId can see, by ID.
+func (db *Database) ReadUserLists(ownerId int, viewerId int) ([]UserList, error) {
+	lists := []UserList{}
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return lists, err
+	}
+
+	for _, list := range database.Lists {
+		if list.OwnerId == ownerId && list.VisibleTo(viewerId) {
+			lists = append(lists, list)
+		}
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Id < lists[j].Id })
+	return lists, nil
+}
+
+func (db *Database) UpdateList(id int, update ListUpdate) (UserList, error) {
+	return db.updateList(id, func(database *DatabaseSchema, list *UserList) error {
+		if update.Name != nil {
+			list.Name = *update.Name
+		}
+
+		if update.Description != nil {
+			list.Description = *update.Description
+		}
+
+		if update.Private != nil {
+			list.Private = *update.Private
+		}
+
+		return nil
+	})
+}
+
+// AddListMember adds a user to a list. Adding someone twice is a no-op.
+func (db *Database) AddListMember(id int, userId int) (UserList, error) {
+	return db.updateList(id, func(database *DatabaseSchema, list *UserList) error {
+		if _, ok := list.Members[userId]; ok {
+			return nil
+		}
+
+		if user, ok := database.Users[userId]; !ok || user.Deleted {
+			return ErrMemberNotExist
+		}
+
+		if len(list.Members) >= MaxListMembers {
+			return ErrListFull
+		}
+
+		if list.Members == nil {
+			list.Members = make(map[int]time.Time)
+		}
+
+		list.Members[userId] = time.Now().UTC()
+		return nil
+	})
+}
+
+func (db *Database) RemoveListMember(id int, userId int) (UserList, error) {
+	return db.updateList(id, func(database *DatabaseSchema, list *UserList) error {
+		delete(list.Members, userId)
+		return nil
+	})
+}
+
+// updateList loads a list, applies change to it and writes it back.
+func (db *Database) updateList(id int, change func(database *DatabaseSchema, list *UserList) error) (UserList, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return UserList{}, err
+	}
+
+	list, ok := database.Lists[id]
+
+	if !ok {
+		return UserList{}, os.ErrNotExist
+	}
+
+	err = change(&database, &list)
+
+	if err != nil {
+		return UserList{}, err
+	}
+
+	database.Lists[id] = list
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return UserList{}, err
+	}
+
+	return list, nil
+}
+
+func (db *Database) DeleteList(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := database.Lists[id]; !ok {
+		return os.ErrNotExist
+	}
+
+	delete(database.Lists, id)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadListMembers returns the IDs of a list's members, most recently added
+// first.
+func (db *Database) ReadListMembers(id int) ([]int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := database.Lists[id]
+
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return idsBySince(list.Members), nil
+}
+
+// ReadListTimeline returns a page of chirps by a list's members, newest
+// first, like the home timeline.
+func (db *Database) ReadListTimeline(id int, cursor *Cursor, limit int) (Page[Chirp], error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Chirp]{}, err
+	}
+
+	list, ok := database.Lists[id]
+
+	if !ok {
+		return Page[Chirp]{}, os.ErrNotExist
+	}
+
+	var chirps []Chirp
+
+	for _, chirp := range database.Chirps {
+		if _, ok := list.Members[chirp.AuthorId]; ok && !chirp.Deleted {
+			chirps = append(chirps, chirp)
+		}
+	}
+
+	return paginate(chirps, cursor, limit, chirpCursor), nil
+}
+
+// removeUserLists deletes a user's lists and takes them off everyone
+// else's.
+func removeUserLists(database *DatabaseSchema, userId int) {
+	for id, list := range database.Lists {
+		if list.OwnerId == userId {
+			delete(database.Lists, id)
+			continue
+		}
+
+		delete(list.Members, userId)
+	}
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+)
+
+const (
+	NotificationMention = "mention"
+	NotificationReply   = "reply"
+	NotificationLike    = "like"
+	NotificationFollow  = "follow"
+)
+
+// NotificationTypes lists every type a user can turn on or off.
+var NotificationTypes = []string{
+	NotificationMention,
+	NotificationReply,
+	NotificationLike,
+	NotificationFollow,
+}
+
+// Notification tells UserId that ActorId interacted with them. ChirpId is
+// the chirp involved, if any: the mention or reply itself, or the chirp that
+// was liked.
+type Notification struct {
+	Id        int        `json:"id"`
+	UserId    int        `json:"user_id"`
+	Type      string     `json:"type"`
+	ActorId   int        `json:"actor_id"`
+	ChirpId   *int       `json:"chirp_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// NotificationPreferences maps a notification type to whether it is
+// produced. Types that aren't present are on.
+type NotificationPreferences map[string]bool
+
+func (preferences NotificationPreferences) Enabled(notificationType string) bool {
+	enabled, ok := preferences[notificationType]
+	return !ok || enabled
+}
+
+// ReadNotifications returns a page of a user's notifications, newest first,
+// along with how many are unread in total. Ones from before the user
+// blocked or muted the actor are left out of both.
+func (db *Database) ReadNotifications(userId int, unreadOnly bool, cursor *Cursor, limit int) (Page[Notification], int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return Page[Notification]{}, 0, err
+	}
+
+	var notifications []Notification
+	unread := 0
+
+	for _, notification := range database.Notifications {
+		if notification.UserId != userId || hasSilenced(&database, userId, notification.ActorId) {
+			continue
+		}
+
+		if notification.ReadAt == nil {
+			unread++
+		} else if unreadOnly {
+			continue
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	page := paginate(notifications, cursor, limit, func(notification Notification) Cursor {
+		return Cursor{Time: notification.CreatedAt, Id: notification.Id}
+	})
+
+	return page, unread, nil
+}
+
+// MarkNotificationRead marks one of a user's notifications as read. Other
+// users' notifications are reported as not existing.
+func (db *Database) MarkNotificationRead(userId int, id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	notification, ok := database.Notifications[id]
+
+	if !ok || notification.UserId != userId {
+		return os.ErrNotExist
+	}
+
+	if notification.ReadAt != nil {
+		return nil
+	}
+
+	readAt := time.Now().UTC()
+	notification.ReadAt = &readAt
+	database.Notifications[id] = notification
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification for a user as
+// read and returns how many there were.
+func (db *Database) MarkAllNotificationsRead(userId int) (int, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return 0, err
+	}
+
+	readAt := time.Now().UTC()
+	marked := 0
+
+	for id, notification := range database.Notifications {
+		if notification.UserId == userId && notification.ReadAt == nil {
+			notification.ReadAt = &readAt
+			database.Notifications[id] = notification
+			marked++
+		}
+	}
+
+	if marked == 0 {
+		return 0, nil
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return 0, err
+	}
+
+	return marked, nil
+}
+
+func (db *Database) ReadNotificationPreferences(userId int) (NotificationPreferences, error) {
+	user, err := db.ReadUser(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user.NotificationPreferences, nil
+}
+
+// UpdateNotificationPreferences merges changes into a user's preferences.
+// Types not mentioned in changes keep their current setting.
+func (db *Database) UpdateNotificationPreferences(userId int, changes NotificationPreferences) (NotificationPreferences, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := database.Users[userId]
+
+	if !ok || user.Deleted {
+		return nil, os.ErrNotExist
+	}
+
+	if user.NotificationPreferences == nil {
+		user.NotificationPreferences = make(NotificationPreferences)
+	}
+
+	for notificationType, enabled := range changes {
+		user.NotificationPreferences[notificationType] = enabled
+	}
+
+	database.Users[userId] = user
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return nil, err
+	}
+
+	return user.NotificationPreferences, nil
+}
+
+// notify adds a notification to the loaded schema, unless it's about the
+// recipient's own action, they've turned the type off, they've blocked or
+// muted the actor, or an identical one is still unread (so liking,
+// unliking and liking again doesn't pile up).
+func notify(database *DatabaseSchema, notification Notification) {
+	if notification.UserId == notification.ActorId || hasSilenced(database, notification.UserId, notification.ActorId) {
+		return
+	}
+
+	recipient, ok := database.Users[notification.UserId]
+
+	if !ok || recipient.Deleted || !recipient.NotificationPreferences.Enabled(notification.Type) {
+		return
+	}
+
+	for _, existing := range database.Notifications {
+		if existing.ReadAt == nil && existing.UserId == notification.UserId &&
+			existing.Type == notification.Type && existing.ActorId == notification.ActorId &&
+			sameChirp(existing.ChirpId, notification.ChirpId) {
+			return
+		}
+	}
+
+	if database.Notifications == nil {
+		database.Notifications = make(map[int]Notification)
+	}
+
+	notification.Id = nextId(database, "notifications", database.Notifications)
+	notification.CreatedAt = time.Now().UTC()
+	database.Notifications[notification.Id] = notification
+}
+
+// notifyChirp notifies the author of the chirp being replied to, and anyone
+// newly mentioned. previous is the chirp before an edit, or nil for a new
+// chirp; users it mentioned have already been told. A reply that also
+// mentions its parent's author only produces the reply notification.
+func notifyChirp(database *DatabaseSchema, chirp Chirp, previous *Chirp) {
+	notified := make(map[int]bool)
+
+	if previous != nil {
+		for _, entity := range previous.Entities {
+			if entity.Type == entities.TypeMention {
+				notified[entity.UserId] = true
+			}
+		}
+	}
+
+	chirpId := chirp.Id
+
+	if chirp.InReplyTo != nil && previous == nil {
+		parent := database.Chirps[*chirp.InReplyTo]
+		notify(database, Notification{
+			UserId:  parent.AuthorId,
+			Type:    NotificationReply,
+			ActorId: chirp.AuthorId,
+			ChirpId: &chirpId,
+		})
+		notified[parent.AuthorId] = true
+	}
+
+	for _, entity := range chirp.Entities {
+		if entity.Type != entities.TypeMention || notified[entity.UserId] {
+			continue
+		}
+
+		notify(database, Notification{
+			UserId:  entity.UserId,
+			Type:    NotificationMention,
+			ActorId: chirp.AuthorId,
+			ChirpId: &chirpId,
+		})
+		notified[entity.UserId] = true
+	}
+}
+
+// removeChirpNotifications drops notifications about a deleted chirp.
+func removeChirpNotifications(database *DatabaseSchema, chirpId int) {
+	for id, notification := range database.Notifications {
+		if notification.ChirpId != nil && *notification.ChirpId == chirpId {
+			delete(database.Notifications, id)
+		}
+	}
+}
+
+// removeUserNotifications drops notifications for or caused by a deleted
+// user.
+func removeUserNotifications(database *DatabaseSchema, userId int) {
+	for id, notification := range database.Notifications {
+		if notification.UserId == userId || notification.ActorId == userId {
+			delete(database.Notifications, id)
+		}
+	}
+}
+
+func sameChirp(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,442 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// AdminOwnerId owns webhook endpoints registered by admins rather than users
+const AdminOwnerId = 0
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookEndpoint struct {
+	Id        int       `json:"id"`
+	OwnerId   int       `json:"owner_id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (endpoint WebhookEndpoint) SubscribedTo(event string) bool {
+	for _, subscribed := range endpoint.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+type WebhookDelivery struct {
+	Id             int             `json:"id"`
+	EndpointId     int             `json:"endpoint_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	RedeliveryOf   int             `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// OutboundEvent is an event to send to every endpoint subscribed to it.
+type OutboundEvent struct {
+	Event         string
+	SubjectUserId int
+	Public        bool
+	Payload       []byte
+}
+
+// ChirpEventBuilder builds the event for a chirp as it's published. It's
+// called in the middle of a write, so it's given the attachments instead of
+// reading them, and must not call back into the database.
+type ChirpEventBuilder func(chirp Chirp, attachments map[int]Attachment) (OutboundEvent, error)
+
+// ChirpDeletedEventBuilder builds the event for a chirp removed along with
+// its author. Like ChirpEventBuilder, it's called in the middle of a write.
+type ChirpDeletedEventBuilder func(chirp Chirp) (OutboundEvent, error)
+
+// DeliveryAttempt is the result of trying to send a delivery. A zero
+// NextAttemptAt on a failed attempt means no more retries.
+type DeliveryAttempt struct {
+	Succeeded     bool
+	StatusCode    int
+	Error         string
+	NextAttemptAt time.Time
+}
+
+func (db *Database) CreateWebhookEndpoint(ownerId int, url string, secret string, events []string) (WebhookEndpoint, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	if database.WebhookEndpoints == nil {
+		database.WebhookEndpoints = make(map[int]WebhookEndpoint)
+	}
+
+	endpoint := WebhookEndpoint{
+		Id:        nextId(&database, "webhook_endpoints", database.WebhookEndpoints),
+		OwnerId:   ownerId,
+		Url:       url,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	log.Printf("New webhook endpoint:\n")
+	log.Printf("Id: %v\n", endpoint.Id)
+	log.Printf("Owner Id: %v\n", endpoint.OwnerId)
+	log.Printf("Url: %v\n", endpoint.Url)
+
+	database.WebhookEndpoints[endpoint.Id] = endpoint
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return WebhookEndpoint{}, err
+	}
+
+	return endpoint, nil
+}
+
+func (db *Database) ReadWebhookEndpoints(ownerId int) ([]WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return endpoints, err
+	}
+
+	for _, endpoint := range database.WebhookEndpoints {
+		if endpoint.OwnerId == ownerId {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Id < endpoints[j].Id })
+	return endpoints, nil
+}
+
+func (db *Database) ReadWebhookEndpoint(id int) (WebhookEndpoint, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	endpoint, ok := database.WebhookEndpoints[id]
+
+	if !ok {
+		return WebhookEndpoint{}, os.ErrNotExist
+	}
+
+	return endpoint, nil
+}
+
+// DeleteWebhookEndpoint removes an endpoint along with its delivery log.
+func (db *Database) DeleteWebhookEndpoint(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := database.WebhookEndpoints[id]; !ok {
+		return os.ErrNotExist
+	}
+
+	delete(database.WebhookEndpoints, id)
+
+	for deliveryId, delivery := range database.WebhookDeliveries {
+		if delivery.EndpointId == id {
+			delete(database.WebhookDeliveries, deliveryId)
+		}
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// EnqueueWebhookEvent queues a delivery of payload to every endpoint
+// subscribed to event. Admin endpoints see every event; user endpoints see
+// public events and private events about their owner.
+func (db *Database) EnqueueWebhookEvent(event string, subjectUserId int, public bool, payload []byte) (int, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return 0, err
+	}
+
+	queued := queueWebhookEvent(&database, OutboundEvent{
+		Event:         event,
+		SubjectUserId: subjectUserId,
+		Public:        public,
+		Payload:       payload,
+	})
+
+	if queued == 0 {
+		return 0, nil
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return 0, err
+	}
+
+	return queued, nil
+}
+
+func queueWebhookEvent(database *DatabaseSchema, event OutboundEvent) int {
+	if database.WebhookDeliveries == nil {
+		database.WebhookDeliveries = make(map[int]WebhookDelivery)
+	}
+
+	now := time.Now().UTC()
+	queued := 0
+
+	for _, endpoint := range database.WebhookEndpoints {
+		if !endpoint.SubscribedTo(event.Event) {
+			continue
+		}
+
+		if endpoint.OwnerId != AdminOwnerId && !event.Public && endpoint.OwnerId != event.SubjectUserId {
+			continue
+		}
+
+		delivery := WebhookDelivery{
+			Id:            nextId(database, "webhook_deliveries", database.WebhookDeliveries),
+			EndpointId:    endpoint.Id,
+			Event:         event.Event,
+			Payload:       event.Payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+
+		database.WebhookDeliveries[delivery.Id] = delivery
+		queued += 1
+	}
+
+	return queued
+}
+
+// SetChirpEventBuilder sets how the event for a newly published chirp is
+// built. It must be set before the server starts handling requests.
+func (db *Database) SetChirpEventBuilder(builder ChirpEventBuilder) {
+	db.chirpEvents = builder
+}
+
+// queueChirpEvent queues the event for a chirp being published as part of
+// the write that publishes it, so it goes out exactly once. A chirp that
+// can't be described is still published, just without its event.
+func (db *Database) queueChirpEvent(database *DatabaseSchema, chirp Chirp) {
+	if db.chirpEvents == nil {
+		return
+	}
+
+	event, err := db.chirpEvents(chirp, database.Attachments)
+
+	if err != nil {
+		log.Printf("Error building event for chirp %v: %v\n", chirp.Id, err.Error())
+		return
+	}
+
+	if queued := queueWebhookEvent(database, event); queued > 0 {
+		log.Printf("Queued %v event for %v webhook endpoints\n", event.Event, queued)
+	}
+}
+
+// SetChirpDeletedEventBuilder sets how the event for a chirp removed along
+// with its author is built. It must be set before the server starts
+// handling requests.
+func (db *Database) SetChirpDeletedEventBuilder(builder ChirpDeletedEventBuilder) {
+	db.chirpDeletedEvents = builder
+}
+
+// queueChirpDeletedEvent queues the event for a chirp removed as part of a
+// larger write, such as deleting its author's account.
+func (db *Database) queueChirpDeletedEvent(database *DatabaseSchema, chirp Chirp) {
+	if db.chirpDeletedEvents == nil {
+		return
+	}
+
+	event, err := db.chirpDeletedEvents(chirp)
+
+	if err != nil {
+		log.Printf("Error building deletion event for chirp %v: %v\n", chirp.Id, err.Error())
+		return
+	}
+
+	if queued := queueWebhookEvent(database, event); queued > 0 {
+		log.Printf("Queued %v event for %v webhook endpoints\n", event.Event, queued)
+	}
+}
+
+// DueWebhookDeliveries returns pending deliveries whose next attempt is due,
+// oldest first.
+func (db *Database) DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var due []WebhookDelivery
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return due, err
+	}
+
+	for _, delivery := range database.WebhookDeliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].Id < due[j].Id })
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+func (db *Database) RecordDeliveryAttempt(id int, attempt DeliveryAttempt) (WebhookDelivery, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	delivery, ok := database.WebhookDeliveries[id]
+
+	if !ok {
+		return WebhookDelivery{}, os.ErrNotExist
+	}
+
+	now := time.Now().UTC()
+	delivery.Attempts += 1
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+
+	switch {
+	case attempt.Succeeded:
+		delivery.Status = DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case attempt.NextAttemptAt.IsZero():
+		delivery.Status = DeliveryFailed
+	default:
+		delivery.NextAttemptAt = attempt.NextAttemptAt
+	}
+
+	database.WebhookDeliveries[id] = delivery
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// ReadWebhookDeliveries returns an endpoint's delivery log, newest first.
+func (db *Database) ReadWebhookDeliveries(endpointId int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return deliveries, err
+	}
+
+	for _, delivery := range database.WebhookDeliveries {
+		if delivery.EndpointId == endpointId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Id > deliveries[j].Id })
+	return deliveries, nil
+}
+
+// RedeliverWebhook queues a fresh copy of a past delivery to the same
+// endpoint. The original stays in the log as it was.
+func (db *Database) RedeliverWebhook(endpointId int, deliveryId int) (WebhookDelivery, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	original, ok := database.WebhookDeliveries[deliveryId]
+
+	if !ok || original.EndpointId != endpointId {
+		return WebhookDelivery{}, os.ErrNotExist
+	}
+
+	now := time.Now().UTC()
+	delivery := WebhookDelivery{
+		Id:            nextId(&database, "webhook_deliveries", database.WebhookDeliveries),
+		EndpointId:    original.EndpointId,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  original.Id,
+		CreatedAt:     now,
+	}
+
+	database.WebhookDeliveries[delivery.Id] = delivery
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// deleteUserWebhookEndpoints removes a user's endpoints and their delivery
+// logs. It only modifies the loaded schema; callers are responsible for
+// writing it.
+func deleteUserWebhookEndpoints(database *DatabaseSchema, userId int) {
+	for id, endpoint := range database.WebhookEndpoints {
+		if endpoint.OwnerId != userId {
+			continue
+		}
+
+		delete(database.WebhookEndpoints, id)
+
+		for deliveryId, delivery := range database.WebhookDeliveries {
+			if delivery.EndpointId == id {
+				delete(database.WebhookDeliveries, deliveryId)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const DefaultPageSize = 20
+const MaxPageSize = 100
+
+var ErrBadCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a reverse-chronological feed. Items are
+// ordered by time, then ID, so items sharing a timestamp still page stably.
+type Cursor struct {
+	Time time.Time
+	Id   int
+}
+
+// Page is one page of a feed. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
+
+func (cursor Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", cursor.Time.UnixNano(), cursor.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor from a client. An empty string is the start
+// of the feed.
+func DecodeCursor(encoded string) (*Cursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+
+	var nanos int64
+	var id int
+	_, err = fmt.Sscanf(string(raw), "%d:%d", &nanos, &id)
+
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+
+	return &Cursor{Time: time.Unix(0, nanos).UTC(), Id: id}, nil
+}
+
+// paginate sorts items newest first and returns the page after cursor.
+// key gives each item's position in the feed.
+func paginate[T any](items []T, cursor *Cursor, limit int, key func(T) Cursor) Page[T] {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+
+	sort.Slice(items, func(i, j int) bool { return key(items[j]).before(key(items[i])) })
+
+	page := Page[T]{Items: []T{}}
+
+	for _, item := range items {
+		if cursor != nil && !key(item).before(*cursor) {
+			continue
+		}
+
+		if len(page.Items) == limit {
+			page.NextCursor = key(page.Items[len(page.Items)-1]).Encode()
+			break
+		}
+
+		page.Items = append(page.Items, item)
+	}
+
+	return page
+}
+
+func (cursor Cursor) before(other Cursor) bool {
+	if cursor.Time.Equal(other.Time) {
+		return cursor.Id < other.Id
+	}
+
+	return cursor.Time.Before(other.Time)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Time: time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC), Id: 42}
+	decoded, err := DecodeCursor(cursor.Encode())
+
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+
+	if decoded == nil || !decoded.Time.Equal(cursor.Time) || decoded.Id != cursor.Id {
+		t.Fatalf("DecodeCursor = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"start of the feed", "", false},
+		{"not base64", "not a cursor!", true},
+		{"no separator", base64.RawURLEncoding.EncodeToString([]byte("12345")), true},
+		{"not numbers", base64.RawURLEncoding.EncodeToString([]byte("a:b")), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := DecodeCursor(test.encoded)
+
+			if test.wantErr {
+				if err != ErrBadCursor {
+					t.Fatalf("DecodeCursor = %+v, %v, want ErrBadCursor", cursor, err)
+				}
+				return
+			}
+
+			if err != nil || cursor != nil {
+				t.Fatalf("DecodeCursor = %+v, %v, want nil", cursor, err)
+			}
+		})
+	}
+}
+
+type testItem struct {
+	id int
+	at time.Time
+}
+
+func testItemCursor(item testItem) Cursor {
+	return Cursor{Time: item.at, Id: item.id}
+}
+
+func TestPaginate(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Items 2, 3 and 4 share a timestamp, so their IDs decide the order
+	items := []testItem{
+		{1, base},
+		{2, base.Add(time.Minute)},
+		{4, base.Add(time.Minute)},
+		{3, base.Add(time.Minute)},
+		{5, base.Add(2 * time.Minute)},
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		pages [][]int
+	}{
+		{"one at a time", 1, [][]int{{5}, {4}, {3}, {2}, {1}}},
+		{"uneven pages", 2, [][]int{{5, 4}, {3, 2}, {1}}},
+		{"exactly full", 5, [][]int{{5, 4, 3, 2, 1}}},
+		{"default limit", 0, [][]int{{5, 4, 3, 2, 1}}},
+		{"over the maximum", MaxPageSize + 1, [][]int{{5, 4, 3, 2, 1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cursor *Cursor
+
+			for n, want := range test.pages {
+				page := paginate(append([]testItem{}, items...), cursor, test.limit, testItemCursor)
+
+				if len(page.Items) != len(want) {
+					t.Fatalf("page %v has %v items, want %v", n, len(page.Items), want)
+				}
+
+				for i, item := range page.Items {
+					if item.id != want[i] {
+						t.Fatalf("page %v item %v = %v, want %v", n, i, item.id, want[i])
+					}
+				}
+
+				last := n == len(test.pages)-1
+
+				if last != (page.NextCursor == "") {
+					t.Fatalf("page %v NextCursor = %q", n, page.NextCursor)
+				}
+
+				if last {
+					break
+				}
+
+				var err error
+				cursor, err = DecodeCursor(page.NextCursor)
+
+				if err != nil {
+					t.Fatalf("DecodeCursor: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPaginateEmpty(t *testing.T) {
+	page := paginate([]testItem{}, nil, 10, testItemCursor)
+
+	if page.Items == nil || len(page.Items) != 0 || page.NextCursor != "" {
+		t.Fatalf("paginate = %+v, want an empty page with no cursor", page)
+	}
+}
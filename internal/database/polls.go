@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const MinPollOptions = 2
+const MaxPollOptions = 4
+const MaxPollOptionLength = 50
+
+var ErrInvalidPoll = fmt.Errorf("polls need %v to %v distinct options of up to %v characters", MinPollOptions, MaxPollOptions, MaxPollOptionLength)
+var ErrPollClosed = errors.New("poll has closed")
+var ErrAlreadyVoted = errors.New("already voted in this poll")
+var ErrInvalidOption = errors.New("no such poll option")
+
+type Poll struct {
+	Options   []string  `json:"options"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Vote struct {
+	Option  int       `json:"option"`
+	VotedAt time.Time `json:"voted_at"`
+}
+
+// PollResults are the vote counts for a poll, by option. ViewerVote is the
+// option the viewer picked, if they voted.
+type PollResults struct {
+	Counts     []int
+	Total      int
+	ViewerVote *int
+}
+
+func (poll Poll) Closed(now time.Time) bool {
+	return !now.Before(poll.ExpiresAt)
+}
+
+// validPoll checks a new poll's options. The expiry is left to the caller,
+// which knows when the chirp goes out.
+func validPoll(poll Poll) bool {
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return false
+	}
+
+	seen := make(map[string]bool)
+
+	for _, option := range poll.Options {
+		key := strings.ToLower(strings.TrimSpace(option))
+
+		if key == "" || utf8.RuneCountInString(option) > MaxPollOptionLength || seen[key] {
+			return false
+		}
+
+		seen[key] = true
+	}
+
+	return true
+}
+
+// Vote records userId's choice in a chirp's poll. Each user votes once and
+// can't change their mind.
+func (db *Database) Vote(userId int, chirpId int, option int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	chirp, ok := database.Chirps[chirpId]
+
+	if !ok || chirp.Deleted || chirp.Poll == nil || hiddenAuthors(&database, userId)[chirp.AuthorId] {
+		return os.ErrNotExist
+	}
+
+	now := time.Now().UTC()
+
+	if chirp.Poll.Closed(now) {
+		return ErrPollClosed
+	}
+
+	if option < 0 || option >= len(chirp.Poll.Options) {
+		return ErrInvalidOption
+	}
+
+	if _, voted := database.Votes[chirpId][userId]; voted {
+		return ErrAlreadyVoted
+	}
+
+	if database.Votes == nil {
+		database.Votes = make(map[int]map[int]Vote)
+	}
+
+	if database.Votes[chirpId] == nil {
+		database.Votes[chirpId] = make(map[int]Vote)
+	}
+
+	database.Votes[chirpId][userId] = Vote{Option: option, VotedAt: now}
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadPollResults counts the votes on the polls of the given chirps, keyed
+// by chirp ID. Chirps without polls are left out. viewerId is 0 for
+// anonymous readers.
+func (db *Database) ReadPollResults(chirpIds []int, viewerId int) (map[int]PollResults, error) {
+	results := make(map[int]PollResults)
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return results, err
+	}
+
+	for _, id := range chirpIds {
+		chirp, ok := database.Chirps[id]
+
+		if !ok || chirp.Poll == nil {
+			continue
+		}
+
+		result := PollResults{Counts: make([]int, len(chirp.Poll.Options))}
+
+		for userId, vote := range database.Votes[id] {
+			if vote.Option >= 0 && vote.Option < len(result.Counts) {
+				result.Counts[vote.Option]++
+				result.Total++
+			}
+
+			if viewerId != 0 && userId == viewerId {
+				option := vote.Option
+				result.ViewerVote = &option
+			}
+		}
+
+		results[id] = result
+	}
+
+	return results, nil
+}
+
+func removeChirpVotes(database *DatabaseSchema, chirpId int) {
+	delete(database.Votes, chirpId)
+}
+
+// removeUserVotes drops a deleted user's votes from every poll.
+func removeUserVotes(database *DatabaseSchema, userId int) {
+	for _, voters := range database.Votes {
+		delete(voters, userId)
+	}
+}
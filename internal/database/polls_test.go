@@ -0,0 +1,104 @@
+package database
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidPoll(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		want    bool
+	}{
+		{"two options", []string{"yes", "no"}, true},
+		{"four options", []string{"a", "b", "c", "d"}, true},
+		{"one option", []string{"yes"}, false},
+		{"five options", []string{"a", "b", "c", "d", "e"}, false},
+		{"duplicates ignoring case and spaces", []string{"Yes", " yes "}, false},
+		{"blank option", []string{"yes", "  "}, false},
+		{"longest option", []string{strings.Repeat("é", MaxPollOptionLength), "no"}, true},
+		{"option too long", []string{strings.Repeat("é", MaxPollOptionLength+1), "no"}, false},
+	}
+
+	for _, test := range tests {
+		if got := validPoll(Poll{Options: test.options}); got != test.want {
+			t.Errorf("%v: validPoll = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVote(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 3)
+	open := createTestChirp(t, db, users[0], "open", ChirpOptions{Poll: &Poll{Options: []string{"yes", "no"}, ExpiresAt: time.Now().Add(time.Hour)}})
+	closesAt := time.Now().Add(20 * time.Millisecond)
+	closed := createTestChirp(t, db, users[0], "closed", ChirpOptions{Poll: &Poll{Options: []string{"yes", "no"}, ExpiresAt: closesAt}})
+	plain := createTestChirp(t, db, users[0], "no poll", ChirpOptions{})
+
+	if _, err := db.CreateChirp("bad poll", users[0], ChirpOptions{Poll: &Poll{Options: []string{"only"}}}); err != ErrInvalidPoll {
+		t.Fatalf("CreateChirp(one option) = %v, want ErrInvalidPoll", err)
+	}
+
+	if _, err := db.CreateChirp("late poll", users[0], ChirpOptions{Poll: &Poll{Options: []string{"yes", "no"}, ExpiresAt: time.Now()}}); err != ErrPollClosed {
+		t.Fatalf("CreateChirp(poll already closed) = %v, want ErrPollClosed", err)
+	}
+
+	time.Sleep(time.Until(closesAt))
+
+	tests := []struct {
+		name    string
+		userId  int
+		chirpId int
+		option  int
+		want    error
+	}{
+		{"vote", users[1], open.Id, 1, nil},
+		{"vote again", users[1], open.Id, 0, ErrAlreadyVoted},
+		{"option out of range", users[2], open.Id, 2, ErrInvalidOption},
+		{"negative option", users[2], open.Id, -1, ErrInvalidOption},
+		{"another voter", users[2], open.Id, 1, nil},
+		{"closed poll", users[1], closed.Id, 0, ErrPollClosed},
+		{"chirp without a poll", users[1], plain.Id, 0, os.ErrNotExist},
+		{"missing chirp", users[1], 999, 0, os.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		if err := db.Vote(test.userId, test.chirpId, test.option); err != test.want {
+			t.Errorf("%v: Vote = %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	results, err := db.ReadPollResults([]int{open.Id, closed.Id, plain.Id}, users[1])
+
+	if err != nil {
+		t.Fatalf("ReadPollResults: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("results for %v chirps, want only the two with polls", len(results))
+	}
+
+	result := results[open.Id]
+
+	if result.Total != 2 || result.Counts[0] != 0 || result.Counts[1] != 2 || result.ViewerVote == nil || *result.ViewerVote != 1 {
+		t.Fatalf("results = %+v, want two votes for option 1, including the viewer's", result)
+	}
+
+	if anonymous, _ := db.ReadPollResults([]int{open.Id}, 0); anonymous[open.Id].ViewerVote != nil {
+		t.Fatalf("anonymous viewer has a vote: %+v", anonymous[open.Id])
+	}
+
+	// Deleted users' votes stop counting
+	if err := db.DeleteUser(users[2], DeletionPolicyAnonymize); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	results, _ = db.ReadPollResults([]int{open.Id}, 0)
+
+	if results[open.Id].Total != 1 {
+		t.Fatalf("total after deleting a voter = %v, want 1", results[open.Id].Total)
+	}
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+var ErrSelfBlock = errors.New("users cannot block or mute themselves")
+var ErrBlocked = errors.New("user has blocked you, or you have blocked them")
+
+type relationshipKind int
+
+const (
+	relationshipBlock relationshipKind = iota
+	relationshipMute
+)
+
+// Block stops targetId from replying to, mentioning or following userId,
+// and hides their chirps from each other. Any follows between the two are
+// dropped. Blocking someone twice is a no-op.
+func (db *Database) Block(userId int, targetId int) error {
+	return db.setRelationship(relationshipBlock, userId, targetId, true)
+}
+
+func (db *Database) Unblock(userId int, targetId int) error {
+	return db.setRelationship(relationshipBlock, userId, targetId, false)
+}
+
+// Mute hides targetId's chirps and notifications from userId, without them
+// being able to tell. Muting someone twice is a no-op.
+func (db *Database) Mute(userId int, targetId int) error {
+	return db.setRelationship(relationshipMute, userId, targetId, true)
+}
+
+func (db *Database) Unmute(userId int, targetId int) error {
+	return db.setRelationship(relationshipMute, userId, targetId, false)
+}
+
+// relationships returns the blocks or mutes map, creating it if needed.
+func (database *DatabaseSchema) relationships(kind relationshipKind) map[int]map[int]time.Time {
+	if kind == relationshipMute {
+		if database.Mutes == nil {
+			database.Mutes = make(map[int]map[int]time.Time)
+		}
+		return database.Mutes
+	}
+
+	if database.Blocks == nil {
+		database.Blocks = make(map[int]map[int]time.Time)
+	}
+	return database.Blocks
+}
+
+// setRelationship adds or removes a block or mute from userId to targetId.
+func (db *Database) setRelationship(kind relationshipKind, userId int, targetId int, on bool) error {
+	if userId == targetId {
+		return ErrSelfBlock
+	}
+
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	edges := database.relationships(kind)
+	_, already := edges[userId][targetId]
+
+	if already == on {
+		return nil
+	}
+
+	if on {
+		target, ok := database.Users[targetId]
+
+		if !ok || target.Deleted {
+			return os.ErrNotExist
+		}
+
+		if edges[userId] == nil {
+			edges[userId] = make(map[int]time.Time)
+		}
+
+		edges[userId][targetId] = time.Now().UTC()
+
+		if kind == relationshipBlock {
+			removeFollow(&database, userId, targetId)
+			removeFollow(&database, targetId, userId)
+		}
+	} else {
+		delete(edges[userId], targetId)
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ReadBlocked returns the IDs of users someone has blocked, most recent
+// first.
+func (db *Database) ReadBlocked(userId int) ([]int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idsBySince(database.Blocks[userId]), nil
+}
+
+// ReadMuted returns the IDs of users someone has muted, most recent first.
+func (db *Database) ReadMuted(userId int) ([]int, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idsBySince(database.Mutes[userId]), nil
+}
+
+// ReadHiddenAuthors returns the users whose content viewerId shouldn't see:
+// anyone they've blocked or muted, and anyone who has blocked them.
+func (db *Database) ReadHiddenAuthors(viewerId int) (map[int]bool, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hiddenAuthors(&database, viewerId), nil
+}
+
+func hiddenAuthors(database *DatabaseSchema, viewerId int) map[int]bool {
+	hidden := make(map[int]bool)
+
+	for id := range database.Blocks[viewerId] {
+		hidden[id] = true
+	}
+
+	for id := range database.Mutes[viewerId] {
+		hidden[id] = true
+	}
+
+	for blockerId, blocked := range database.Blocks {
+		if _, ok := blocked[viewerId]; ok {
+			hidden[blockerId] = true
+		}
+	}
+
+	return hidden
+}
+
+// hasBlocked reports whether blockerId has blocked userId.
+func hasBlocked(database *DatabaseSchema, blockerId int, userId int) bool {
+	_, ok := database.Blocks[blockerId][userId]
+	return ok
+}
+
+// hasSilenced reports whether userId has blocked or muted actorId, so
+// shouldn't hear from them.
+func hasSilenced(database *DatabaseSchema, userId int, actorId int) bool {
+	_, muted := database.Mutes[userId][actorId]
+	return muted || hasBlocked(database, userId, actorId)
+}
+
+// removeUserRelationships drops every block and mute to or from a user. It
+// only modifies the loaded schema; callers are responsible for writing it.
+func removeUserRelationships(database *DatabaseSchema, userId int) {
+	for _, edges := range []map[int]map[int]time.Time{database.Blocks, database.Mutes} {
+		delete(edges, userId)
+
+		for _, targets := range edges {
+			delete(targets, userId)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+)
+
+func mentionCount(chirp Chirp) int {
+	count := 0
+
+	for _, entity := range chirp.Entities {
+		if entity.Type == entities.TypeMention {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 4)
+	a, b, c, d := users[0], users[1], users[2], users[3]
+
+	for _, pair := range [][2]int{{a, b}, {b, a}, {a, c}, {a, d}} {
+		if err := db.Follow(pair[0], pair[1]); err != nil {
+			t.Fatalf("Follow(%v, %v): %v", pair[0], pair[1], err)
+		}
+	}
+
+	if err := db.Block(a, a); err != ErrSelfBlock {
+		t.Fatalf("blocking yourself = %v, want ErrSelfBlock", err)
+	}
+
+	if err := db.Block(a, 99); err != os.ErrNotExist {
+		t.Fatalf("blocking a missing user = %v, want os.ErrNotExist", err)
+	}
+
+	if err := db.Block(a, b); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	if err := db.Mute(a, c); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	// Blocking drops follows both ways and stops new ones
+	following, _ := db.ReadFollowing(b)
+
+	if len(following) != 0 {
+		t.Errorf("b still follows %v after a blocked them", following)
+	}
+
+	for _, pair := range [][2]int{{a, b}, {b, a}} {
+		if err := db.Follow(pair[0], pair[1]); err != ErrBlocked {
+			t.Errorf("Follow(%v, %v) = %v, want ErrBlocked", pair[0], pair[1], err)
+		}
+	}
+
+	tests := []struct {
+		viewer int
+		want   map[int]bool
+	}{
+		{a, map[int]bool{b: true, c: true}},
+		{b, map[int]bool{a: true}},
+		{c, map[int]bool{}},
+		{d, map[int]bool{}},
+	}
+
+	for _, test := range tests {
+		hidden, err := db.ReadHiddenAuthors(test.viewer)
+
+		if err != nil {
+			t.Fatalf("ReadHiddenAuthors(%v): %v", test.viewer, err)
+		}
+
+		if len(hidden) != len(test.want) {
+			t.Errorf("ReadHiddenAuthors(%v) = %v, want %v", test.viewer, hidden, test.want)
+			continue
+		}
+
+		for id := range test.want {
+			if !hidden[id] {
+				t.Errorf("ReadHiddenAuthors(%v) = %v, want %v", test.viewer, hidden, test.want)
+			}
+		}
+	}
+}
+
+func TestBlockedUsersCantReplyOrMention(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 3)
+	a, b, c := users[0], users[1], users[2]
+	handle := "alice"
+
+	_, err := db.UpdateProfile(a, ProfileUpdate{Handle: &handle})
+
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	err = db.Block(a, b)
+
+	if err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	parent := createTestChirp(t, db, a, "hello", ChirpOptions{})
+
+	_, err = db.CreateChirp("reply", b, ChirpOptions{InReplyTo: &parent.Id})
+
+	if err != ErrBlocked {
+		t.Fatalf("reply from a blocked user = %v, want ErrBlocked", err)
+	}
+
+	// Blocking is one-way for replies: a can still reply to b
+	other := createTestChirp(t, db, b, "hi", ChirpOptions{})
+	createTestChirp(t, db, a, "reply", ChirpOptions{InReplyTo: &other.Id})
+
+	if got := mentionCount(createTestChirp(t, db, b, "hi @alice", ChirpOptions{})); got != 0 {
+		t.Errorf("blocked user's chirp has %v mentions, want 0", got)
+	}
+
+	if got := mentionCount(createTestChirp(t, db, c, "hi @alice", ChirpOptions{})); got != 1 {
+		t.Errorf("other user's chirp has %v mentions, want 1", got)
+	}
+
+	notifications, _, err := db.ReadNotifications(a, false, nil, 10)
+
+	if err != nil || len(notifications.Items) != 1 || notifications.Items[0].ActorId != c {
+		t.Fatalf("ReadNotifications = %+v, %v, want only c's mention", notifications.Items, err)
+	}
+}
+
+func TestMutesHideNotificationsAndTimeline(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 3)
+	a, b, c := users[0], users[1], users[2]
+
+	for _, followee := range []int{b, c} {
+		if err := db.Follow(a, followee); err != nil {
+			t.Fatalf("Follow: %v", err)
+		}
+	}
+
+	chirp := createTestChirp(t, db, a, "like this", ChirpOptions{})
+
+	// b's like comes before the mute, c's after; neither should show
+	if err := db.Like(b, chirp.Id); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	if err := db.Mute(a, b); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	if err := db.Mute(a, c); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	if err := db.Like(c, chirp.Id); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	notifications, unread, err := db.ReadNotifications(a, false, nil, 10)
+
+	if err != nil || len(notifications.Items) != 0 || unread != 0 {
+		t.Fatalf("ReadNotifications = %+v, %v unread, %v, want none", notifications.Items, unread, err)
+	}
+
+	// Unmuting brings the earlier notifications back
+	if err := db.Unmute(a, b); err != nil {
+		t.Fatalf("Unmute: %v", err)
+	}
+
+	notifications, unread, err = db.ReadNotifications(a, false, nil, 10)
+
+	if err != nil || len(notifications.Items) != 1 || unread != 1 {
+		t.Fatalf("ReadNotifications after unmuting = %+v, %v unread, %v, want b's like", notifications.Items, unread, err)
+	}
+
+	createTestChirp(t, db, b, "from b", ChirpOptions{})
+	createTestChirp(t, db, c, "from c", ChirpOptions{})
+	timeline, err := db.ReadTimeline(a, nil, 10)
+
+	if err != nil {
+		t.Fatalf("ReadTimeline: %v", err)
+	}
+
+	for _, item := range timeline.Items {
+		if item.AuthorId == c {
+			t.Errorf("muted user's chirp %q is on the timeline", item.Body)
+		}
+	}
+
+	if len(timeline.Items) != 2 {
+		t.Errorf("timeline has %v chirps, want a's and b's", len(timeline.Items))
+	}
+}
+
+func TestHiddenAuthorsCantBeEngagedWith(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 4)
+	blocker, blocked, muter, other := users[0], users[1], users[2], users[3]
+	poll := &Poll{Options: []string{"yes", "no"}, ExpiresAt: time.Now().Add(time.Hour)}
+
+	blockerChirp := createTestChirp(t, db, blocker, "by the blocker", ChirpOptions{Poll: poll})
+	blockedChirp := createTestChirp(t, db, blocked, "by the blocked user", ChirpOptions{Poll: poll})
+
+	if err := db.Block(blocker, blocked); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	if err := db.Mute(muter, blocked); err != nil {
+		t.Fatalf("Mute: %v", err)
+	}
+
+	actions := map[string]func(userId int, chirpId int) error{
+		"like":     db.Like,
+		"rechirp":  db.Rechirp,
+		"bookmark": db.Bookmark,
+		"vote":     func(userId int, chirpId int) error { return db.Vote(userId, chirpId, 0) },
+	}
+
+	tests := []struct {
+		name    string
+		userId  int
+		chirpId int
+		want    error
+	}{
+		{"blocked author", blocker, blockedChirp.Id, os.ErrNotExist},
+		{"blocked by the author", blocked, blockerChirp.Id, os.ErrNotExist},
+		{"muted author", muter, blockedChirp.Id, os.ErrNotExist},
+		{"unrelated user", other, blockedChirp.Id, nil},
+		{"muter on someone else", muter, blockerChirp.Id, nil},
+	}
+
+	for _, test := range tests {
+		for action, engage := range actions {
+			if err := engage(test.userId, test.chirpId); err != test.want {
+				t.Errorf("%v: %v err = %v, want %v", test.name, action, err, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	PlanFree      = "free"
+	PlanChirpyRed = "chirpy_red"
+)
+
+const (
+	// SubscriptionActive subscriptions renew at the end of each period.
+	SubscriptionActive = "active"
+	// SubscriptionPastDue subscriptions had a failed payment and stay active
+	// until their grace period ends.
+	SubscriptionPastDue = "past_due"
+	// SubscriptionCanceled subscriptions stay active until the end of the
+	// period that has already been paid for.
+	SubscriptionCanceled = "canceled"
+	SubscriptionExpired  = "expired"
+)
+
+// Subscription changes, as reported by a billing provider
+const (
+	SubscriptionEventUpgraded      = "upgraded"
+	SubscriptionEventRenewed       = "renewed"
+	SubscriptionEventDowngraded    = "downgraded"
+	SubscriptionEventCanceled      = "canceled"
+	SubscriptionEventPaymentFailed = "payment_failed"
+	SubscriptionEventExpired       = "expired"
+)
+
+const DefaultBillingPeriod = 30 * 24 * time.Hour
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+type Subscription struct {
+	Plan               string     `json:"plan"`
+	Status             string     `json:"status"`
+	CurrentPeriodStart time.Time  `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time  `json:"current_period_end"`
+	GracePeriodEnd     *time.Time `json:"grace_period_end,omitempty"`
+	CanceledAt         *time.Time `json:"canceled_at,omitempty"`
+}
+
+// SubscriptionChange describes an event from a billing provider. Zero
+// period times fall back to defaults based on when the change is applied.
+type SubscriptionChange struct {
+	Event       string
+	Plan        string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+type BillingEvent struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Event     string    `json:"event"`
+	Plan      string    `json:"plan"`
+	Status    string    `json:"status"`
+	PeriodEnd time.Time `json:"period_end"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccessEndsAt is the point after which a subscription stops granting its
+// plan, if nothing else happens to it first.
+func (sub Subscription) AccessEndsAt() time.Time {
+	if sub.Status == SubscriptionPastDue && sub.GracePeriodEnd != nil {
+		return *sub.GracePeriodEnd
+	}
+
+	return sub.CurrentPeriodEnd
+}
+
+// Entitled reports whether the subscription currently grants a paid plan.
+func (sub Subscription) Entitled(now time.Time) bool {
+	if sub.Plan == PlanFree || sub.Status == SubscriptionExpired {
+		return false
+	}
+
+	return now.Before(sub.AccessEndsAt())
+}
+
+// CurrentPlan returns the plan the user is entitled to right now. Users who
+// were upgraded before subscriptions were tracked keep Chirpy Red.
+func (user User) CurrentPlan(now time.Time) string {
+	if user.Subscription == nil {
+		if user.IsChirpyRed {
+			return PlanChirpyRed
+		}
+
+		return PlanFree
+	}
+
+	if !user.Subscription.Entitled(now) {
+		return PlanFree
+	}
+
+	return user.Subscription.Plan
+}
+
+func applySubscriptionChange(sub Subscription, change SubscriptionChange, now time.Time) (Subscription, error) {
+	switch change.Event {
+	case SubscriptionEventUpgraded, SubscriptionEventRenewed:
+		sub.Plan = change.Plan
+		if sub.Plan == "" {
+			sub.Plan = PlanChirpyRed
+		}
+
+		sub.Status = SubscriptionActive
+		sub.CurrentPeriodStart = change.PeriodStart
+		if sub.CurrentPeriodStart.IsZero() {
+			sub.CurrentPeriodStart = now
+		}
+
+		sub.CurrentPeriodEnd = change.PeriodEnd
+		if sub.CurrentPeriodEnd.IsZero() {
+			sub.CurrentPeriodEnd = sub.CurrentPeriodStart.Add(DefaultBillingPeriod)
+		}
+
+		sub.GracePeriodEnd = nil
+		sub.CanceledAt = nil
+	case SubscriptionEventDowngraded:
+		sub.Plan = change.Plan
+		if sub.Plan == "" {
+			sub.Plan = PlanFree
+		}
+
+		sub.Status = SubscriptionActive
+		sub.GracePeriodEnd = nil
+		sub.CanceledAt = nil
+
+		if sub.Plan == PlanFree {
+			sub.CurrentPeriodStart = now
+			sub.CurrentPeriodEnd = now
+		}
+	case SubscriptionEventCanceled:
+		sub.Status = SubscriptionCanceled
+		sub.CanceledAt = &now
+	case SubscriptionEventPaymentFailed:
+		graceStart := sub.CurrentPeriodEnd
+		if graceStart.Before(now) {
+			graceStart = now
+		}
+
+		graceEnd := graceStart.Add(DefaultGracePeriod)
+		sub.Status = SubscriptionPastDue
+		sub.GracePeriodEnd = &graceEnd
+	case SubscriptionEventExpired:
+		sub.Status = SubscriptionExpired
+		sub.GracePeriodEnd = nil
+	default:
+		return sub, fmt.Errorf("unknown subscription event: %v", change.Event)
+	}
+
+	return sub, nil
+}
+
+// applySubscriptionToUser updates a user's subscription and records the
+// change in their billing history. It only modifies the loaded schema;
+// callers are responsible for writing it.
+func applySubscriptionToUser(database *DatabaseSchema, user User, change SubscriptionChange, now time.Time) (User, error) {
+	sub := Subscription{Plan: PlanFree, Status: SubscriptionExpired}
+
+	if user.Subscription != nil {
+		sub = *user.Subscription
+	} else if user.IsChirpyRed {
+		// Upgraded before subscriptions were tracked
+		sub = Subscription{Plan: PlanChirpyRed, Status: SubscriptionActive, CurrentPeriodStart: user.CreatedAt, CurrentPeriodEnd: now}
+	}
+
+	sub, err := applySubscriptionChange(sub, change, now)
+
+	if err != nil {
+		return user, err
+	}
+
+	user.Subscription = &sub
+	user.IsChirpyRed = sub.Entitled(now)
+	database.Users[user.Id] = user
+
+	if database.BillingEvents == nil {
+		database.BillingEvents = make(map[int]BillingEvent)
+	}
+
+	billingEvent := BillingEvent{
+		Id:        nextId(database, "billing_events", database.BillingEvents),
+		UserId:    user.Id,
+		Event:     change.Event,
+		Plan:      sub.Plan,
+		Status:    sub.Status,
+		PeriodEnd: sub.CurrentPeriodEnd,
+		CreatedAt: now,
+	}
+
+	database.BillingEvents[billingEvent.Id] = billingEvent
+
+	log.Printf("Subscription change:\n")
+	log.Printf("User Id: %v\n", user.Id)
+	log.Printf("Event: %v\n", change.Event)
+	log.Printf("Plan: %v (%v)\n", sub.Plan, sub.Status)
+
+	return user, nil
+}
+
+// ExpireSubscriptions moves subscriptions whose paid period, or grace
+// period, has ended to expired. It returns how many were expired.
+func (db *Database) ExpireSubscriptions(now time.Time) (int, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+
+	for _, user := range database.Users {
+		sub := user.Subscription
+
+		if sub == nil || sub.Plan == PlanFree || sub.Status == SubscriptionExpired {
+			continue
+		}
+
+		if now.Before(sub.AccessEndsAt()) {
+			continue
+		}
+
+		_, err = applySubscriptionToUser(&database, user, SubscriptionChange{Event: SubscriptionEventExpired}, now)
+
+		if err != nil {
+			return expired, err
+		}
+
+		expired += 1
+	}
+
+	if expired == 0 {
+		return 0, nil
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+func (db *Database) ReadBillingHistory(userId int) ([]BillingEvent, error) {
+	var history []BillingEvent
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return history, err
+	}
+
+	for _, event := range database.BillingEvents {
+		if event.UserId == userId {
+			history = append(history, event)
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool { return history[i].Id < history[j].Id })
+	return history, nil
+}
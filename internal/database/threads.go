@@ -0,0 +1,70 @@
+package database
+
+import (
+	"os"
+	"sort"
+)
+
+// Thread is the conversation around a chirp. Ancestors run from the root
+// down to the chirp's parent; Descendants are every reply below the chirp,
+// oldest first. Tombstones are included so the thread stays connected.
+type Thread struct {
+	Ancestors   []Chirp
+	Chirp       Chirp
+	Descendants []Chirp
+}
+
+func (db *Database) ReadThread(id int) (Thread, error) {
+	var thread Thread
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return thread, err
+	}
+
+	chirp, ok := database.Chirps[id]
+
+	if !ok {
+		return thread, os.ErrNotExist
+	}
+
+	thread.Chirp = chirp
+
+	for parentId := chirp.InReplyTo; parentId != nil; {
+		parent, ok := database.Chirps[*parentId]
+
+		if !ok {
+			break
+		}
+
+		thread.Ancestors = append([]Chirp{parent}, thread.Ancestors...)
+		parentId = parent.InReplyTo
+	}
+
+	replies := make(map[int][]Chirp)
+
+	for _, reply := range database.Chirps {
+		if reply.InReplyTo != nil {
+			replies[*reply.InReplyTo] = append(replies[*reply.InReplyTo], reply)
+		}
+	}
+
+	// Breadth-first from the chirp, so only its own subtree is collected
+	queue := []int{id}
+
+	for len(queue) > 0 {
+		children := replies[queue[0]]
+		queue = queue[1:]
+
+		for _, child := range children {
+			thread.Descendants = append(thread.Descendants, child)
+			queue = append(queue, child.Id)
+		}
+	}
+
+	sort.Slice(thread.Descendants, func(i, j int) bool {
+		return thread.Descendants[i].Id < thread.Descendants[j].Id
+	})
+
+	return thread, nil
+}
@@ -1,12 +1,27 @@
 package database
 
 import (
+	"errors"
 	"log"
+	"sort"
 	"time"
 )
 
+type Session struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"user_id"`
+	Token      string    `json:"token"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  string    `json:"revoked_at,omitempty"`
+}
+
+var ErrTokenRevoked = errors.New("refresh token has been revoked")
+
 func (db *Database) RevokeToken(token string) error {
-	database, err := db.loadDatabase()
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
 
 	if err != nil {
 		return err
@@ -16,7 +31,16 @@ func (db *Database) RevokeToken(token string) error {
 		database.RevokedTokens = make(map[string]string)
 	}
 
-	database.RevokedTokens[token] = time.Now().UTC().String()
+	revokedAt := time.Now().UTC().String()
+	database.RevokedTokens[token] = revokedAt
+
+	for id, session := range database.Sessions {
+		if session.Token == token {
+			session.RevokedAt = revokedAt
+			database.Sessions[id] = session
+		}
+	}
+
 	err = db.writeDatabase(database)
 
 	if err != nil {
@@ -45,3 +69,138 @@ func (db *Database) IsTokenRevoked(token string) (bool, error) {
 	}
 
 }
+
+// CreateSession records a refresh token issued to a user at login, so it can
+// be listed in exports and revoked when the account goes away.
+func (db *Database) CreateSession(userId int, token string, expiresAt time.Time) (Session, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	if database.Sessions == nil {
+		database.Sessions = make(map[int]Session)
+	}
+
+	now := time.Now().UTC()
+	session := Session{
+		Id:         nextId(&database, "sessions", database.Sessions),
+		UserId:     userId,
+		Token:      token,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+
+	database.Sessions[session.Id] = session
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// RefreshSession swaps the refresh token on a session for a new one and
+// records that the session was used. The old token is revoked in the same
+// write, so it can't be exchanged twice. Tokens issued before sessions were
+// recorded get a session of their own, as long as their user still exists.
+func (db *Database) RefreshSession(userId int, token string, newToken string, expiresAt time.Time) (Session, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	if _, ok := database.RevokedTokens[token]; ok {
+		return Session{}, ErrTokenRevoked
+	}
+
+	if user, ok := database.Users[userId]; !ok || user.Deleted {
+		return Session{}, ErrTokenRevoked
+	}
+
+	if database.RevokedTokens == nil {
+		database.RevokedTokens = make(map[string]string)
+	}
+
+	if database.Sessions == nil {
+		database.Sessions = make(map[int]Session)
+	}
+
+	now := time.Now().UTC()
+	var session Session
+
+	for _, existing := range database.Sessions {
+		if existing.Token == token && existing.UserId == userId {
+			session = existing
+			break
+		}
+	}
+
+	if session.Id == 0 {
+		session = Session{
+			Id:        nextId(&database, "sessions", database.Sessions),
+			UserId:    userId,
+			CreatedAt: now,
+		}
+	}
+
+	session.Token = newToken
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+	database.Sessions[session.Id] = session
+	database.RevokedTokens[token] = now.String()
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+func (db *Database) ReadUserSessions(userId int) ([]Session, error) {
+	var sessions []Session
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return sessions, err
+	}
+
+	for _, session := range database.Sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Id < sessions[j].Id })
+	return sessions, nil
+}
+
+// revokeUserSessions marks every refresh token belonging to a user as revoked.
+// It only modifies the loaded schema; callers are responsible for writing it.
+func revokeUserSessions(database *DatabaseSchema, userId int) {
+	if database.RevokedTokens == nil {
+		database.RevokedTokens = make(map[string]string)
+	}
+
+	revokedAt := time.Now().UTC().String()
+
+	for id, session := range database.Sessions {
+		if session.UserId != userId || session.RevokedAt != "" {
+			continue
+		}
+
+		session.RevokedAt = revokedAt
+		database.Sessions[id] = session
+		database.RevokedTokens[session.Token] = revokedAt
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshSession(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	created, err := db.CreateSession(users[0], "first", expiresAt)
+
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	refreshed, err := db.RefreshSession(users[0], "first", "second", expiresAt.Add(time.Hour))
+
+	if err != nil {
+		t.Fatalf("RefreshSession: %v", err)
+	}
+
+	if refreshed.Id != created.Id || refreshed.Token != "second" || !refreshed.LastUsedAt.After(created.LastUsedAt) {
+		t.Fatalf("refreshed session = %+v, want session %v updated with the new token", refreshed, created.Id)
+	}
+
+	_, err = db.RefreshSession(users[0], "first", "third", expiresAt)
+
+	if err != ErrTokenRevoked {
+		t.Fatalf("refreshing the old token again: err = %v, want ErrTokenRevoked", err)
+	}
+
+	// Tokens from before sessions were recorded get one on first refresh
+	legacy, err := db.RefreshSession(users[0], "legacy", "fourth", expiresAt)
+
+	if err != nil {
+		t.Fatalf("RefreshSession(legacy): %v", err)
+	}
+
+	sessions, err := db.ReadUserSessions(users[0])
+
+	if err != nil {
+		t.Fatalf("ReadUserSessions: %v", err)
+	}
+
+	if len(sessions) != 2 || legacy.Id == created.Id {
+		t.Fatalf("sessions = %+v, want the original and one for the legacy token", sessions)
+	}
+}
+
+func TestRefreshSessionForDeletedUser(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 2)
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		userId int
+		policy DeletionPolicy
+	}{
+		{"never existed", 99, ""},
+		{"deleted", users[0], DeletionPolicyDelete},
+		{"anonymized", users[1], DeletionPolicyAnonymize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.policy != "" {
+				err := db.DeleteUser(test.userId, test.policy)
+
+				if err != nil {
+					t.Fatalf("DeleteUser: %v", err)
+				}
+			}
+
+			_, err := db.RefreshSession(test.userId, "legacy-"+test.name, "new-"+test.name, expiresAt)
+
+			if err != ErrTokenRevoked {
+				t.Fatalf("RefreshSession = %v, want ErrTokenRevoked", err)
+			}
+
+			sessions, _ := db.ReadUserSessions(test.userId)
+
+			if len(sessions) != 0 {
+				t.Fatalf("sessions = %+v, want none", sessions)
+			}
+		})
+	}
+}
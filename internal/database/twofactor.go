@@ -0,0 +1,281 @@
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/totp"
+)
+
+var ErrTotpAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTotpNotEnrolled = errors.New("two-factor authentication has not been set up")
+var ErrBadTotpCode = errors.New("invalid two-factor code")
+var ErrChallengeUsed = errors.New("this challenge has already been used")
+var ErrChallengeLocked = errors.New("too many incorrect codes, log in again")
+
+// MaxChallengeFailures is how many wrong codes a login challenge takes
+// before it's revoked.
+const MaxChallengeFailures = 5
+
+// ChallengeAttempts counts the wrong codes given for a login challenge.
+type ChallengeAttempts struct {
+	Failures  int       `json:"failures"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StartTotpEnrollment stores a pending TOTP secret for a user. It does not
+// take effect until ConfirmTotpEnrollment is called with a valid code.
+func (db *Database) StartTotpEnrollment(id int, secret string) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return os.ErrNotExist
+	}
+
+	if user.TotpEnabled {
+		return ErrTotpAlreadyEnabled
+	}
+
+	user.TotpSecret = secret
+	user.TotpLastStep = 0
+	database.Users[id] = user
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmTotpEnrollment turns on two-factor authentication once the user
+// proves their authenticator is producing codes, and stores hashes of their
+// recovery codes.
+func (db *Database) ConfirmTotpEnrollment(id int, code string, recoveryCodes []string) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return os.ErrNotExist
+	}
+
+	if user.TotpEnabled {
+		return ErrTotpAlreadyEnabled
+	}
+
+	if user.TotpSecret == "" {
+		return ErrTotpNotEnrolled
+	}
+
+	step, valid := totp.Validate(user.TotpSecret, code, time.Now(), user.TotpLastStep)
+
+	if !valid {
+		return ErrBadTotpCode
+	}
+
+	user.TotpEnabled = true
+	user.TotpLastStep = step
+	user.RecoveryCodes = nil
+
+	for _, recoveryCode := range recoveryCodes {
+		user.RecoveryCodes = append(user.RecoveryCodes, hashRecoveryCode(recoveryCode))
+	}
+
+	database.Users[id] = user
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. TOTP codes can't be replayed and recovery codes are
+// consumed on use.
+func (db *Database) VerifySecondFactor(id int, code string) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	err = verifySecondFactor(&database, id, code)
+
+	if err != nil {
+		return err
+	}
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// VerifyChallenge checks the code given for a login challenge. A challenge
+// is used up by a correct code, or by MaxChallengeFailures wrong ones, so a
+// single challenge can't be used to guess at codes for its whole life.
+// Both happen in the same write as the check, so concurrent attempts can't
+// get past either.
+func (db *Database) VerifyChallenge(challenge string, expiresAt time.Time, id int, code string) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := database.RevokedTokens[challenge]; ok {
+		return ErrChallengeUsed
+	}
+
+	now := time.Now().UTC()
+	err = verifySecondFactor(&database, id, code)
+
+	if err == ErrBadTotpCode {
+		if database.ChallengeAttempts == nil {
+			database.ChallengeAttempts = make(map[string]ChallengeAttempts)
+		}
+
+		attempts := database.ChallengeAttempts[challenge]
+		attempts.Failures += 1
+		attempts.ExpiresAt = expiresAt
+		database.ChallengeAttempts[challenge] = attempts
+
+		if attempts.Failures >= MaxChallengeFailures {
+			log.Printf("Too many incorrect codes for user %v, revoking their challenge\n", id)
+			revokeChallenge(&database, challenge, now)
+			err = ErrChallengeLocked
+		}
+	} else if err == nil {
+		revokeChallenge(&database, challenge, now)
+	} else {
+		return err
+	}
+
+	// Attempts at challenges that have expired don't matter any more
+	for token, attempts := range database.ChallengeAttempts {
+		if attempts.ExpiresAt.Before(now) {
+			delete(database.ChallengeAttempts, token)
+		}
+	}
+
+	writeErr := db.writeDatabase(database)
+
+	if writeErr != nil {
+		log.Printf("Error writing database: %v\n", writeErr.Error())
+		return writeErr
+	}
+
+	return err
+}
+
+func revokeChallenge(database *DatabaseSchema, challenge string, now time.Time) {
+	if database.RevokedTokens == nil {
+		database.RevokedTokens = make(map[string]string)
+	}
+
+	database.RevokedTokens[challenge] = now.String()
+	delete(database.ChallengeAttempts, challenge)
+}
+
+// verifySecondFactor is VerifySecondFactor on the loaded schema. Callers
+// are responsible for writing it.
+func verifySecondFactor(database *DatabaseSchema, id int, code string) error {
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return os.ErrNotExist
+	}
+
+	if !user.TotpEnabled {
+		return ErrTotpNotEnrolled
+	}
+
+	if step, valid := totp.Validate(user.TotpSecret, code, time.Now(), user.TotpLastStep); valid {
+		user.TotpLastStep = step
+	} else {
+		codeHash := hashRecoveryCode(code)
+		found := -1
+
+		for idx, storedHash := range user.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(storedHash), []byte(codeHash)) == 1 {
+				found = idx
+			}
+		}
+
+		if found == -1 {
+			return ErrBadTotpCode
+		}
+
+		user.RecoveryCodes = append(user.RecoveryCodes[:found], user.RecoveryCodes[found+1:]...)
+		log.Printf("User %v used a recovery code, %v remaining\n", id, len(user.RecoveryCodes))
+	}
+
+	database.Users[id] = user
+	return nil
+}
+
+func (db *Database) DisableTotp(id int) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return err
+	}
+
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return os.ErrNotExist
+	}
+
+	user.TotpEnabled = false
+	user.TotpSecret = ""
+	user.TotpLastStep = 0
+	user.RecoveryCodes = nil
+
+	database.Users[id] = user
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Recovery codes are long and random, so a fast hash is enough here.
+func hashRecoveryCode(code string) string {
+	normalised := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/totp"
+)
+
+func enrollTestUser(t *testing.T, db *Database, id int, recoveryCodes []string) {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+
+	err = db.StartTotpEnrollment(id, secret)
+
+	if err != nil {
+		t.Fatalf("StartTotpEnrollment: %v", err)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	err = db.ConfirmTotpEnrollment(id, code, recoveryCodes)
+
+	if err != nil {
+		t.Fatalf("ConfirmTotpEnrollment: %v", err)
+	}
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+	enrollTestUser(t, db, users[0], []string{"aaaaa-aaaaa", "bbbbb-bbbbb"})
+	expiresAt := time.Now().UTC().Add(5 * time.Minute)
+
+	for i := 1; i < MaxChallengeFailures; i++ {
+		err := db.VerifyChallenge("locked", expiresAt, users[0], "000000x")
+
+		if err != ErrBadTotpCode {
+			t.Fatalf("wrong code %v: err = %v, want ErrBadTotpCode", i, err)
+		}
+	}
+
+	err := db.VerifyChallenge("locked", expiresAt, users[0], "000000x")
+
+	if err != ErrChallengeLocked {
+		t.Fatalf("wrong code %v: err = %v, want ErrChallengeLocked", MaxChallengeFailures, err)
+	}
+
+	// Even the right code is refused once the challenge is used up
+	err = db.VerifyChallenge("locked", expiresAt, users[0], "aaaaa-aaaaa")
+
+	if err != ErrChallengeUsed {
+		t.Fatalf("right code after lockout: err = %v, want ErrChallengeUsed", err)
+	}
+
+	err = db.VerifyChallenge("single", expiresAt, users[0], "aaaaa-aaaaa")
+
+	if err != nil {
+		t.Fatalf("right code: %v", err)
+	}
+
+	err = db.VerifyChallenge("single", expiresAt, users[0], "bbbbb-bbbbb")
+
+	if err != ErrChallengeUsed {
+		t.Fatalf("second use of a challenge: err = %v, want ErrChallengeUsed", err)
+	}
+}
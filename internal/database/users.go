@@ -2,31 +2,73 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ajpotts01/go-chirpy/internal/password"
 )
 
 type User struct {
-	Password    []byte `json:"password"`
-	Email       string `json:"email"`
-	Id          int    `json:"id"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Password    []byte    `json:"password"`
+	Email       string    `json:"email"`
+	Id          int       `json:"id"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Deleted     bool      `json:"deleted,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle,omitempty"`
+
+	TotpSecret    string   `json:"totp_secret,omitempty"`
+	TotpEnabled   bool     `json:"totp_enabled,omitempty"`
+	TotpLastStep  int64    `json:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+
+	Subscription *Subscription `json:"subscription,omitempty"`
+
+	NotificationPreferences NotificationPreferences `json:"notification_preferences,omitempty"`
 }
 
-func (db *Database) CreateUser(email string, password string) (User, error) {
+// ProfileUpdate holds the user-editable profile fields. Nil fields are left
+// unchanged.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	AvatarUrl   *string
+	Handle      *string
+}
+
+var ErrHandleTaken = errors.New("handle is already taken")
+
+// DeletionPolicy controls what happens to a user's data when they delete
+// their account.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete removes the user and every chirp they posted.
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyAnonymize scrubs the user's personal details but keeps the
+	// record and their chirps so IDs and conversations stay intact.
+	DeletionPolicyAnonymize DeletionPolicy = "anonymize"
+)
+
+func (db *Database) CreateUser(email string, plainPassword string) (User, error) {
 	var user User
 
-	database, err := db.loadDatabase()
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
 
 	if err != nil {
 		return user, err
 	}
 
-	newId := len(database.Users) + 1
+	newId := nextId(&database, "users", database.Users)
 
-	hashPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashPass, err := db.hasher.Hash(plainPassword)
 
 	if err != nil {
 		return User{}, err
@@ -35,8 +77,9 @@ func (db *Database) CreateUser(email string, password string) (User, error) {
 	user = User{
 		Id:          newId,
 		Email:       email,
-		Password:    hashPass,
+		Password:    []byte(hashPass),
 		IsChirpyRed: false,
+		CreatedAt:   time.Now().UTC(),
 	}
 
 	log.Printf("New User:\n")
@@ -55,9 +98,29 @@ func (db *Database) CreateUser(email string, password string) (User, error) {
 		return User{}, err
 	}
 
+	db.userChanged(user)
 	return user, nil
 }
 
+// ReadAllUsers returns every user that hasn't been deleted, by ID.
+func (db *Database) ReadAllUsers() ([]User, error) {
+	var users []User
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return users, err
+	}
+
+	for _, user := range database.Users {
+		if !user.Deleted {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users, nil
+}
+
 func (db *Database) ReadUser(id int) (User, error) {
 	var user User
 	database, err := db.loadDatabase()
@@ -68,14 +131,14 @@ func (db *Database) ReadUser(id int) (User, error) {
 
 	user, ok := database.Users[id]
 
-	if !ok {
+	if !ok || user.Deleted {
 		return User{}, os.ErrNotExist
 	}
 
 	return user, nil
 }
 
-func (db *Database) AuthUser(email string, password string) (User, error) {
+func (db *Database) AuthUser(email string, plainPassword string) (User, error) {
 	database, err := db.loadDatabase()
 
 	if err != nil {
@@ -83,10 +146,14 @@ func (db *Database) AuthUser(email string, password string) (User, error) {
 	}
 
 	for _, user := range database.Users {
-		if user.Email == email {
-			err := bcrypt.CompareHashAndPassword(user.Password, []byte(password))
+		if user.Email == email && !user.Deleted {
+			err := password.Verify(string(user.Password), plainPassword)
 			if err != nil {
-				return User{}, bcrypt.ErrMismatchedHashAndPassword
+				return User{}, password.ErrMismatchedHashAndPassword
+			}
+
+			if db.hasher.NeedsRehash(string(user.Password)) {
+				db.rehashPassword(user.Id, user.Password, plainPassword)
 			}
 
 			user.Password = nil
@@ -97,8 +164,9 @@ func (db *Database) AuthUser(email string, password string) (User, error) {
 	return User{}, os.ErrNotExist
 }
 
-func (db *Database) UpdateUser(id int, email string, password string) (User, error) {
-	database, err := db.loadDatabase()
+func (db *Database) UpdateUser(id int, email string, plainPassword string) (User, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
 
 	if err != nil {
 		return User{}, err
@@ -110,10 +178,14 @@ func (db *Database) UpdateUser(id int, email string, password string) (User, err
 		return User{}, errors.New("user does not exist")
 	}
 
-	hashPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashPass, err := db.hasher.Hash(plainPassword)
+
+	if err != nil {
+		return User{}, err
+	}
 
 	user.Email = email
-	user.Password = hashPass
+	user.Password = []byte(hashPass)
 
 	log.Printf("Update User:\n")
 	log.Printf("Id: %v\n", user.Id)
@@ -127,27 +199,177 @@ func (db *Database) UpdateUser(id int, email string, password string) (User, err
 		return User{}, err
 	}
 
+	db.userChanged(user)
 	return user, nil
+}
 
+func (db *Database) UpdateProfile(id int, update ProfileUpdate) (User, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return User{}, os.ErrNotExist
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+
+	if update.AvatarUrl != nil {
+		user.AvatarUrl = *update.AvatarUrl
+	}
+
+	if update.Handle != nil {
+		// Handles are unique ignoring case, since that's how mentions match
+		if other, ok := findUserByHandle(&database, *update.Handle); ok && other.Id != id {
+			return User{}, ErrHandleTaken
+		}
+
+		user.Handle = *update.Handle
+	}
+
+	log.Printf("Update Profile:\n")
+	log.Printf("Id: %v\n", user.Id)
+	log.Printf("Display Name: %v\n", user.DisplayName)
+
+	database.Users[id] = user
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return User{}, err
+	}
+
+	db.userChanged(user)
+	return user, nil
 }
 
-func (db *Database) UpgradeUser(userId int) error {
-	database, err := db.loadDatabase()
+// CheckPassword confirms that password matches the stored hash for a user,
+// for actions that need the user to re-enter it.
+func (db *Database) CheckPassword(id int, plainPassword string) error {
+	user, err := db.ReadUser(id)
 
 	if err != nil {
-		log.Printf("Error loading database: %v\n", err.Error())
 		return err
 	}
 
-	user, err := db.ReadUser(userId)
+	return password.Verify(string(user.Password), plainPassword)
+}
+
+// rehashPassword upgrades a user's stored hash to the current hasher's
+// algorithm and parameters. It is only called after a successful login, and
+// failing to rehash never fails the login itself. The hash is only replaced
+// if it hasn't changed since the login checked it.
+func (db *Database) rehashPassword(id int, oldHash []byte, plainPassword string) {
+	hashPass, err := db.hasher.Hash(plainPassword)
+
+	if err != nil {
+		log.Printf("Error rehashing password: %v\n", err.Error())
+		return
+	}
+
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
 
 	if err != nil {
-		log.Printf("Error finding user: %v\n", err.Error())
+		log.Printf("Error rehashing password: %v\n", err.Error())
+		return
+	}
+
+	user, ok := database.Users[id]
+
+	if !ok || string(user.Password) != string(oldHash) {
+		return
+	}
+
+	user.Password = []byte(hashPass)
+	database.Users[id] = user
+
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return
+	}
+
+	log.Printf("Rehashed password for user %v\n", id)
+}
+
+func (db *Database) DeleteUser(id int, policy DeletionPolicy) error {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		log.Printf("Error loading database: %v\n", err.Error())
 		return err
 	}
 
-	user.IsChirpyRed = true
-	database.Users[userId] = user
+	user, ok := database.Users[id]
+
+	if !ok || user.Deleted {
+		return os.ErrNotExist
+	}
+
+	var removedChirps []Chirp
+	var removedAttachments []Attachment
+
+	switch policy {
+	case DeletionPolicyDelete:
+		delete(database.Users, id)
+
+		// Removing a chirp can also clean up tombstones, so look each one up
+		// again rather than trusting the range copy
+		for chirpId := range database.Chirps {
+			chirp, ok := database.Chirps[chirpId]
+
+			if ok && chirp.AuthorId == id && !chirp.Deleted {
+				removedAttachments = append(removedAttachments, removeChirp(&database, chirpId)...)
+				removedChirps = append(removedChirps, chirp)
+			}
+		}
+	case DeletionPolicyAnonymize:
+		database.Users[id] = User{
+			Id:      id,
+			Deleted: true,
+		}
+	default:
+		return fmt.Errorf("unknown deletion policy: %v", policy)
+	}
+
+	revokeUserSessions(&database, id)
+	revokeUserApiKeys(&database, id)
+	deleteUserWebhookEndpoints(&database, id)
+
+	// Queued after the user's own endpoints are gone, so only other
+	// subscribers hear about it
+	for _, chirp := range removedChirps {
+		db.queueChirpDeletedEvent(&database, chirp)
+	}
+
+	removeUserFollows(&database, id)
+	removeUserEngagement(&database, id)
+	removeUserVotes(&database, id)
+	removeUserLists(&database, id)
+	removeUserBookmarks(&database, id)
+	removeUserRelationships(&database, id)
+	removeUserNotifications(&database, id)
+	removedAttachments = append(removedAttachments, removeUserUnpublished(&database, id)...)
+	removedAttachments = append(removedAttachments, removeUserAttachments(&database, id)...)
+
+	log.Printf("Deleted User:\n")
+	log.Printf("Id: %v\n", id)
+	log.Printf("Policy: %v\n", policy)
+
 	err = db.writeDatabase(database)
 
 	if err != nil {
@@ -155,5 +377,15 @@ func (db *Database) UpgradeUser(userId int) error {
 		return err
 	}
 
+	for _, chirp := range removedChirps {
+		db.chirpDeleted(chirp)
+	}
+
+	for _, attachment := range removedAttachments {
+		db.attachmentDeleted(attachment)
+	}
+
+	db.userDeleted(id)
+
 	return nil
 }
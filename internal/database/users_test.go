@@ -0,0 +1,128 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ajpotts01/go-chirpy/internal/password"
+)
+
+func TestAuthUserRehashesPassword(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+
+	storedHash := func() string {
+		t.Helper()
+		user, err := db.ReadUser(users[0])
+
+		if err != nil {
+			t.Fatalf("ReadUser: %v", err)
+		}
+
+		return string(user.Password)
+	}
+
+	original := storedHash()
+
+	if _, err := db.AuthUser("user1@example.com", "password"); err != nil {
+		t.Fatalf("AuthUser: %v", err)
+	}
+
+	if storedHash() != original {
+		t.Fatalf("hash was replaced although the parameters are unchanged")
+	}
+
+	if _, err := db.AuthUser("user1@example.com", "wrong"); err != password.ErrMismatchedHashAndPassword {
+		t.Fatalf("AuthUser(wrong password) = %v, want ErrMismatchedHashAndPassword", err)
+	}
+
+	db.SetPasswordHasher(password.Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+
+	if _, err := db.AuthUser("user1@example.com", "wrong"); err == nil {
+		t.Fatalf("AuthUser accepted a wrong password")
+	}
+
+	if storedHash() != original {
+		t.Fatalf("hash was replaced after a failed login")
+	}
+
+	if _, err := db.AuthUser("user1@example.com", "password"); err != nil {
+		t.Fatalf("AuthUser after changing hasher: %v", err)
+	}
+
+	upgraded := storedHash()
+
+	if upgraded == original || db.hasher.NeedsRehash(upgraded) {
+		t.Fatalf("hash = %q, want it upgraded to argon2id", upgraded)
+	}
+
+	if _, err := db.AuthUser("user1@example.com", "password"); err != nil {
+		t.Fatalf("AuthUser with the upgraded hash: %v", err)
+	}
+
+	if storedHash() != upgraded {
+		t.Fatalf("hash was replaced again although it already uses the current parameters")
+	}
+}
+
+// testChirpDeletedEvents queues each removed chirp's ID.
+func testChirpDeletedEvents(chirp Chirp) (OutboundEvent, error) {
+	payload := `{"id":` + strconv.Itoa(chirp.Id) + `}`
+	return OutboundEvent{Event: "chirp.deleted", SubjectUserId: chirp.AuthorId, Public: true, Payload: []byte(payload)}, nil
+}
+
+func TestDeleteUserQueuesChirpDeletedEvents(t *testing.T) {
+	db := newTestDatabase(t)
+	db.SetChirpDeletedEventBuilder(testChirpDeletedEvents)
+	users := createTestUsers(t, db, 3)
+
+	endpoint, err := db.CreateWebhookEndpoint(AdminOwnerId, "https://example.com/hook", "secret", []string{"chirp.deleted"})
+
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %v", err)
+	}
+
+	_, err = db.CreateWebhookEndpoint(users[0], "https://example.com/own", "secret", []string{"chirp.deleted"})
+
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %v", err)
+	}
+
+	first := createTestChirp(t, db, users[0], "first", ChirpOptions{})
+	second := createTestChirp(t, db, users[0], "second", ChirpOptions{})
+	createTestChirp(t, db, users[1], "someone else's", ChirpOptions{})
+	createTestChirp(t, db, users[2], "anonymized", ChirpOptions{})
+
+	if err := db.DeleteUser(users[0], DeletionPolicyDelete); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	deliveries, err := db.ReadWebhookDeliveries(endpoint.Id)
+
+	if err != nil {
+		t.Fatalf("ReadWebhookDeliveries: %v", err)
+	}
+
+	payloads := map[string]bool{}
+
+	for _, delivery := range deliveries {
+		payloads[string(delivery.Payload)] = true
+	}
+
+	want := []string{`{"id":` + strconv.Itoa(first.Id) + `}`, `{"id":` + strconv.Itoa(second.Id) + `}`}
+
+	if len(deliveries) != 2 || !payloads[want[0]] || !payloads[want[1]] {
+		t.Fatalf("deliveries = %v, want one for each of the deleted user's chirps", payloads)
+	}
+
+	// Anonymized users' chirps stay up, so there's nothing to announce
+	if err := db.DeleteUser(users[2], DeletionPolicyAnonymize); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	deliveries, _ = db.ReadWebhookDeliveries(endpoint.Id)
+
+	if len(deliveries) != 2 {
+		t.Fatalf("anonymizing a user queued %v more deliveries", len(deliveries)-2)
+	}
+}
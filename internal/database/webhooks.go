@@ -0,0 +1,232 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+var ErrWebhookReplayed = errors.New("webhook has already been received")
+var ErrWebhookEventCompleted = errors.New("webhook event has already been processed")
+
+// WebhookNonce identifies a signed delivery, so an exact replay of it can be
+// rejected. It only needs keeping until ExpiresAt, after which the
+// delivery's timestamp is too old to be accepted anyway.
+type WebhookNonce struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// WebhookNonceSeen reports whether a signed delivery has already been
+// recorded. Nonces are recorded by ProcessWebhookEvent along with the
+// event's outcome, so this is only an early check.
+func (db *Database) WebhookNonceSeen(nonce string) (bool, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return false, err
+	}
+
+	expiry, ok := database.WebhookNonces[nonce]
+	return ok && time.Now().UTC().Before(expiry), nil
+}
+
+// useWebhookNonce records a nonce, returning false if it was already used,
+// and forgets any that have expired. It only modifies the loaded schema;
+// callers are responsible for writing it.
+func useWebhookNonce(database *DatabaseSchema, nonce WebhookNonce, now time.Time) bool {
+	if database.WebhookNonces == nil {
+		database.WebhookNonces = make(map[string]time.Time)
+	}
+
+	for seen, expiry := range database.WebhookNonces {
+		if now.After(expiry) {
+			delete(database.WebhookNonces, seen)
+		}
+	}
+
+	if _, ok := database.WebhookNonces[nonce.Value]; ok {
+		return false
+	}
+
+	database.WebhookNonces[nonce.Value] = nonce.ExpiresAt
+	return true
+}
+
+const (
+	WebhookOutcomeProcessed = "processed"
+	WebhookOutcomeIgnored   = "ignored"
+	WebhookOutcomeFailed    = "failed"
+)
+
+// WebhookEvent is an inbound webhook as received, along with what happened
+// when it was processed.
+type WebhookEvent struct {
+	Id          string          `json:"id"`
+	Provider    string          `json:"provider"`
+	Event       string          `json:"event"`
+	PayloadHash string          `json:"payload_hash"`
+	Payload     json.RawMessage `json:"payload"`
+	Outcome     string          `json:"outcome"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt time.Time       `json:"processed_at"`
+}
+
+// Completed reports whether the event needs no further processing.
+func (event WebhookEvent) Completed() bool {
+	return event.Outcome == WebhookOutcomeProcessed || event.Outcome == WebhookOutcomeIgnored
+}
+
+func (db *Database) ReadWebhookEvent(id string) (WebhookEvent, error) {
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return WebhookEvent{}, err
+	}
+
+	event, ok := database.WebhookEvents[id]
+
+	if !ok {
+		return WebhookEvent{}, os.ErrNotExist
+	}
+
+	return event, nil
+}
+
+// ReadWebhookEvents returns stored events, newest first. An empty outcome
+// returns events with any outcome.
+func (db *Database) ReadWebhookEvents(outcome string) ([]WebhookEvent, error) {
+	var events []WebhookEvent
+	database, err := db.loadDatabase()
+
+	if err != nil {
+		return events, err
+	}
+
+	for _, event := range database.WebhookEvents {
+		if outcome == "" || event.Outcome == outcome {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ReceivedAt.After(events[j].ReceivedAt) })
+	return events, nil
+}
+
+// ProcessWebhookEvent claims an inbound event, applies its subscription
+// change, if it has one, and stores the outcome under event.Id in a single
+// write, so concurrent deliveries of the same event can't both change the
+// subscription. ids are every form the event may have been stored under;
+// if any of them is already completed, that record is returned along with
+// ErrWebhookEventCompleted. A change that can't be applied is stored as a
+// failed outcome, and its error returned along with the stored event.
+//
+// Signed deliveries also pass their nonce, which is recorded in the same
+// write, so a delivery that couldn't be stored can still be retried. A nonce
+// that was already recorded returns ErrWebhookReplayed.
+func (db *Database) ProcessWebhookEvent(ids []string, event WebhookEvent, nonce *WebhookNonce, userId int, change *SubscriptionChange) (WebhookEvent, User, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return WebhookEvent{}, User{}, err
+	}
+
+	now := time.Now().UTC()
+
+	if nonce != nil && !useWebhookNonce(&database, *nonce, now) {
+		return WebhookEvent{}, User{}, ErrWebhookReplayed
+	}
+
+	for _, id := range ids {
+		existing, ok := database.WebhookEvents[id]
+
+		if ok && existing.Completed() {
+			return existing, User{}, ErrWebhookEventCompleted
+		}
+	}
+
+	event, user, applyErr := processWebhookEvent(&database, event, userId, change, now)
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return WebhookEvent{}, User{}, err
+	}
+
+	return event, user, applyErr
+}
+
+// ReplayWebhookEvent reprocesses a stored event whatever its previous
+// outcome was, storing the change and the new outcome in a single write.
+func (db *Database) ReplayWebhookEvent(event WebhookEvent, userId int, change *SubscriptionChange) (WebhookEvent, User, error) {
+	database, err := db.beginUpdate()
+	defer db.endUpdate()
+
+	if err != nil {
+		return WebhookEvent{}, User{}, err
+	}
+
+	event, user, applyErr := processWebhookEvent(&database, event, userId, change, time.Now().UTC())
+	err = db.writeDatabase(database)
+
+	if err != nil {
+		log.Printf("Error writing database: %v\n", err.Error())
+		return WebhookEvent{}, User{}, err
+	}
+
+	return event, user, applyErr
+}
+
+// processWebhookEvent applies an event's change, if it has one, and stores
+// the result of the attempt. The first attempt sets ReceivedAt; later
+// attempts keep it and bump Attempts. It only modifies the loaded schema;
+// callers are responsible for writing it.
+func processWebhookEvent(database *DatabaseSchema, event WebhookEvent, userId int, change *SubscriptionChange, now time.Time) (WebhookEvent, User, error) {
+	var err error
+	user, ok := database.Users[userId]
+
+	switch {
+	case change == nil:
+		event.Outcome = WebhookOutcomeIgnored
+	case !ok || user.Deleted:
+		event.Outcome = WebhookOutcomeFailed
+		event.Error = "user not found"
+		err = os.ErrNotExist
+	default:
+		user, err = applySubscriptionToUser(database, user, *change, now)
+
+		if err != nil {
+			event.Outcome = WebhookOutcomeFailed
+			event.Error = err.Error()
+		} else {
+			event.Outcome = WebhookOutcomeProcessed
+		}
+	}
+
+	if database.WebhookEvents == nil {
+		database.WebhookEvents = make(map[string]WebhookEvent)
+	}
+
+	event.ProcessedAt = now
+	event.Attempts = 1
+	event.ReceivedAt = now
+
+	if existing, ok := database.WebhookEvents[event.Id]; ok {
+		event.Attempts = existing.Attempts + 1
+		event.ReceivedAt = existing.ReceivedAt
+	}
+
+	database.WebhookEvents[event.Id] = event
+
+	if err != nil {
+		return event, User{}, err
+	}
+
+	return event, user, nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProcessWebhookEventRecordsNonce(t *testing.T) {
+	db := newTestDatabase(t)
+	users := createTestUsers(t, db, 1)
+	nonce := WebhookNonce{Value: "abc", ExpiresAt: time.Now().Add(time.Minute)}
+	change := &SubscriptionChange{Event: SubscriptionEventUpgraded}
+
+	// The first event fails, but its nonce is still recorded with the outcome
+	failed, _, err := db.ProcessWebhookEvent([]string{"evt_1"}, WebhookEvent{Id: "evt_1"}, &nonce, users[0]+1, change)
+
+	if err != os.ErrNotExist || failed.Outcome != WebhookOutcomeFailed {
+		t.Fatalf("ProcessWebhookEvent(unknown user) = %+v, %v, want a failed outcome and os.ErrNotExist", failed, err)
+	}
+
+	if seen, err := db.WebhookNonceSeen("abc"); err != nil || !seen {
+		t.Fatalf("WebhookNonceSeen = %v, %v, want true", seen, err)
+	}
+
+	_, _, err = db.ProcessWebhookEvent([]string{"evt_2"}, WebhookEvent{Id: "evt_2"}, &nonce, users[0], change)
+
+	if err != ErrWebhookReplayed {
+		t.Fatalf("ProcessWebhookEvent(replayed nonce) err = %v, want ErrWebhookReplayed", err)
+	}
+
+	if _, err := db.ReadWebhookEvent("evt_2"); err != os.ErrNotExist {
+		t.Fatalf("replayed event was stored: err = %v", err)
+	}
+}
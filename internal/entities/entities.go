@@ -0,0 +1,147 @@
+// Package entities finds mentions, hashtags and links in chirp bodies.
+// Offsets count characters (Unicode code points), not bytes, so clients can
+// index into the body the same way regardless of encoding.
+package entities
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	TypeMention = "mention"
+	TypeHashtag = "hashtag"
+	TypeUrl     = "url"
+)
+
+// Entity is one span of a chirp body. Start is inclusive and End exclusive.
+// Handle and Tag are normalised to lower case; UserId is filled in once a
+// mention has been resolved to a user.
+type Entity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`
+	Handle string `json:"handle,omitempty"`
+	UserId int    `json:"user_id,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Url    string `json:"url,omitempty"`
+}
+
+// Handles are what mentions refer to, so they share a pattern
+const MaxHandleLength = 15
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9_]{1,15})\b`)
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// Punctuation that usually ends a sentence rather than a URL
+const urlTrailing = ".,!?;:)]}'\""
+
+// ValidHandle reports whether handle can be used as a user's handle.
+func ValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle)
+}
+
+// NormaliseHandle returns the form handles are compared in.
+func NormaliseHandle(handle string) string {
+	return strings.ToLower(handle)
+}
+
+// NormaliseTag returns the form hashtags are compared in, without the #.
+func NormaliseTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// Parse returns the entities in body in order. Mentions and hashtags inside
+// URLs are ignored, as are ones glued to a preceding word (email addresses,
+// "C#"). Mentions are returned unresolved.
+func Parse(body string) []Entity {
+	var found []Entity
+	var taken [][]int
+
+	for _, match := range urlPattern.FindAllStringIndex(body, -1) {
+		start, end := match[0], match[1]
+		end = start + len(strings.TrimRight(body[start:end], urlTrailing))
+
+		if end-start <= len("https://") {
+			continue
+		}
+
+		url := body[start:end]
+		found = append(found, newEntity(body, TypeUrl, start, end, Entity{Url: url}))
+		taken = append(taken, []int{start, end})
+	}
+
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := match[0], match[1]
+
+		if !standsAlone(body, start) || overlaps(taken, start, end) {
+			continue
+		}
+
+		handle := NormaliseHandle(body[match[2]:match[3]])
+		found = append(found, newEntity(body, TypeMention, start, end, Entity{Handle: handle}))
+	}
+
+	for _, match := range hashtagPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := match[0], match[1]
+		tag := body[match[2]:match[3]]
+
+		if !standsAlone(body, start) || overlaps(taken, start, end) || !hasLetter(tag) {
+			continue
+		}
+
+		found = append(found, newEntity(body, TypeHashtag, start, end, Entity{Tag: NormaliseTag(tag)}))
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	return found
+}
+
+// newEntity fills in the type, text and character offsets for the byte
+// range start:end of body.
+func newEntity(body string, entityType string, start int, end int, entity Entity) Entity {
+	entity.Type = entityType
+	entity.Text = body[start:end]
+	entity.Start = utf8.RuneCountInString(body[:start])
+	entity.End = entity.Start + utf8.RuneCountInString(entity.Text)
+	return entity
+}
+
+// standsAlone reports whether the character before byte offset start is a
+// boundary, so that "me@example.com" isn't a mention.
+func standsAlone(body string, start int) bool {
+	if start == 0 {
+		return true
+	}
+
+	previous, _ := utf8.DecodeLastRuneInString(body[:start])
+	return !(unicode.IsLetter(previous) || unicode.IsNumber(previous) || previous == '_')
+}
+
+func overlaps(taken [][]int, start int, end int) bool {
+	for _, span := range taken {
+		if start < span[1] && end > span[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Purely numeric tags like #1 are usually list numbering, not hashtags
+func hasLetter(tag string) bool {
+	for _, r := range tag {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Entity
+	}{
+		{"nothing", "just words", nil},
+		{
+			"accented text before entities",
+			"héllo @Bob, #Café!",
+			[]Entity{
+				{Type: TypeMention, Start: 6, End: 10, Text: "@Bob", Handle: "bob"},
+				{Type: TypeHashtag, Start: 12, End: 17, Text: "#Café", Tag: "café"},
+			},
+		},
+		{
+			"emoji and non-Latin tags",
+			"🎉🎉 @zoe_ #日本語 x",
+			[]Entity{
+				{Type: TypeMention, Start: 3, End: 8, Text: "@zoe_", Handle: "zoe_"},
+				{Type: TypeHashtag, Start: 9, End: 13, Text: "#日本語", Tag: "日本語"},
+			},
+		},
+		{
+			"url swallows mentions and tags",
+			"see https://example.com/ü?q=@bob#top.",
+			[]Entity{
+				{Type: TypeUrl, Start: 4, End: 36, Text: "https://example.com/ü?q=@bob#top", Url: "https://example.com/ü?q=@bob#top"},
+			},
+		},
+		{"bare scheme", "https:// is not a link", nil},
+		{"email address", "mail me@example.com", nil},
+		{"glued hashtag", "I write C# and F#", nil},
+		{"numbered list", "#1 and #2", nil},
+		{"handle too long", "@abcdefghijklmnopq", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Parse(test.body)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{"alice", true},
+		{"Alice_99", true},
+		{"abcdefghijklmno", true},
+		{"abcdefghijklmnop", false},
+		{"", false},
+		{"al ice", false},
+		{"zoë", false},
+		{"@alice", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidHandle(test.handle); got != test.want {
+			t.Errorf("ValidHandle(%q) = %v, want %v", test.handle, got, test.want)
+		}
+	}
+}
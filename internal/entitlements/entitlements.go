@@ -0,0 +1,88 @@
+// Package entitlements describes what each subscription plan is allowed to
+// do. Plan definitions can be loaded from a JSON config file so limits can
+// change without a code change.
+package entitlements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+const FreePlan = database.PlanFree
+
+type Plan struct {
+	Name              string `json:"name"`
+	MaxChirpLength    int    `json:"max_chirp_length"`
+	CanEditChirps     bool   `json:"can_edit_chirps"`
+	CanScheduleChirps bool   `json:"can_schedule_chirps"`
+	RequestsPerMinute int    `json:"requests_per_minute"`
+}
+
+// Plans maps plan names, as stored on subscriptions, to their limits.
+type Plans map[string]Plan
+
+// Default returns the built-in plans, used when no config file is given.
+func Default() Plans {
+	return Plans{
+		FreePlan: {
+			Name:              FreePlan,
+			MaxChirpLength:    140,
+			CanEditChirps:     false,
+			CanScheduleChirps: false,
+			RequestsPerMinute: 30,
+		},
+		database.PlanChirpyRed: {
+			Name:              database.PlanChirpyRed,
+			MaxChirpLength:    280,
+			CanEditChirps:     true,
+			CanScheduleChirps: true,
+			RequestsPerMinute: 120,
+		},
+	}
+}
+
+// Load reads plan definitions from a JSON file shaped like
+// {"free": {"max_chirp_length": 140, ...}, "chirpy_red": {...}}.
+// A free plan must be defined, as it applies to anyone without a paid plan.
+func Load(path string) (Plans, error) {
+	rawData, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plans := Plans{}
+	err = json.Unmarshal(rawData, &plans)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse plans config: %w", err)
+	}
+
+	if _, ok := plans[FreePlan]; !ok {
+		return nil, errors.New("plans config must define a free plan")
+	}
+
+	for name, plan := range plans {
+		if plan.MaxChirpLength <= 0 || plan.RequestsPerMinute <= 0 {
+			return nil, fmt.Errorf("plan %v must have a positive max_chirp_length and requests_per_minute", name)
+		}
+
+		plan.Name = name
+		plans[name] = plan
+	}
+
+	return plans, nil
+}
+
+// For returns the named plan. Unknown plans get the free plan's limits.
+func (plans Plans) For(name string) Plan {
+	if plan, ok := plans[name]; ok {
+		return plan
+	}
+
+	return plans[FreePlan]
+}
@@ -0,0 +1,99 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Every frame of an animated GIF is decoded into memory at once, so frames
+// are limited as well as their total size
+const maxGifFrames = 500
+
+var ErrTooManyFrames = errors.New("animated GIFs may have at most 500 frames")
+
+const (
+	gifExtension  = 0x21
+	gifImageBlock = 0x2C
+	gifTrailer    = 0x3B
+)
+
+// checkGifFrames walks the blocks of a GIF without decoding any pixels, and
+// rejects it if decoding every frame would take more than maxGifFrames
+// frames or maxPixels pixels in total. DecodeConfig only looks at the
+// first frame, so it can't catch a small file with thousands of frames.
+func checkGifFrames(data []byte) error {
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return ErrInvalidImage
+	}
+
+	pos := 13
+	pos += colorTableSize(data[10])
+	frames := 0
+	pixels := 0
+
+	// Anything left undecodable is for the decoder to reject; this only
+	// needs to count what it would allocate
+	for pos < len(data) {
+		switch data[pos] {
+		case gifTrailer:
+			return nil
+		case gifExtension:
+			// Introducer and label, then data sub-blocks
+			pos = skipSubBlocks(data, pos+2)
+		case gifImageBlock:
+			if pos+10 > len(data) {
+				return ErrInvalidImage
+			}
+
+			width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			frames += 1
+			pixels += width * height
+
+			if frames > maxGifFrames {
+				return ErrTooManyFrames
+			}
+
+			if pixels > maxPixels {
+				return ErrTooManyPixels
+			}
+
+			pos += 10 + colorTableSize(data[pos+9])
+
+			// LZW minimum code size, then the image data sub-blocks
+			pos = skipSubBlocks(data, pos+1)
+		default:
+			return ErrInvalidImage
+		}
+	}
+
+	return nil
+}
+
+// colorTableSize is the size in bytes of the colour table a screen or image
+// descriptor's packed field says follows it.
+func colorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipSubBlocks returns the position after a chain of data sub-blocks
+// starting at pos, or len(data) if the data runs out first.
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos += 1
+
+		if size == 0 {
+			return pos
+		}
+
+		pos += size
+	}
+
+	return len(data)
+}
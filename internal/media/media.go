@@ -0,0 +1,258 @@
+// Package media validates uploaded images and prepares them for serving.
+// Every image is decoded and re-encoded, which drops EXIF and any other
+// metadata (camera details, GPS position) along with anything that isn't
+// really an image.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const MaxUploadSize = 5 << 20
+
+// Checked before decoding so a small file can't expand into a huge bitmap
+const maxDimension = 10000
+const maxPixels = 40_000_000
+
+// Thumbnails fit within a square this many pixels across
+const ThumbnailSize = 320
+
+const jpegQuality = 90
+const thumbnailQuality = 80
+
+var ErrTooLarge = errors.New("file is too large")
+var ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are supported")
+var ErrTooManyPixels = errors.New("image dimensions are too large")
+var ErrInvalidImage = errors.New("file is not a valid image")
+
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+type Processed struct {
+	Original  Image
+	Thumbnail Image
+}
+
+// Process checks an upload and returns a cleaned copy plus a thumbnail. The
+// type is sniffed from the data; whatever the client claimed is ignored.
+func Process(data []byte) (Processed, error) {
+	if len(data) > MaxUploadSize {
+		return Processed{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return Processed{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return Processed{}, ErrInvalidImage
+	}
+
+	if config.Width > maxDimension || config.Height > maxDimension || config.Width*config.Height > maxPixels {
+		return Processed{}, ErrTooManyPixels
+	}
+
+	if contentType == "image/gif" {
+		err = checkGifFrames(data)
+
+		if err != nil {
+			return Processed{}, err
+		}
+	}
+
+	var processed Processed
+	var first image.Image
+
+	switch contentType {
+	case "image/gif":
+		processed.Original, first, err = cleanGif(data)
+	case "image/png":
+		processed.Original, first, err = cleanPng(data)
+	default:
+		processed.Original, first, err = cleanJpeg(data)
+	}
+
+	if err != nil {
+		return Processed{}, err
+	}
+
+	processed.Thumbnail, err = thumbnail(first, contentType != "image/jpeg")
+
+	if err != nil {
+		return Processed{}, err
+	}
+
+	return processed, nil
+}
+
+// cleanJpeg re-encodes a JPEG, first turning it the right way up, since the
+// EXIF orientation that says how to display it is about to be dropped.
+func cleanJpeg(data []byte) (Image, image.Image, error) {
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return Image{}, nil, ErrInvalidImage
+	}
+
+	oriented := orient(toRGBA(decoded), exifOrientation(data))
+
+	var encoded bytes.Buffer
+	err = jpeg.Encode(&encoded, oriented, &jpeg.Options{Quality: jpegQuality})
+
+	if err != nil {
+		return Image{}, nil, err
+	}
+
+	return newImage("image/jpeg", encoded.Bytes(), oriented), oriented, nil
+}
+
+func cleanPng(data []byte) (Image, image.Image, error) {
+	decoded, err := png.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return Image{}, nil, ErrInvalidImage
+	}
+
+	var encoded bytes.Buffer
+	err = png.Encode(&encoded, decoded)
+
+	if err != nil {
+		return Image{}, nil, err
+	}
+
+	return newImage("image/png", encoded.Bytes(), decoded), decoded, nil
+}
+
+// cleanGif keeps every frame so animations survive. Comments and
+// application extensions other than looping are not written back.
+func cleanGif(data []byte) (Image, image.Image, error) {
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+
+	if err != nil || len(decoded.Image) == 0 {
+		return Image{}, nil, ErrInvalidImage
+	}
+
+	var encoded bytes.Buffer
+	err = gif.EncodeAll(&encoded, decoded)
+
+	if err != nil {
+		return Image{}, nil, err
+	}
+
+	result := Image{
+		ContentType: "image/gif",
+		Data:        encoded.Bytes(),
+		Width:       decoded.Config.Width,
+		Height:      decoded.Config.Height,
+	}
+
+	return result, decoded.Image[0], nil
+}
+
+func newImage(contentType string, data []byte, img image.Image) Image {
+	bounds := img.Bounds()
+	return Image{ContentType: contentType, Data: data, Width: bounds.Dx(), Height: bounds.Dy()}
+}
+
+// thumbnail scales img to fit within ThumbnailSize, never enlarging it.
+// Images that may be transparent keep their alpha as PNGs.
+func thumbnail(img image.Image, keepAlpha bool) (Image, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			height = max(1, height*ThumbnailSize/width)
+			width = ThumbnailSize
+		} else {
+			width = max(1, width*ThumbnailSize/height)
+			height = ThumbnailSize
+		}
+	}
+
+	scaled := scale(toRGBA(img), width, height)
+
+	var encoded bytes.Buffer
+	var err error
+	contentType := "image/jpeg"
+
+	if keepAlpha {
+		contentType = "image/png"
+		err = png.Encode(&encoded, scaled)
+	} else {
+		err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: thumbnailQuality})
+	}
+
+	if err != nil {
+		return Image{}, err
+	}
+
+	return newImage(contentType, encoded.Bytes(), scaled), nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// scale resizes by averaging the block of source pixels behind each
+// destination pixel, which is good enough for shrinking. Pixels are
+// premultiplied, so transparent areas don't bleed colour.
+func scale(src *image.RGBA, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var sum [4]int
+			count := 0
+
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[offset+c])
+					}
+					offset += 4
+					count++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	return dst
+}
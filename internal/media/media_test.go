@@ -0,0 +1,189 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePng(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, image.NewNRGBA(image.Rect(0, 0, width, height)))
+
+	if err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func encodeJpeg(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+
+	if err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func encodeGif(t *testing.T, width int, height int, frames int) []byte {
+	t.Helper()
+
+	animation := &gif.GIF{}
+	palette := color.Palette{color.Black, color.White}
+
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buffer bytes.Buffer
+	err := gif.EncodeAll(&buffer, animation)
+
+	if err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// rawGif writes a GIF's block structure by hand, so frames can claim sizes
+// that would be too slow to really encode. The image data is not valid LZW.
+func rawGif(width uint16, height uint16, frames int) []byte {
+	data := []byte("GIF89a")
+	data = binary.LittleEndian.AppendUint16(data, width)
+	data = binary.LittleEndian.AppendUint16(data, height)
+	data = append(data, 0, 0, 0)
+
+	// A comment extension, which has to be skipped over
+	data = append(data, gifExtension, 0xFE, 2, 'h', 'i', 0)
+
+	for i := 0; i < frames; i++ {
+		data = append(data, gifImageBlock, 0, 0, 0, 0)
+		data = binary.LittleEndian.AppendUint16(data, width)
+		data = binary.LittleEndian.AppendUint16(data, height)
+		data = append(data, 0x80, 0, 0, 0, 0xFF, 0xFF, 0xFF)
+		data = append(data, 2, 3, 1, 2, 3, 0)
+	}
+
+	return append(data, gifTrailer)
+}
+
+// withOrientation inserts an EXIF segment with the given orientation after
+// a JPEG's start of image marker.
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, orientationTag)
+	tiff = append(tiff, 0, 3, 0, 0, 0, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	return append(result, data[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		wantErr     error
+		contentType string
+		width       int
+		height      int
+		thumbType   string
+		thumbWidth  int
+		thumbHeight int
+	}{
+		{"png", encodePng(t, 640, 480), nil, "image/png", 640, 480, "image/png", 320, 240},
+		{"small png isn't enlarged", encodePng(t, 10, 20), nil, "image/png", 10, 20, "image/png", 10, 20},
+		{"jpeg", encodeJpeg(t, 400, 800), nil, "image/jpeg", 400, 800, "image/jpeg", 160, 320},
+		{"rotated jpeg", withOrientation(encodeJpeg(t, 40, 20), 6), nil, "image/jpeg", 20, 40, "image/jpeg", 20, 40},
+		{"animated gif", encodeGif(t, 8, 8, 3), nil, "image/gif", 8, 8, "image/png", 8, 8},
+		{"text", []byte("hello, world"), ErrUnsupportedType, "", 0, 0, "", 0, 0},
+		{"too large", append(encodePng(t, 1, 1), make([]byte, MaxUploadSize)...), ErrTooLarge, "", 0, 0, "", 0, 0},
+		{"truncated png", encodePng(t, 64, 64)[:60], ErrInvalidImage, "", 0, 0, "", 0, 0},
+		{"too wide", rawGif(maxDimension+1, 1, 1), ErrTooManyPixels, "", 0, 0, "", 0, 0},
+		{"too many frames", encodeGif(t, 1, 1, maxGifFrames+1), ErrTooManyFrames, "", 0, 0, "", 0, 0},
+		{"too many frame pixels", rawGif(4500, 4500, 2), ErrTooManyPixels, "", 0, 0, "", 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processed, err := Process(test.data)
+
+			if err != test.wantErr {
+				t.Fatalf("Process err = %v, want %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			original := processed.Original
+
+			if original.ContentType != test.contentType || original.Width != test.width || original.Height != test.height {
+				t.Errorf("original = %v %vx%v, want %v %vx%v", original.ContentType, original.Width, original.Height, test.contentType, test.width, test.height)
+			}
+
+			thumb := processed.Thumbnail
+
+			if thumb.ContentType != test.thumbType || thumb.Width != test.thumbWidth || thumb.Height != test.thumbHeight {
+				t.Errorf("thumbnail = %v %vx%v, want %v %vx%v", thumb.ContentType, thumb.Width, thumb.Height, test.thumbType, test.thumbWidth, test.thumbHeight)
+			}
+		})
+	}
+}
+
+func TestProcessStripsExif(t *testing.T) {
+	processed, err := Process(withOrientation(encodeJpeg(t, 8, 8), 3))
+
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	if bytes.Contains(processed.Original.Data, []byte("Exif")) || exifOrientation(processed.Original.Data) != 1 {
+		t.Fatalf("EXIF survived re-encoding")
+	}
+}
+
+func TestCheckGifFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"one frame", rawGif(100, 100, 1), nil},
+		{"frame limit", rawGif(1, 1, maxGifFrames), nil},
+		{"over the frame limit", rawGif(1, 1, maxGifFrames+1), ErrTooManyFrames},
+		{"over the pixel budget", rawGif(4000, 4000, 3), ErrTooManyPixels},
+		{"no trailer", bytes.TrimSuffix(rawGif(1, 1, 1), []byte{gifTrailer}), nil},
+		{"truncated frame", rawGif(1, 1, 1)[:22], ErrInvalidImage},
+		{"short header", []byte("GIF89a"), ErrInvalidImage},
+		{"unknown block", append(rawGif(1, 1, 1)[:13], 0x99), ErrInvalidImage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := checkGifFrames(test.data); err != test.want {
+				t.Fatalf("checkGifFrames = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package moderation holds the profanity filter and the tokenizer search
+// uses, which share a word list so a word the filter hides can never be
+// searched for.
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+const censor = "****"
+
+var profanity = map[string]struct{}{
+	"kerfuffle": {},
+	"sharbert":  {},
+	"fornax":    {},
+}
+
+// Token is one whitespace-separated word of a text. Word is the word as
+// written; Term is its searchable form, lower case with surrounding
+// punctuation removed. Start and End are byte offsets into the text.
+type Token struct {
+	Word  string
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into words on whitespace.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+
+	for i, r := range text + " " {
+		if !unicode.IsSpace(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 {
+			word := text[start:i]
+			tokens = append(tokens, Token{Word: word, Term: term(word), Start: start, End: i})
+			start = -1
+		}
+	}
+
+	return tokens
+}
+
+func term(word string) string {
+	trimmed := strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	return strings.ToLower(trimmed)
+}
+
+// IsProfane reports whether a term is on the filter's list.
+func IsProfane(term string) bool {
+	_, ok := profanity[term]
+	return ok
+}
+
+// Censor replaces profane words in body. Words are split on spaces alone,
+// as they always have been, so "Kerfuffle" is censored but "kerfuffle!" and
+// a kerfuffle after a line break are not; search ignores all of them.
+func Censor(body string) string {
+	words := strings.Split(body, " ")
+
+	for i, word := range words {
+		if IsProfane(strings.ToLower(word)) {
+			words[i] = censor
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,41 @@
+package moderation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCensor(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"what a kerfuffle", "what a ****"},
+		{"Sharbert and FORNAX", "**** and ****"},
+		{"kerfuffle! is fine", "kerfuffle! is fine"},
+		{"hi\nkerfuffle", "hi\nkerfuffle"},
+		{"tab\tkerfuffle", "tab\tkerfuffle"},
+		{"two  spaces kerfuffle ", "two  spaces **** "},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Censor(test.body); got != test.want {
+			t.Errorf("Censor(%q) = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize(" Héllo,\nwörld!  #Go ")
+
+	want := []Token{
+		{Word: "Héllo,", Term: "héllo", Start: 1, End: 8},
+		{Word: "wörld!", Term: "wörld", Start: 9, End: 16},
+		{Word: "#Go", Term: "go", Start: 18, End: 21},
+	}
+
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("Tokenize = %+v, want %+v", tokens, want)
+	}
+}
@@ -0,0 +1,78 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"0.1.2.3", false},
+		{"0.255.255.255", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b:1::1", false},
+		{"192.0.0.1", false},
+		{"192.0.0.255", false},
+		{"192.0.1.1", true},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"198.20.0.1", true},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"192.0.2.1", false},
+		{"2001:db8::1", false},
+		{"::ffff:198.18.0.1", false},
+	}
+
+	for _, test := range tests {
+		if got := IsPublic(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("IsPublic(%v) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second, false).Get(server.URL)
+
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Get with private addresses refused = %v, want ErrBlockedAddress", err)
+	}
+
+	response, err := NewClient(time.Second, true).Get(server.URL)
+
+	if err != nil {
+		t.Fatalf("Get with private addresses allowed: %v", err)
+	}
+
+	response.Body.Close()
+}
@@ -0,0 +1,175 @@
+// Package outbound delivers Chirpy events to registered webhook endpoints.
+// Deliveries are queued in the database, so they survive restarts, and are
+// retried with exponential backoff until they succeed or run out of attempts.
+package outbound
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/netguard"
+)
+
+const EventHeader = "X-Chirpy-Event"
+const DeliveryHeader = "X-Chirpy-Delivery"
+const TimestampHeader = "X-Chirpy-Timestamp"
+const SignatureHeader = "X-Chirpy-Signature"
+
+const MaxAttempts = 8
+const baseBackoff = 30 * time.Second
+const maxBackoff = 6 * time.Hour
+
+const deliveryTimeout = 10 * time.Second
+const batchSize = 20
+
+type Dispatcher struct {
+	db       *database.Database
+	interval time.Duration
+	// User-registered endpoints may not point at private networks; admin
+	// endpoints are trusted and may target internal services.
+	userClient  *http.Client
+	adminClient *http.Client
+}
+
+func NewDispatcher(db *database.Database, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		interval:    interval,
+		userClient:  netguard.NewClient(deliveryTimeout, false),
+		adminClient: netguard.NewClient(deliveryTimeout, true),
+	}
+}
+
+// Sign returns the signature header value for a delivery: an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the endpoint's secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying after the given number
+// of failed attempts.
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return backoff
+}
+
+// Run sends due deliveries every interval, for the life of the server.
+func (dispatcher *Dispatcher) Run() {
+	ticker := time.NewTicker(dispatcher.interval)
+	defer ticker.Stop()
+
+	for {
+		dispatcher.dispatchDue()
+		<-ticker.C
+	}
+}
+
+func (dispatcher *Dispatcher) dispatchDue() {
+	due, err := dispatcher.db.DueWebhookDeliveries(time.Now().UTC(), batchSize)
+
+	if err != nil {
+		log.Printf("Error loading webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range due {
+		endpoint, err := dispatcher.db.ReadWebhookEndpoint(delivery.EndpointId)
+
+		if err == os.ErrNotExist {
+			// Deleting an endpoint removes its deliveries, but one loaded just
+			// before would otherwise stay pending and come back every tick
+			log.Printf("Failing delivery %v: endpoint %v no longer exists", delivery.Id, delivery.EndpointId)
+			_, err = dispatcher.db.RecordDeliveryAttempt(delivery.Id, database.DeliveryAttempt{Error: "endpoint no longer exists"})
+
+			if err != nil && err != os.ErrNotExist {
+				log.Printf("Error recording delivery %v: %v", delivery.Id, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Skipping delivery %v: %v", delivery.Id, err)
+			continue
+		}
+
+		attempt := dispatcher.send(endpoint, delivery)
+
+		if !attempt.Succeeded && delivery.Attempts+1 < MaxAttempts {
+			attempt.NextAttemptAt = time.Now().UTC().Add(Backoff(delivery.Attempts + 1))
+		}
+
+		_, err = dispatcher.db.RecordDeliveryAttempt(delivery.Id, attempt)
+
+		if err != nil {
+			log.Printf("Error recording delivery %v: %v", delivery.Id, err)
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) send(endpoint database.WebhookEndpoint, delivery database.WebhookDelivery) database.DeliveryAttempt {
+	client := dispatcher.userClient
+
+	if endpoint.OwnerId == database.AdminOwnerId {
+		client = dispatcher.adminClient
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, endpoint.Url, bytes.NewReader(delivery.Payload))
+
+	if err != nil {
+		return database.DeliveryAttempt{Error: err.Error()}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		log.Printf("Webhook delivery %v to %v failed: %v", delivery.Id, endpoint.Url, err)
+		return database.DeliveryAttempt{Error: err.Error()}
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("Webhook delivery %v to %v got %v", delivery.Id, endpoint.Url, resp.StatusCode)
+		return database.DeliveryAttempt{
+			StatusCode: resp.StatusCode,
+			Error:      fmt.Sprintf("unexpected status: %v", resp.Status),
+		}
+	}
+
+	log.Printf("Webhook delivery %v to %v succeeded", delivery.Id, endpoint.Url)
+	return database.DeliveryAttempt{
+		Succeeded:  true,
+		StatusCode: resp.StatusCode,
+	}
+}
@@ -0,0 +1,102 @@
+package outbound
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{20, maxBackoff},
+	}
+
+	for _, test := range tests {
+		if got := Backoff(test.attempts); got != test.want {
+			t.Errorf("Backoff(%v) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestDispatchDue(t *testing.T) {
+	received := make(chan *http.Request, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+
+		if r.Header.Get(SignatureHeader) != Sign("secret", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		received <- r
+	}))
+	defer server.Close()
+
+	// Endpoint 2 is gone but still has a pending delivery, as happens when
+	// it's deleted after the dispatcher has loaded the delivery
+	path := filepath.Join(t.TempDir(), "database.json")
+	fixture := `{
+		"webhook_endpoints": {"1": {"id": 1, "owner_id": 0, "url": "` + server.URL + `", "secret": "secret", "events": ["chirp.created"]}},
+		"webhook_deliveries": {
+			"1": {"id": 1, "endpoint_id": 1, "event": "chirp.created", "payload": {}, "status": "pending"},
+			"2": {"id": 2, "endpoint_id": 2, "event": "chirp.created", "payload": {}, "status": "pending"}
+		}
+	}`
+
+	err := os.WriteFile(path, []byte(fixture), 0600)
+
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	db, err := database.NewDatabase(path)
+
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+
+	dispatcher := NewDispatcher(db, time.Hour)
+	dispatcher.dispatchDue()
+
+	select {
+	case r := <-received:
+		if r.Header.Get(EventHeader) != "chirp.created" || r.Header.Get(DeliveryHeader) != "1" {
+			t.Errorf("delivery headers = %v", r.Header)
+		}
+	default:
+		t.Fatalf("delivery 1 wasn't sent")
+	}
+
+	for endpointId, want := range map[int]string{1: database.DeliverySucceeded, 2: database.DeliveryFailed} {
+		deliveries, err := db.ReadWebhookDeliveries(endpointId)
+
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("ReadWebhookDeliveries(%v) = %v, %v", endpointId, deliveries, err)
+		}
+
+		if deliveries[0].Status != want {
+			t.Errorf("delivery to endpoint %v is %v, want %v", endpointId, deliveries[0].Status, want)
+		}
+	}
+
+	due, err := db.DueWebhookDeliveries(time.Now().UTC(), batchSize)
+
+	if err != nil || len(due) != 0 {
+		t.Fatalf("DueWebhookDeliveries = %v, %v, want none left", due, err)
+	}
+}
@@ -0,0 +1,143 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+var errBadArgon2idHash = errors.New("malformed argon2id hash")
+
+// Argon2id hashes are stored in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2id struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id follows the OWASP recommended minimums for argon2id.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.Memory,
+		a.Iterations,
+		a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return encoded, nil
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	if !isArgon2id(encoded) {
+		return true
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != a.Memory ||
+		params.Iterations != a.Iterations ||
+		params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength ||
+		uint32(len(key)) != a.KeyLength
+}
+
+func isArgon2id(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func verifyArgon2id(encoded string, password string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+
+	return nil
+}
+
+func decodeArgon2id(encoded string) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+	var version int
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 {
+		return params, nil, nil, errBadArgon2idHash
+	}
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+
+	if err != nil {
+		return params, nil, nil, errBadArgon2idHash
+	}
+
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+
+	if err != nil {
+		return params, nil, nil, errBadArgon2idHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return params, nil, nil, errBadArgon2idHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return params, nil, nil, errBadArgon2idHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
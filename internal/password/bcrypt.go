@@ -0,0 +1,67 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes are stored in their standard $2a$<cost>$... form, which
+// already records the cost.
+type Bcrypt struct {
+	Cost int
+}
+
+// NewBcrypt returns a bcrypt Hasher. A cost of 0 uses bcrypt.DefaultCost.
+func NewBcrypt(cost int) (Bcrypt, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return Bcrypt{}, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return Bcrypt{Cost: cost}, nil
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	if err != nil {
+		return true
+	}
+
+	return cost != b.Cost
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func verifyBcrypt(encoded string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrMismatchedHashAndPassword
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrMismatchedHashAndPassword = errors.New("password does not match")
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Hasher produces password hashes that carry their own algorithm and
+// parameters, so hashes from older settings can still be verified.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether encoded was produced by a different
+	// algorithm, or with different parameters, to the ones this Hasher uses.
+	NeedsRehash(encoded string) bool
+}
+
+// Verify checks password against an encoded hash produced by any supported
+// Hasher. It returns ErrMismatchedHashAndPassword if they don't match.
+func Verify(encoded string, password string) error {
+	switch {
+	case isArgon2id(encoded):
+		return verifyArgon2id(encoded, password)
+	case isBcrypt(encoded):
+		return verifyBcrypt(encoded, password)
+	default:
+		return ErrUnknownAlgorithm
+	}
+}
+
+// NewHasher returns a Hasher with default parameters for the named algorithm.
+func NewHasher(algorithm string, bcryptCost int) (Hasher, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "argon2id":
+		return DefaultArgon2id(), nil
+	case "bcrypt":
+		return NewBcrypt(bcryptCost)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAlgorithm, algorithm)
+	}
+}
@@ -0,0 +1,140 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Small parameters keep the tests quick; the format is the same
+var testArgon2id = Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// A bcrypt hash of "hunter2" from before argon2id became the default
+const legacyBcrypt = "$2a$04$7ME8v7aBeaS1Zm8bOYohf.k7eQmkEQ9ntQaz4gokyaiEjmZaJbv1K"
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	encoded, err := testArgon2id.Hash("hunter2")
+
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, want a PHC string recording the parameters", encoded)
+	}
+
+	if err := Verify(encoded, "hunter2"); err != nil {
+		t.Fatalf("Verify(correct password): %v", err)
+	}
+
+	if err := Verify(encoded, "hunter3"); err != ErrMismatchedHashAndPassword {
+		t.Fatalf("Verify(wrong password) = %v, want ErrMismatchedHashAndPassword", err)
+	}
+
+	other, _ := testArgon2id.Hash("hunter2")
+
+	if other == encoded {
+		t.Fatalf("two hashes of the same password are identical, so the salt isn't random")
+	}
+}
+
+func TestVerifyMalformedArgon2id(t *testing.T) {
+	valid, err := testArgon2id.Hash("hunter2")
+
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	parts := strings.Split(valid, "$")
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"missing key", strings.Join(parts[:5], "$")},
+		{"extra field", valid + "$extra"},
+		{"bad version", strings.Replace(valid, "v=19", "v=nineteen", 1)},
+		{"unsupported version", strings.Replace(valid, "v=19", "v=16", 1)},
+		{"bad parameters", strings.Replace(valid, "m=64,t=1,p=1", "m=64;t=1;p=1", 1)},
+		{"bad salt", strings.Replace(valid, parts[4], "!!!", 1)},
+		{"bad key", strings.Replace(valid, parts[5], "!!!", 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify(test.encoded, "hunter2")
+
+			if err == nil || err == ErrMismatchedHashAndPassword {
+				t.Fatalf("Verify(%q) = %v, want a malformed hash error", test.encoded, err)
+			}
+
+			if !testArgon2id.NeedsRehash(test.encoded) {
+				t.Fatalf("NeedsRehash(%q) = false, want true", test.encoded)
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	if err := Verify(legacyBcrypt, "hunter2"); err != nil {
+		t.Fatalf("Verify(correct password): %v", err)
+	}
+
+	if err := Verify(legacyBcrypt, "hunter3"); err != ErrMismatchedHashAndPassword {
+		t.Fatalf("Verify(wrong password) = %v, want ErrMismatchedHashAndPassword", err)
+	}
+
+	if err := Verify("plaintext", "plaintext"); err != ErrUnknownAlgorithm {
+		t.Fatalf("Verify(unknown format) = %v, want ErrUnknownAlgorithm", err)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, err := testArgon2id.Hash("hunter2")
+
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	stronger := testArgon2id
+	stronger.Iterations = 2
+	longerKey := testArgon2id
+	longerKey.KeyLength = 64
+
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		encoded string
+		want    bool
+	}{
+		{"same argon2id parameters", testArgon2id, current, false},
+		{"more iterations", stronger, current, true},
+		{"longer key", longerKey, current, true},
+		{"bcrypt to argon2id", testArgon2id, legacyBcrypt, true},
+		{"same bcrypt cost", Bcrypt{Cost: 4}, legacyBcrypt, false},
+		{"higher bcrypt cost", Bcrypt{Cost: 5}, legacyBcrypt, true},
+		{"argon2id to bcrypt", Bcrypt{Cost: 4}, current, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.encoded); got != test.want {
+				t.Fatalf("NeedsRehash = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	if hasher, err := NewHasher("", 0); err != nil || hasher != DefaultArgon2id() {
+		t.Fatalf("NewHasher(\"\") = %v, %v, want the default argon2id", hasher, err)
+	}
+
+	if _, err := NewHasher("bcrypt", 99); err == nil {
+		t.Fatalf("NewHasher accepted an out of range bcrypt cost")
+	}
+
+	if _, err := NewHasher("md5", 0); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Fatalf("NewHasher(md5) = %v, want ErrUnknownAlgorithm", err)
+	}
+}
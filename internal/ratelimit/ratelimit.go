@@ -0,0 +1,59 @@
+// Package ratelimit provides an in-memory token bucket rate limiter keyed
+// by user, where each user's limit can differ.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type Limiter struct {
+	mux     *sync.Mutex
+	buckets map[int]*bucket
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		mux:     &sync.Mutex{},
+		buckets: make(map[int]*bucket),
+	}
+}
+
+// Allow takes a token from the user's bucket, which refills at perMinute
+// tokens a minute and holds at most perMinute. If the bucket is empty it
+// returns false and how long until the next token is available.
+func (limiter *Limiter) Allow(userId int, perMinute int) (bool, time.Duration) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	now := time.Now()
+	capacity := float64(perMinute)
+	refillRate := capacity / time.Minute.Seconds()
+
+	b, ok := limiter.buckets[userId]
+
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		limiter.buckets[userId] = b
+	}
+
+	b.tokens += now.Sub(b.updated).Seconds() * refillRate
+	b.updated = now
+
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / refillRate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens -= 1
+	return true, 0
+}
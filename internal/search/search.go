@@ -0,0 +1,328 @@
+// Package search is an in-memory inverted index over chirps. It is kept up
+// to date as chirps change rather than rebuilt, and uses the moderation
+// tokenizer so censored words never become searchable.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/entities"
+	"github.com/ajpotts01/go-chirpy/internal/moderation"
+)
+
+// How quickly older chirps fall down the rankings: a chirp this old scores
+// half as much as an otherwise identical new one
+const recencyHalfLife = 48 * time.Hour
+
+// Document is what gets indexed for a chirp. Tags are its hashtags.
+type Document struct {
+	Id        int
+	AuthorId  int
+	Body      string
+	Tags      []string
+	CreatedAt time.Time
+}
+
+// Query is a parsed search. Every term, phrase and tag must match. Author is
+// the raw value of an author: filter, left for the caller to resolve into
+// AuthorId.
+type Query struct {
+	Terms    []string
+	Phrases  [][]string
+	Tags     []string
+	Author   string
+	AuthorId int
+}
+
+type Result struct {
+	Id    int
+	Score float64
+}
+
+type document struct {
+	authorId  int
+	createdAt time.Time
+	tags      map[string]bool
+	terms     map[string]bool
+}
+
+type Index struct {
+	mux *sync.RWMutex
+
+	// term -> chirp ID -> positions of the term in the chirp
+	postings map[string]map[int][]int
+	docs     map[int]document
+}
+
+func NewIndex() *Index {
+	return &Index{
+		mux:      &sync.RWMutex{},
+		postings: make(map[string]map[int][]int),
+		docs:     make(map[int]document),
+	}
+}
+
+// Add indexes a document, replacing any earlier version of it.
+func (index *Index) Add(doc Document) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	index.remove(doc.Id)
+
+	indexed := document{
+		authorId:  doc.AuthorId,
+		createdAt: doc.CreatedAt,
+		tags:      make(map[string]bool),
+		terms:     make(map[string]bool),
+	}
+
+	for _, tag := range doc.Tags {
+		indexed.tags[entities.NormaliseTag(tag)] = true
+	}
+
+	// Positions count every word, so a phrase can't match across a word
+	// that was left out of the index
+	for position, token := range moderation.Tokenize(doc.Body) {
+		if token.Term == "" || moderation.IsProfane(token.Term) {
+			continue
+		}
+
+		if index.postings[token.Term] == nil {
+			index.postings[token.Term] = make(map[int][]int)
+		}
+
+		index.postings[token.Term][doc.Id] = append(index.postings[token.Term][doc.Id], position)
+		indexed.terms[token.Term] = true
+	}
+
+	index.docs[doc.Id] = indexed
+}
+
+func (index *Index) Remove(id int) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	index.remove(id)
+}
+
+func (index *Index) remove(id int) {
+	doc, ok := index.docs[id]
+
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(index.postings[term], id)
+
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+
+	delete(index.docs, id)
+}
+
+// ParseQuery splits a search string into terms, "quoted phrases", #tags and
+// an author: filter.
+func ParseQuery(raw string) Query {
+	var query Query
+
+	for i, part := range strings.Split(raw, "\"") {
+		// Odd-numbered parts were inside quotes
+		if i%2 == 1 {
+			phrase := terms(part)
+
+			if len(phrase) == 1 {
+				query.Terms = append(query.Terms, phrase[0])
+			} else if len(phrase) > 1 {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			switch {
+			case strings.HasPrefix(strings.ToLower(word), "author:"):
+				query.Author = strings.TrimPrefix(word[len("author:"):], "@")
+			case strings.HasPrefix(word, "#") && len(word) > 1:
+				query.Tags = append(query.Tags, entities.NormaliseTag(word))
+			default:
+				query.Terms = append(query.Terms, terms(word)...)
+			}
+		}
+	}
+
+	return query
+}
+
+func terms(text string) []string {
+	var result []string
+
+	for _, token := range moderation.Tokenize(text) {
+		if token.Term != "" {
+			result = append(result, token.Term)
+		}
+	}
+
+	return result
+}
+
+// Empty reports whether the query has nothing to search on.
+func (query Query) Empty() bool {
+	return len(query.Terms) == 0 && len(query.Phrases) == 0 && len(query.Tags) == 0 && query.Author == ""
+}
+
+// Search returns every matching chirp, best first. Relevance is a TF-IDF
+// score over the query's words, scaled down with age so that newer chirps
+// win between similar matches. Queries with only filters rank by recency.
+func (index *Index) Search(query Query, now time.Time) []Result {
+	index.mux.RLock()
+	defer index.mux.RUnlock()
+
+	words := append([]string{}, query.Terms...)
+
+	for _, phrase := range query.Phrases {
+		words = append(words, phrase...)
+	}
+
+	var results []Result
+
+	for id := range index.candidates(words) {
+		doc := index.docs[id]
+
+		if !index.matches(id, doc, query) {
+			continue
+		}
+
+		relevance := 1.0
+
+		if len(words) > 0 {
+			relevance = index.relevance(id, words)
+		}
+
+		age := now.Sub(doc.createdAt)
+
+		if age < 0 {
+			age = 0
+		}
+
+		recency := math.Pow(0.5, float64(age)/float64(recencyHalfLife))
+		results = append(results, Result{Id: id, Score: relevance * recency})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].Id > results[j].Id
+		}
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
+
+// candidates returns the chirps containing every word, starting from the
+// rarest so the intersection stays small. Without words, every chirp is a
+// candidate.
+func (index *Index) candidates(words []string) map[int]bool {
+	candidates := make(map[int]bool)
+
+	if len(words) == 0 {
+		for id := range index.docs {
+			candidates[id] = true
+		}
+		return candidates
+	}
+
+	rarest := words[0]
+
+	for _, word := range words {
+		if len(index.postings[word]) < len(index.postings[rarest]) {
+			rarest = word
+		}
+	}
+
+	for id := range index.postings[rarest] {
+		candidates[id] = true
+	}
+
+	for _, word := range words {
+		for id := range candidates {
+			if _, ok := index.postings[word][id]; !ok {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	return candidates
+}
+
+func (index *Index) matches(id int, doc document, query Query) bool {
+	if query.AuthorId != 0 && doc.authorId != query.AuthorId {
+		return false
+	}
+
+	for _, tag := range query.Tags {
+		if !doc.tags[tag] {
+			return false
+		}
+	}
+
+	for _, phrase := range query.Phrases {
+		if !index.containsPhrase(id, phrase) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsPhrase checks that the phrase's words appear at consecutive
+// positions somewhere in the chirp.
+func (index *Index) containsPhrase(id int, phrase []string) bool {
+	for _, start := range index.postings[phrase[0]][id] {
+		found := true
+
+		for offset, word := range phrase[1:] {
+			if !contains(index.postings[word][id], start+offset+1) {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (index *Index) relevance(id int, words []string) float64 {
+	total := float64(len(index.docs))
+	score := 0.0
+
+	for _, word := range words {
+		frequency := float64(len(index.postings[word][id]))
+		idf := math.Log(1 + total/float64(len(index.postings[word])))
+
+		// Saturate repeated words so stuffing a chirp with one doesn't win
+		score += frequency / (frequency + 1.2) * idf
+	}
+
+	return score
+}
+
+func contains(positions []int, position int) bool {
+	for _, p := range positions {
+		if p == position {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Query
+	}{
+		{"", Query{}},
+		{"Hello, World!", Query{Terms: []string{"hello", "world"}}},
+		{`say "Good Morning" twice`, Query{Terms: []string{"say", "twice"}, Phrases: [][]string{{"good", "morning"}}}},
+		{`"one"`, Query{Terms: []string{"one"}}},
+		{"#Go #rust", Query{Tags: []string{"go", "rust"}}},
+		{"# alone", Query{Terms: []string{"alone"}}},
+		{"Author:@bob chirps", Query{Terms: []string{"chirps"}, Author: "bob"}},
+		{`"unclosed phrase here`, Query{Phrases: [][]string{{"unclosed", "phrase", "here"}}}},
+	}
+
+	for _, test := range tests {
+		if got := ParseQuery(test.raw); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", test.raw, got, test.want)
+		}
+	}
+}
+
+func resultIds(results []Result) []int {
+	ids := []int{}
+
+	for _, result := range results {
+		ids = append(ids, result.Id)
+	}
+
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	now := time.Now()
+	index := NewIndex()
+
+	docs := []Document{
+		{Id: 1, AuthorId: 10, Body: "The quick brown fox", Tags: []string{"animals"}, CreatedAt: now.Add(-time.Hour)},
+		{Id: 2, AuthorId: 20, Body: "Brown, quick and clever!", Tags: []string{"Animals", "quiz"}, CreatedAt: now},
+		{Id: 3, AuthorId: 10, Body: "quick kerfuffle brown", CreatedAt: now},
+		{Id: 4, AuthorId: 20, Body: "nothing to see", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	for _, doc := range docs {
+		index.Add(doc)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{"term, newest first with ties broken by ID", ParseQuery("brown"), []int{3, 2, 1}},
+		{"every term must match", ParseQuery("quick fox"), []int{1}},
+		{"punctuation and case are ignored", ParseQuery("CLEVER"), []int{2}},
+		{"phrase can't span a filtered word", ParseQuery(`"quick brown"`), []int{1}},
+		{"phrase order matters", ParseQuery(`"brown quick"`), []int{2}},
+		{"phrase words must be adjacent", ParseQuery(`"quick clever"`), []int{}},
+		{"profane words aren't indexed", ParseQuery("kerfuffle"), []int{}},
+		{"hashtag", ParseQuery("#animals"), []int{2, 1}},
+		{"every hashtag must match", ParseQuery("#animals #quiz"), []int{2}},
+		{"author", Query{AuthorId: 10}, []int{3, 1}},
+		{"author and term", Query{Terms: []string{"quick"}, AuthorId: 20}, []int{2}},
+		{"no match", ParseQuery("zebra"), []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := resultIds(index.Search(test.query, now))
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Search = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchFollowsEditsAndDeletes(t *testing.T) {
+	now := time.Now()
+	index := NewIndex()
+	index.Add(Document{Id: 1, Body: "first draft", Tags: []string{"old"}, CreatedAt: now})
+	index.Add(Document{Id: 2, Body: "another draft", CreatedAt: now})
+
+	// Adding a chirp again replaces what it was indexed under
+	index.Add(Document{Id: 1, Body: "final version", Tags: []string{"new"}, CreatedAt: now})
+
+	if got := resultIds(index.Search(ParseQuery("first"), now)); len(got) != 0 {
+		t.Errorf("old body still matches: %v", got)
+	}
+
+	if got := resultIds(index.Search(ParseQuery("#old"), now)); len(got) != 0 {
+		t.Errorf("old hashtag still matches: %v", got)
+	}
+
+	if got := resultIds(index.Search(ParseQuery(`"final version" #new`), now)); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("edited chirp = %v, want [1]", got)
+	}
+
+	if got := resultIds(index.Search(ParseQuery("draft"), now)); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("draft = %v, want only the unedited chirp", got)
+	}
+
+	index.Remove(1)
+	index.Remove(99)
+
+	if got := resultIds(index.Search(ParseQuery("version"), now)); len(got) != 0 {
+		t.Errorf("deleted chirp still matches: %v", got)
+	}
+
+	if _, ok := index.postings["final"]; ok {
+		t.Errorf("postings for a deleted chirp's words were kept")
+	}
+
+	if got := resultIds(index.Search(ParseQuery("#new"), now)); len(got) != 0 {
+		t.Errorf("deleted chirp's hashtag still matches: %v", got)
+	}
+}
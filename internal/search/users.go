@@ -0,0 +1,195 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Profile is what gets indexed for a user: only their public names, never
+// their email.
+type Profile struct {
+	Id          int
+	Handle      string
+	DisplayName string
+}
+
+// UserMatch is a user found by prefix. Handle matches outrank display name
+// matches, and exact matches outrank partial ones.
+type UserMatch struct {
+	Id    int
+	Score int
+}
+
+const (
+	matchDisplayName = 1
+	matchHandle      = 2
+	matchExact       = 2
+)
+
+type trieNode struct {
+	children map[rune]*trieNode
+
+	// Users with a key ending here, and whether that key is their handle
+	users map[int]bool
+}
+
+// UserIndex finds users by prefixes of their handle, their display name or
+// any word in their display name, ignoring case.
+type UserIndex struct {
+	mux  *sync.RWMutex
+	root *trieNode
+
+	// The keys each user was indexed under, so they can be removed again
+	keys map[int][]string
+}
+
+func NewUserIndex() *UserIndex {
+	return &UserIndex{
+		mux:  &sync.RWMutex{},
+		root: newTrieNode(),
+		keys: make(map[int][]string),
+	}
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: make(map[rune]*trieNode), users: make(map[int]bool)}
+}
+
+// Add indexes a user, replacing whatever they were indexed under before.
+func (index *UserIndex) Add(profile Profile) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	index.remove(profile.Id)
+
+	handle := strings.ToLower(strings.TrimSpace(profile.Handle))
+	keys := map[string]bool{}
+
+	if handle != "" {
+		keys[handle] = true
+	}
+
+	name := strings.ToLower(strings.TrimSpace(profile.DisplayName))
+
+	// A name that is also the handle stays a handle match
+	for _, key := range append(strings.Fields(name), name) {
+		if _, ok := keys[key]; !ok && key != "" {
+			keys[key] = false
+		}
+	}
+
+	for key, isHandle := range keys {
+		node := index.root
+
+		for _, r := range key {
+			child, ok := node.children[r]
+
+			if !ok {
+				child = newTrieNode()
+				node.children[r] = child
+			}
+
+			node = child
+		}
+
+		node.users[profile.Id] = node.users[profile.Id] || isHandle
+		index.keys[profile.Id] = append(index.keys[profile.Id], key)
+	}
+}
+
+func (index *UserIndex) Remove(id int) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	index.remove(id)
+}
+
+func (index *UserIndex) remove(id int) {
+	for _, key := range index.keys[id] {
+		removeKey(index.root, []rune(key), id)
+	}
+
+	delete(index.keys, id)
+}
+
+// removeKey removes id from the node at the end of key, pruning nodes left
+// empty. It reports whether node itself is now empty.
+func removeKey(node *trieNode, key []rune, id int) bool {
+	if len(key) == 0 {
+		delete(node.users, id)
+	} else if child, ok := node.children[key[0]]; ok && removeKey(child, key[1:], id) {
+		delete(node.children, key[0])
+	}
+
+	return len(node.users) == 0 && len(node.children) == 0
+}
+
+// Search returns up to limit users with a key starting with prefix, best
+// first.
+func (index *UserIndex) Search(prefix string, limit int) []UserMatch {
+	index.mux.RLock()
+	defer index.mux.RUnlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	if prefix == "" {
+		return nil
+	}
+
+	node := index.root
+
+	for _, r := range prefix {
+		child, ok := node.children[r]
+
+		if !ok {
+			return nil
+		}
+
+		node = child
+	}
+
+	scores := make(map[int]int)
+	collect(node, true, scores)
+
+	matches := make([]UserMatch, 0, len(scores))
+
+	for id, score := range scores {
+		matches = append(matches, UserMatch{Id: id, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score == matches[j].Score {
+			return matches[i].Id < matches[j].Id
+		}
+		return matches[i].Score > matches[j].Score
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+// collect scores every user at or below node, keeping each user's best
+// match. exact is true only for the node the prefix ends at.
+func collect(node *trieNode, exact bool, scores map[int]int) {
+	for id, isHandle := range node.users {
+		score := matchDisplayName
+
+		if isHandle {
+			score = matchHandle
+		}
+
+		if exact {
+			score += matchExact
+		}
+
+		scores[id] = max(scores[id], score)
+	}
+
+	for _, child := range node.children {
+		collect(child, false, scores)
+	}
+}
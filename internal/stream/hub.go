@@ -0,0 +1,101 @@
+// Package stream fans chirp events out to connected clients. Publishing
+// never blocks: a subscriber that can't keep up is dropped rather than
+// holding up everyone else.
+package stream
+
+import (
+	"sync"
+)
+
+// Buffered events per subscriber before it counts as a slow consumer
+const DefaultBuffer = 64
+
+// Event is one change pushed to subscribers. Data is sent to clients as is;
+// AuthorId is only used for filtering.
+type Event struct {
+	Id       uint64
+	Type     string
+	AuthorId int
+	Data     any
+}
+
+// Filter decides whether a subscriber wants an event.
+type Filter func(Event) bool
+
+type Subscription struct {
+	Events <-chan Event
+
+	events  chan Event
+	filter  Filter
+	dropped bool
+}
+
+// Dropped reports whether the subscription was closed because its buffer
+// filled up. Only valid once Events has been closed.
+func (subscription *Subscription) Dropped() bool {
+	return subscription.dropped
+}
+
+type Hub struct {
+	mux         *sync.Mutex
+	buffer      int
+	lastId      uint64
+	subscribers map[*Subscription]struct{}
+}
+
+func NewHub(buffer int) *Hub {
+	return &Hub{
+		mux:         &sync.Mutex{},
+		buffer:      buffer,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers for events that pass filter. A nil filter receives
+// everything. Callers must Unsubscribe when they're done.
+func (hub *Hub) Subscribe(filter Filter) *Subscription {
+	events := make(chan Event, hub.buffer)
+	subscription := &Subscription{Events: events, events: events, filter: filter}
+
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	hub.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe closes the subscription's channel. It is safe to call more
+// than once, and after the hub has already dropped it.
+func (hub *Hub) Unsubscribe(subscription *Subscription) {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	if _, ok := hub.subscribers[subscription]; ok {
+		delete(hub.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Publish assigns the event an ID and hands it to every interested
+// subscriber. Subscribers whose buffers are full are dropped.
+func (hub *Hub) Publish(event Event) {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	hub.lastId++
+	event.Id = hub.lastId
+
+	for subscription := range hub.subscribers {
+		if subscription.filter != nil && !subscription.filter(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped = true
+			delete(hub.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package totp implements time-based one-time passwords (RFC 6238) using the
+// defaults authenticator apps expect: HMAC-SHA1, 6 digits and 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const digits = 6
+const period = 30 * time.Second
+const secretLength = 20
+
+// Codes from one step either side of the current one are accepted to allow
+// for clock drift between server and device.
+const skew = 1
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretLength)
+	_, err := rand.Read(secret)
+
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI builds the otpauth:// URI that authenticator apps read from QR codes.
+func URI(secret string, issuer string, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(digits))
+	params.Set("period", fmt.Sprint(int(period.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Step returns the time step that t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(period.Seconds())
+}
+
+// Code returns the code for the time step containing t.
+func Code(secret string, t time.Time) (string, error) {
+	return codeForStep(secret, Step(t))
+}
+
+// Validate checks code against the steps around t. Steps at or before
+// lastStep are rejected so a code can't be used twice. It returns the step
+// the code matched, which callers should store as the new lastStep.
+func Validate(secret string, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+
+	if len(code) != digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for step := current - skew; step <= current+skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		expected, err := codeForStep(secret, step)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func codeForStep(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulus), nil
+}
@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 secret from RFC 6238 appendix B, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC's codes are 8 digits; ours are the last 6 of them
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(rfcSecret, time.Unix(test.unix, 0))
+
+		if err != nil {
+			t.Fatalf("Code(%v): %v", test.unix, err)
+		}
+
+		if code != test.want {
+			t.Errorf("Code(%v) = %v, want %v", test.unix, code, test.want)
+		}
+	}
+
+	if _, err := Code("not base32!", time.Unix(59, 0)); err == nil {
+		t.Errorf("Code accepted an invalid secret")
+	}
+
+	lower, _ := Code(strings.ToLower(rfcSecret), time.Unix(59, 0))
+
+	if lower != "287082" {
+		t.Errorf("Code with a lower case secret = %v, want 287082", lower)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	codeAt := func(step int64) string {
+		code, err := codeForStep(rfcSecret, step)
+
+		if err != nil {
+			t.Fatalf("codeForStep: %v", err)
+		}
+
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		step     int64
+		ok       bool
+	}{
+		{"current step", codeAt(current), 0, current, true},
+		{"previous step", codeAt(current - 1), 0, current - 1, true},
+		{"next step", codeAt(current + 1), 0, current + 1, true},
+		{"two steps behind", codeAt(current - 2), 0, 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, 0, false},
+		{"surrounding whitespace", " " + codeAt(current) + "\n", 0, current, true},
+		{"wrong length", codeAt(current)[:5], 0, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"already used", codeAt(current), current, 0, false},
+		{"before last use", codeAt(current - 1), current, 0, false},
+		{"after last use", codeAt(current + 1), current, current + 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now, test.lastStep)
+
+			if ok != test.ok || step != test.step {
+				t.Fatalf("Validate = %v, %v, want %v, %v", step, ok, test.step, test.ok)
+			}
+		})
+	}
+}
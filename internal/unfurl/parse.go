@@ -0,0 +1,172 @@
+package unfurl
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxTitleLength = 300
+const maxDescriptionLength = 1000
+
+// parsePreview pulls preview fields out of a page's meta tags, preferring
+// OpenGraph, then Twitter cards, then the plain title and description. It
+// is a scanner for tags rather than a full HTML parser, which is all meta
+// tags need.
+func parsePreview(page string, base *url.URL) Preview {
+	meta := make(map[string]string)
+	title := ""
+	lower := strings.ToLower(page)
+
+	for i := 0; i < len(page); {
+		start := strings.IndexByte(page[i:], '<')
+
+		if start < 0 {
+			break
+		}
+
+		start += i
+		name, attributes, end := readTag(page, start)
+		i = end
+
+		switch name {
+		case "meta":
+			key := strings.ToLower(attributes["property"])
+
+			if key == "" {
+				key = strings.ToLower(attributes["name"])
+			}
+
+			if _, seen := meta[key]; key != "" && !seen {
+				meta[key] = attributes["content"]
+			}
+		case "title":
+			if title == "" {
+				if close := strings.Index(lower[end:], "</title"); close >= 0 {
+					title = page[end : end+close]
+				}
+			}
+		case "/head", "body":
+			i = len(page)
+		}
+	}
+
+	preview := Preview{
+		Title:       first(meta["og:title"], meta["twitter:title"], html.UnescapeString(title)),
+		Description: first(meta["og:description"], meta["twitter:description"], meta["description"]),
+		SiteName:    meta["og:site_name"],
+	}
+
+	preview.Title = clean(preview.Title, maxTitleLength)
+	preview.Description = clean(preview.Description, maxDescriptionLength)
+	preview.SiteName = clean(preview.SiteName, maxTitleLength)
+
+	if image := first(meta["og:image"], meta["og:image:url"], meta["twitter:image"]); image != "" {
+		if resolved, err := base.Parse(strings.TrimSpace(image)); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+			preview.Image = resolved.String()
+		}
+	}
+
+	return preview
+}
+
+// readTag reads the tag starting at page[start], returning its lowercased
+// name, its attributes (values unescaped) and where it ends. Comments are
+// skipped whole.
+func readTag(page string, start int) (string, map[string]string, int) {
+	if strings.HasPrefix(page[start:], "<!--") {
+		end := strings.Index(page[start:], "-->")
+
+		if end < 0 {
+			return "", nil, len(page)
+		}
+
+		return "", nil, start + end + 3
+	}
+
+	i := start + 1
+	nameStart := i
+
+	for i < len(page) && !isSpace(page[i]) && page[i] != '>' {
+		i++
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(page[nameStart:i], "/"))
+	attributes := make(map[string]string)
+
+	for i < len(page) {
+		for i < len(page) && (isSpace(page[i]) || page[i] == '/') {
+			i++
+		}
+
+		if i >= len(page) || page[i] == '>' {
+			return name, attributes, i + 1
+		}
+
+		keyStart := i
+
+		for i < len(page) && !isSpace(page[i]) && page[i] != '=' && page[i] != '>' {
+			i++
+		}
+
+		key := strings.ToLower(page[keyStart:i])
+		value := ""
+
+		if i < len(page) && page[i] == '=' {
+			i++
+
+			if i < len(page) && (page[i] == '"' || page[i] == '\'') {
+				quote := page[i]
+				end := strings.IndexByte(page[i+1:], quote)
+
+				if end < 0 {
+					return name, attributes, len(page)
+				}
+
+				value = page[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				valueStart := i
+
+				for i < len(page) && !isSpace(page[i]) && page[i] != '>' {
+					i++
+				}
+
+				value = page[valueStart:i]
+			}
+		}
+
+		if _, seen := attributes[key]; !seen {
+			attributes[key] = html.UnescapeString(value)
+		}
+	}
+
+	return name, attributes, len(page)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// clean collapses whitespace and trims text to a sensible length.
+func clean(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,233 @@
+// Package unfurl fetches link previews (OpenGraph and Twitter card metadata)
+// for URLs posted in chirps. Fetches happen in the background and results,
+// including failures, are cached for a while so each URL is fetched at most
+// once per TTL however often it's read.
+package unfurl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/netguard"
+)
+
+const DefaultTimeout = 5 * time.Second
+const DefaultMaxBytes = 512 << 10
+const DefaultTTL = 24 * time.Hour
+
+// Failed fetches are retried sooner than successful ones are refreshed
+const failureTTL = 15 * time.Minute
+
+const maxCacheEntries = 10000
+const queueSize = 256
+const workers = 4
+
+var ErrNotHtml = errors.New("not an HTML page")
+
+type Preview struct {
+	Url         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+type Options struct {
+	Timeout  time.Duration
+	MaxBytes int64
+	TTL      time.Duration
+	// AllowPrivate lets the unfurler fetch from private and loopback
+	// addresses, for local development and tests only
+	AllowPrivate bool
+}
+
+type cacheEntry struct {
+	preview   Preview
+	ok        bool
+	expiresAt time.Time
+}
+
+type Unfurler struct {
+	client   *http.Client
+	maxBytes int64
+	ttl      time.Duration
+
+	mux     sync.Mutex
+	cache   map[string]cacheEntry
+	pending map[string]bool
+	queue   chan string
+}
+
+// New creates an unfurler. Zero options take the defaults. Call Run to
+// start fetching.
+func New(options Options) *Unfurler {
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	if options.MaxBytes == 0 {
+		options.MaxBytes = DefaultMaxBytes
+	}
+
+	if options.TTL == 0 {
+		options.TTL = DefaultTTL
+	}
+
+	return &Unfurler{
+		client:   netguard.NewClient(options.Timeout, options.AllowPrivate),
+		maxBytes: options.MaxBytes,
+		ttl:      options.TTL,
+		cache:    make(map[string]cacheEntry),
+		pending:  make(map[string]bool),
+		queue:    make(chan string, queueSize),
+	}
+}
+
+// Run starts the background workers.
+func (unfurler *Unfurler) Run() {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for target := range unfurler.queue {
+				preview, err := unfurler.Fetch(target)
+
+				if err != nil {
+					log.Printf("Couldn't unfurl %v: %v\n", target, err)
+				}
+
+				unfurler.store(target, preview, err == nil)
+			}
+		}()
+	}
+}
+
+// Lookup returns the cached preview for a URL. Missing or stale entries are
+// queued for fetching, so a later lookup can find them.
+func (unfurler *Unfurler) Lookup(target string) (Preview, bool) {
+	unfurler.mux.Lock()
+	entry, found := unfurler.cache[target]
+	unfurler.mux.Unlock()
+
+	if !found || time.Now().After(entry.expiresAt) {
+		unfurler.Enqueue(target)
+	}
+
+	if !found || !entry.ok {
+		return Preview{}, false
+	}
+
+	return entry.preview, true
+}
+
+// Enqueue asks for a URL to be fetched. It never blocks: if the queue is
+// full the URL is skipped, and picked up again the next time it's looked up.
+func (unfurler *Unfurler) Enqueue(target string) {
+	unfurler.mux.Lock()
+	defer unfurler.mux.Unlock()
+
+	if unfurler.pending[target] {
+		return
+	}
+
+	if entry, found := unfurler.cache[target]; found && time.Now().Before(entry.expiresAt) {
+		return
+	}
+
+	select {
+	case unfurler.queue <- target:
+		unfurler.pending[target] = true
+	default:
+	}
+}
+
+func (unfurler *Unfurler) store(target string, preview Preview, ok bool) {
+	unfurler.mux.Lock()
+	defer unfurler.mux.Unlock()
+
+	delete(unfurler.pending, target)
+	now := time.Now()
+
+	if len(unfurler.cache) >= maxCacheEntries {
+		for key, entry := range unfurler.cache {
+			if now.After(entry.expiresAt) {
+				delete(unfurler.cache, key)
+			}
+		}
+	}
+
+	// Still full of live entries, so make room at random
+	for key := range unfurler.cache {
+		if len(unfurler.cache) < maxCacheEntries {
+			break
+		}
+		delete(unfurler.cache, key)
+	}
+
+	ttl := unfurler.ttl
+
+	if !ok {
+		ttl = min(ttl, failureTTL)
+	}
+
+	unfurler.cache[target] = cacheEntry{preview: preview, ok: ok, expiresAt: now.Add(ttl)}
+}
+
+// Fetch downloads a page and reads its preview metadata. Only the first
+// MaxBytes of the page are read, which is plenty to cover the head.
+func (unfurler *Unfurler) Fetch(target string) (Preview, error) {
+	parsed, err := url.Parse(target)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Preview{}, fmt.Errorf("unsupported URL: %v", target)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+
+	if err != nil {
+		return Preview{}, err
+	}
+
+	request.Header.Set("User-Agent", "Chirpy-Unfurler/1.0")
+	request.Header.Set("Accept", "text/html")
+
+	response, err := unfurler.client.Do(request)
+
+	if err != nil {
+		return Preview{}, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return Preview{}, fmt.Errorf("got %v", response.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Preview{}, ErrNotHtml
+	}
+
+	page, err := io.ReadAll(io.LimitReader(response.Body, unfurler.maxBytes))
+
+	if err != nil {
+		return Preview{}, err
+	}
+
+	// Relative image URLs are resolved against where we ended up after
+	// redirects
+	preview := parsePreview(string(page), response.Request.URL)
+	preview.Url = target
+
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, errors.New("no preview metadata")
+	}
+
+	return preview, nil
+}
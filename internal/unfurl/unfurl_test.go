@@ -0,0 +1,192 @@
+package unfurl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/netguard"
+)
+
+func TestParsePreview(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+
+	tests := []struct {
+		name string
+		page string
+		want Preview
+	}{
+		{
+			"opengraph",
+			`<html><head><meta property="og:title" content="OG title"><meta name="twitter:title" content="Card title">
+			<meta property="og:description" content="OG &amp; more"><meta property="og:site_name" content="Example">
+			<meta property="og:image" content="/img.png"><title>Page title</title></head></html>`,
+			Preview{Title: "OG title", Description: "OG & more", SiteName: "Example", Image: "https://example.com/img.png"},
+		},
+		{
+			"twitter card",
+			`<head><meta name="twitter:title" content='Card title'><meta name="twitter:description" content=Card>
+			<meta name="twitter:image" content="https://cdn.example.com/card.jpg"><title>Page title</title></head>`,
+			Preview{Title: "Card title", Description: "Card", Image: "https://cdn.example.com/card.jpg"},
+		},
+		{
+			"plain title and description",
+			`<HEAD><TITLE>Fish &amp;
+			chips</TITLE><META NAME="Description" CONTENT="  A   page  "></HEAD>`,
+			Preview{Title: "Fish & chips", Description: "A page"},
+		},
+		{
+			"first value wins",
+			`<meta property="og:title" content="First"><meta property="og:title" content="Second">`,
+			Preview{Title: "First"},
+		},
+		{
+			"commented out",
+			`<!-- <meta property="og:title" content="Hidden"> --><title>Shown</title>`,
+			Preview{Title: "Shown"},
+		},
+		{
+			"stops at the body",
+			`<head><title>Head</title></head><body><meta property="og:description" content="Body"></body>`,
+			Preview{Title: "Head"},
+		},
+		{
+			"non-http image",
+			`<meta property="og:title" content="T"><meta property="og:image" content="javascript:alert(1)">`,
+			Preview{Title: "T"},
+		},
+		{
+			"long title",
+			`<title>` + strings.Repeat("a", maxTitleLength+10) + `</title>`,
+			Preview{Title: strings.Repeat("a", maxTitleLength-1) + "…"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parsePreview(test.page, base); got != test.want {
+				t.Fatalf("parsePreview = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<head><meta property="og:title" content="Page"><meta property="og:image" content="img.png"></head>`))
+	})
+
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/nested/page", http.StatusFound)
+	})
+
+	mux.HandleFunc("/nested/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<meta property="og:title" content="Nested"><meta property="og:image" content="img.png">`))
+	})
+
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title": "not a page"}`))
+	})
+
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<head>` + strings.Repeat(" ", 1024) + `<meta property="og:title" content="Too far"></head>`))
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	server := newTestServer(t)
+	unfurler := New(Options{Timeout: 200 * time.Millisecond, MaxBytes: 512, AllowPrivate: true})
+
+	tests := []struct {
+		name    string
+		path    string
+		want    Preview
+		wantErr bool
+	}{
+		{"page", "/page", Preview{Url: server.URL + "/page", Title: "Page", Image: server.URL + "/img.png"}, false},
+		{"redirect", "/redirect", Preview{Url: server.URL + "/redirect", Title: "Nested", Image: server.URL + "/nested/img.png"}, false},
+		{"redirect loop", "/loop", Preview{}, true},
+		{"not html", "/json", Preview{}, true},
+		{"metadata past MaxBytes", "/large", Preview{}, true},
+		{"timeout", "/slow", Preview{}, true},
+		{"not found", "/missing", Preview{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preview, err := unfurler.Fetch(server.URL + test.path)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Fetch = %+v, want an error", preview)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+
+			if preview != test.want {
+				t.Fatalf("Fetch = %+v, want %+v", preview, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchRejectsUnsupportedUrls(t *testing.T) {
+	unfurler := New(Options{AllowPrivate: true})
+
+	for _, target := range []string{"ftp://example.com/", "file:///etc/passwd", "https://", "not a url"} {
+		if _, err := unfurler.Fetch(target); err == nil {
+			t.Errorf("Fetch(%q) succeeded", target)
+		}
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	requested := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	unfurler := New(Options{Timeout: time.Second})
+	_, err := unfurler.Fetch(server.URL + "/page")
+
+	if !errors.Is(err, netguard.ErrBlockedAddress) {
+		t.Fatalf("Fetch = %v, want ErrBlockedAddress", err)
+	}
+
+	if requested {
+		t.Fatalf("the request reached the server")
+	}
+}
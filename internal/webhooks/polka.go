@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+const polkaSignatureHeader = "X-Polka-Signature"
+const polkaTimestampHeader = "X-Polka-Timestamp"
+const polkaEventIdHeader = "X-Polka-Event-Id"
+
+// Deliveries signed further than this from our clock are rejected
+const polkaTimestampTolerance = 5 * time.Minute
+
+// Polka event names and the subscription changes they cause
+var polkaSubscriptionEvents = map[string]string{
+	"user.upgraded":       database.SubscriptionEventUpgraded,
+	"user.renewed":        database.SubscriptionEventRenewed,
+	"user.downgraded":     database.SubscriptionEventDowngraded,
+	"user.canceled":       database.SubscriptionEventCanceled,
+	"user.payment_failed": database.SubscriptionEventPaymentFailed,
+}
+
+type polkaData struct {
+	UserId      int       `json:"user_id"`
+	Plan        string    `json:"plan"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+type polkaEvent struct {
+	Id    string    `json:"id"`
+	Event string    `json:"event"`
+	Data  polkaData `json:"data"`
+}
+
+// Polka signs deliveries with SigningSecret. While it migrates, unsigned
+// deliveries carrying the legacy ApiKey header are still accepted if ApiKey
+// is set.
+type Polka struct {
+	ApiKey        string
+	SigningSecret string
+	Nonces        NonceStore
+}
+
+func (polka Polka) Name() string {
+	return "polka"
+}
+
+// Polka was the only provider before the registry existed
+func (polka Polka) LegacyEventIds() bool {
+	return true
+}
+
+func (polka Polka) Verify(r *http.Request, body []byte) (*database.WebhookNonce, error) {
+	signature := r.Header.Get(polkaSignatureHeader)
+
+	if signature == "" {
+		return nil, polka.verifyApiKey(r)
+	}
+
+	return VerifySignature(SignedRequest{
+		Secret:    polka.SigningSecret,
+		Timestamp: r.Header.Get(polkaTimestampHeader),
+		Signature: signature,
+		Body:      body,
+	}, polkaTimestampTolerance, polka.Nonces)
+}
+
+func (polka Polka) verifyApiKey(r *http.Request) error {
+	if polka.ApiKey == "" {
+		return ErrUnauthorized
+	}
+
+	authHeader := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(authHeader, "ApiKey ") {
+		return ErrUnauthorized
+	}
+
+	apiKey := strings.TrimSpace(strings.TrimPrefix(authHeader, "ApiKey "))
+
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(polka.ApiKey)) != 1 {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+func (polka Polka) Decode(header http.Header, body []byte) (Event, error) {
+	payload := polkaEvent{}
+	err := json.Unmarshal(body, &payload)
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	event := Event{
+		Id:   payload.Id,
+		Type: payload.Event,
+	}
+
+	if event.Id == "" {
+		event.Id = header.Get(polkaEventIdHeader)
+	}
+
+	subscriptionEvent, ok := polkaSubscriptionEvents[payload.Event]
+
+	if !ok {
+		return event, nil
+	}
+
+	event.Action = &Action{
+		UserId: payload.Data.UserId,
+		SubscriptionChange: database.SubscriptionChange{
+			Event:       subscriptionEvent,
+			Plan:        payload.Data.Plan,
+			PeriodStart: payload.Data.PeriodStart,
+			PeriodEnd:   payload.Data.PeriodEnd,
+		},
+	}
+
+	return event, nil
+}
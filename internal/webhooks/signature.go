@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+// SignedRequest describes a delivery signed with an HMAC-SHA256 of
+// "<timestamp>.<body>", the scheme shared by most billing providers.
+type SignedRequest struct {
+	Secret    string
+	Timestamp string
+	Signature string
+	Body      []byte
+}
+
+// VerifySignature checks a signed delivery in constant time, rejects
+// timestamps more than tolerance away from now, and rejects exact replays of
+// a delivery that was already recorded. It returns the delivery's nonce,
+// which the caller records along with the outcome of processing it.
+func VerifySignature(req SignedRequest, tolerance time.Duration, nonces NonceStore) (*database.WebhookNonce, error) {
+	if req.Secret == "" {
+		log.Printf("Received signed webhook but no signing secret is configured")
+		return nil, ErrUnauthorized
+	}
+
+	timestamp, err := strconv.ParseInt(req.Timestamp, 10, 64)
+
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	drift := time.Since(signedAt)
+
+	if drift > tolerance || drift < -tolerance {
+		log.Printf("Webhook timestamp outside tolerance: %v", signedAt)
+		return nil, ErrUnauthorized
+	}
+
+	mac := hmac.New(sha256.New, []byte(req.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(req.Body)
+	expected := mac.Sum(nil)
+
+	provided, err := hex.DecodeString(strings.TrimPrefix(req.Signature, "sha256="))
+
+	if err != nil || !hmac.Equal(expected, provided) {
+		return nil, ErrUnauthorized
+	}
+
+	// A valid signature can only be reused by replaying the exact delivery
+	nonce := database.WebhookNonce{
+		Value:     hex.EncodeToString(expected),
+		ExpiresAt: signedAt.Add(tolerance),
+	}
+
+	seen, err := nonces.WebhookNonceSeen(nonce.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if seen {
+		return nil, ErrReplayed
+	}
+
+	return &nonce, nil
+}
@@ -0,0 +1,101 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testTolerance = 5 * time.Minute
+
+// testNonces reports nonces in seen as already recorded
+type testNonces struct {
+	seen map[string]bool
+}
+
+func (nonces testNonces) WebhookNonceSeen(nonce string) (bool, error) {
+	return nonces.seen[nonce], nil
+}
+
+func sign(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func signedRequest(secret string, signedAt time.Time, body string) SignedRequest {
+	return SignedRequest{
+		Secret:    secret,
+		Timestamp: strconv.FormatInt(signedAt.Unix(), 10),
+		Signature: sign(secret, signedAt.Unix(), body),
+		Body:      []byte(body),
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	body := `{"event":"user.upgraded"}`
+	valid := signedRequest("secret", now, body)
+
+	nonce, err := VerifySignature(valid, testTolerance, testNonces{})
+
+	if err != nil {
+		t.Fatalf("VerifySignature(valid): %v", err)
+	}
+
+	if nonce == nil || nonce.Value != valid.Signature[len("sha256="):] || !nonce.ExpiresAt.Equal(time.Unix(now.Unix(), 0).Add(testTolerance)) {
+		t.Fatalf("nonce = %+v, want the signature, expiring when the timestamp leaves the tolerance", nonce)
+	}
+
+	badSignature := valid
+	badSignature.Signature = sign("other", now.Unix(), body)
+	tamperedBody := valid
+	tamperedBody.Body = []byte(`{"event":"user.downgraded"}`)
+	notHex := valid
+	notHex.Signature = "sha256=zz"
+	badTimestamp := valid
+	badTimestamp.Timestamp = "yesterday"
+	missingSecret := valid
+	missingSecret.Secret = ""
+
+	tests := []struct {
+		name   string
+		req    SignedRequest
+		nonces testNonces
+		want   error
+	}{
+		{"bad signature", badSignature, testNonces{}, ErrUnauthorized},
+		{"tampered body", tamperedBody, testNonces{}, ErrUnauthorized},
+		{"signature not hex", notHex, testNonces{}, ErrUnauthorized},
+		{"timestamp not a number", badTimestamp, testNonces{}, ErrUnauthorized},
+		{"timestamp too old", signedRequest("secret", now.Add(-testTolerance-time.Minute), body), testNonces{}, ErrUnauthorized},
+		{"timestamp too new", signedRequest("secret", now.Add(testTolerance+time.Minute), body), testNonces{}, ErrUnauthorized},
+		{"replayed", valid, testNonces{seen: map[string]bool{nonce.Value: true}}, ErrReplayed},
+		{"missing secret", missingSecret, testNonces{}, ErrUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nonce, err := VerifySignature(test.req, testTolerance, test.nonces)
+
+			if err != test.want || nonce != nil {
+				t.Fatalf("VerifySignature = %+v, %v, want %v", nonce, err, test.want)
+			}
+		})
+	}
+
+	// Verifying doesn't use up the nonce; that happens once it's processed
+	if _, err := VerifySignature(valid, testTolerance, testNonces{}); err != nil {
+		t.Fatalf("VerifySignature(valid) again: %v", err)
+	}
+
+	// Drift within the tolerance either way is allowed
+	for _, signedAt := range []time.Time{now.Add(-testTolerance + time.Minute), now.Add(testTolerance - time.Minute)} {
+		if _, err := VerifySignature(signedRequest("secret", signedAt, body), testTolerance, testNonces{}); err != nil {
+			t.Fatalf("VerifySignature(signed at %v): %v", signedAt, err)
+		}
+	}
+}
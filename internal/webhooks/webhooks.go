@@ -0,0 +1,86 @@
+// Package webhooks defines inbound webhook providers. Each provider knows
+// how to authenticate its deliveries, decode its payloads and map its events
+// onto changes in Chirpy, so adding a provider doesn't touch the HTTP layer.
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/ajpotts01/go-chirpy/internal/database"
+)
+
+var ErrUnauthorized = errors.New("webhook could not be authenticated")
+var ErrReplayed = errors.New("webhook has already been received")
+
+// Action is what Chirpy should do in response to an event.
+type Action struct {
+	UserId             int
+	SubscriptionChange database.SubscriptionChange
+}
+
+// Event is a delivery decoded by its provider. Events with a nil Action are
+// acknowledged but otherwise ignored.
+type Event struct {
+	// Id is the provider's identifier for the event, used to deduplicate
+	// retries. It may be empty if the provider doesn't send one.
+	Id     string
+	Type   string
+	Action *Action
+}
+
+type Provider interface {
+	// Name is used in the /api/webhooks/{provider} URL and the event log.
+	Name() string
+	// Verify authenticates a delivery, returning ErrUnauthorized or
+	// ErrReplayed if it should be rejected. Signed deliveries also return
+	// a nonce, to be recorded once the delivery has been processed.
+	Verify(r *http.Request, body []byte) (*database.WebhookNonce, error)
+	// Decode parses a delivery. header may be empty when a stored event is
+	// being replayed.
+	Decode(header http.Header, body []byte) (Event, error)
+}
+
+// LegacyProvider is implemented by providers that predate the registry.
+// Their event IDs were logged without the provider name in front, and are
+// kept that way so redeliveries of events from then are still recognised.
+type LegacyProvider interface {
+	Provider
+	LegacyEventIds() bool
+}
+
+// NonceStore remembers signed deliveries until they are too old to replay.
+type NonceStore interface {
+	WebhookNonceSeen(nonce string) (bool, error)
+}
+
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]Provider),
+	}
+}
+
+func (registry *Registry) Register(provider Provider) {
+	registry.providers[provider.Name()] = provider
+}
+
+func (registry *Registry) Get(name string) (Provider, bool) {
+	provider, ok := registry.providers[name]
+	return provider, ok
+}
+
+func (registry *Registry) Names() []string {
+	names := make([]string, 0, len(registry.providers))
+
+	for name := range registry.providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,248 @@
+// Package websocket is a minimal server side of RFC 6455: enough to push
+// text messages to clients and answer their pings and close frames. There
+// is no support for extensions, subprotocols or fragmented client messages.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Clients only send control frames and the odd message we ignore, so
+// anything bigger is treated as abuse
+const maxClientPayload = 64 * 1024
+
+const CloseNormal = 1000
+const CloseGoingAway = 1001
+const CloseTryAgainLater = 1013
+
+var ErrNotWebSocket = errors.New("not a websocket handshake")
+var ErrClosed = errors.New("websocket closed")
+
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mux    *sync.Mutex
+	closed bool
+}
+
+// Upgrade completes the opening handshake and takes over the connection.
+// On error nothing has been written, so the caller can still respond.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, ErrNotWebSocket
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" {
+		return nil, ErrNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		return nil, errors.New("connection does not support hijacking")
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+
+	_, err = conn.Write([]byte(response))
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: buffered.Reader, mux: &sync.Mutex{}}, nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGuid))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// WriteText sends a single unfragmented text message.
+func (c *Conn) WriteText(message []byte) error {
+	return c.writeFrame(opText, message)
+}
+
+// Ping checks the client is still there. A dead connection shows up as an
+// error here or from ReadLoop.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with code and reason, then closes the
+// connection without waiting for the client's reply. Closing an already
+// closed connection does nothing.
+func (c *Conn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	c.writeFrame(opClose, payload)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+	return c.conn.Close()
+}
+
+// writeFrame is safe to call from several goroutines, since pongs are sent
+// from the read loop while messages are written elsewhere.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	length := len(payload)
+
+	// Server frames are never masked
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// ReadLoop reads client frames until the client closes the connection or
+// it fails, answering pings and close frames along the way. Messages from
+// the client are discarded. It returns nil on a clean close.
+func (c *Conn) ReadLoop() error {
+	for {
+		opcode, payload, err := c.readFrame()
+
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload)
+		case opClose:
+			c.Close(CloseNormal, "")
+			return nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+
+	_, err := io.ReadFull(c.reader, header[:])
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	// Clients must mask every frame
+	if !masked {
+		return 0, nil, errors.New("client frame is not masked")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		_, err = io.ReadFull(c.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		_, err = io.ReadFull(c.reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if length > maxClientPayload {
+		c.Close(1009, "message too big")
+		return 0, nil, errors.New("client frame too large")
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.reader, mask[:])
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,281 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestConn returns a server Conn and the client end of its connection.
+func newTestConn(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return &Conn{conn: server, reader: bufio.NewReader(server), mux: &sync.Mutex{}}, client
+}
+
+// clientFrame builds a frame the way a client must send it: final and
+// masked.
+func clientFrame(opcode byte, payload []byte, masked bool) []byte {
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+
+	if masked {
+		maskBit = 0x80
+	}
+
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+
+	if !masked {
+		return append(frame, payload...)
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	return frame
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("acceptKey = %v", got)
+	}
+}
+
+func TestWriteTextFraming(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		header []byte
+	}{
+		{"empty", 0, []byte{0x81, 0}},
+		{"7-bit length", 125, []byte{0x81, 125}},
+		{"16-bit length", 126, []byte{0x81, 126, 0, 126}},
+		{"largest 16-bit length", 0xFFFF, []byte{0x81, 126, 0xFF, 0xFF}},
+		{"64-bit length", 0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, client := newTestConn(t)
+			message := bytes.Repeat([]byte("a"), test.length)
+			written := make(chan error, 1)
+
+			go func() {
+				written <- conn.WriteText(message)
+			}()
+
+			frame := make([]byte, len(test.header)+test.length)
+			_, err := io.ReadFull(client, frame)
+
+			if err != nil {
+				t.Fatalf("reading frame: %v", err)
+			}
+
+			if err := <-written; err != nil {
+				t.Fatalf("WriteText: %v", err)
+			}
+
+			if !bytes.Equal(frame[:len(test.header)], test.header) {
+				t.Fatalf("header = %v, want %v", frame[:len(test.header)], test.header)
+			}
+
+			if !bytes.Equal(frame[len(test.header):], message) {
+				t.Fatalf("payload doesn't match")
+			}
+		})
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   []byte
+		opcode  byte
+		payload string
+		wantErr bool
+	}{
+		{"masked text", clientFrame(opText, []byte("hello"), true), opText, "hello", false},
+		{"16-bit length", clientFrame(opBinary, bytes.Repeat([]byte("b"), 300), true), opBinary, strings.Repeat("b", 300), false},
+		{"unmasked", clientFrame(opText, []byte("hello"), false), 0, "", true},
+		{"truncated", clientFrame(opText, []byte("hello"), true)[:6], 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, client := newTestConn(t)
+
+			go func() {
+				client.Write(test.frame)
+				client.Close()
+			}()
+
+			opcode, payload, err := conn.readFrame()
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("readFrame succeeded, want an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readFrame: %v", err)
+			}
+
+			if opcode != test.opcode || string(payload) != test.payload {
+				t.Fatalf("readFrame = %v %q, want %v %q", opcode, payload, test.opcode, test.payload)
+			}
+		})
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	conn, client := newTestConn(t)
+
+	// Only the header is sent; the frame is refused before its payload
+	header := clientFrame(opText, make([]byte, maxClientPayload+1), true)[:10]
+	go client.Write(header)
+
+	closeFrame := make(chan []byte, 1)
+
+	go func() {
+		frame := make([]byte, 4+len("message too big"))
+		io.ReadFull(client, frame)
+		closeFrame <- frame
+	}()
+
+	_, _, err := conn.readFrame()
+
+	if err == nil {
+		t.Fatalf("readFrame accepted a frame over the limit")
+	}
+
+	if frame := <-closeFrame; frame[0] != 0x80|opClose || binary.BigEndian.Uint16(frame[2:]) != 1009 {
+		t.Fatalf("close frame = %v, want code 1009", frame)
+	}
+}
+
+func TestReadLoopAnswersPingAndClose(t *testing.T) {
+	conn, client := newTestConn(t)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conn.ReadLoop()
+	}()
+
+	client.Write(clientFrame(opPing, []byte("hi"), true))
+
+	pong := make([]byte, 4)
+	_, err := io.ReadFull(client, pong)
+
+	if err != nil || !bytes.Equal(pong, []byte{0x80 | opPong, 2, 'h', 'i'}) {
+		t.Fatalf("pong = %v, %v", pong, err)
+	}
+
+	client.Write(clientFrame(opClose, nil, true))
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(client, reply)
+
+	if err != nil || reply[0] != 0x80|opClose || binary.BigEndian.Uint16(reply[2:]) != CloseNormal {
+		t.Fatalf("close reply = %v, %v", reply, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("ReadLoop = %v, want nil on a clean close", err)
+	}
+
+	if conn.WriteText([]byte("late")) != ErrClosed {
+		t.Fatalf("WriteText after close should fail with ErrClosed")
+	}
+
+	if conn.Close(CloseGoingAway, "") != nil {
+		t.Fatalf("closing twice should be a no-op")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer conn.Close(CloseNormal, "")
+		conn.WriteText([]byte("welcome"))
+	}))
+	defer server.Close()
+
+	client, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+	client.Write([]byte(request))
+
+	reader := bufio.NewReader(client)
+	response, err := http.ReadResponse(reader, nil)
+
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake response = %v %v", response.Status, response.Header)
+	}
+
+	frame := make([]byte, 2+len("welcome"))
+	_, err = io.ReadFull(reader, frame)
+
+	if err != nil || string(frame[2:]) != "welcome" {
+		t.Fatalf("first message = %q, %v", frame, err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	_, err := Upgrade(recorder, request)
+
+	if err != ErrNotWebSocket {
+		t.Fatalf("Upgrade = %v, want ErrNotWebSocket", err)
+	}
+}
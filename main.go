@@ -4,8 +4,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
+	"github.com/ajpotts01/go-chirpy/internal/blobstore"
 	"github.com/ajpotts01/go-chirpy/internal/database"
+	"github.com/ajpotts01/go-chirpy/internal/entitlements"
+	"github.com/ajpotts01/go-chirpy/internal/outbound"
+	"github.com/ajpotts01/go-chirpy/internal/password"
+	"github.com/ajpotts01/go-chirpy/internal/ratelimit"
+	"github.com/ajpotts01/go-chirpy/internal/stream"
+	"github.com/ajpotts01/go-chirpy/internal/unfurl"
+	"github.com/ajpotts01/go-chirpy/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 )
@@ -18,11 +27,68 @@ func main() {
 	const appEndpoint = "/app"
 	const chirpEndpoint = "/chirps"
 	const singleChirpEndpoint = "/chirps/{id}"
+	const likeEndpoint = "/chirps/{id}/like"
+	const rechirpEndpoint = "/chirps/{id}/rechirp"
+	const threadEndpoint = "/chirps/{id}/thread"
+	const votesEndpoint = "/chirps/{id}/votes"
+	const bookmarkEndpoint = "/chirps/{id}/bookmark"
+	const likedChirpsEndpoint = "/users/{id}/likes"
+	const mentionsEndpoint = "/users/{id}/mentions"
+	const hashtagEndpoint = "/hashtags/{tag}/chirps"
+	const attachmentEndpoint = "/attachments"
+	const singleAttachmentEndpoint = "/attachments/{id}"
+	const attachmentThumbnailEndpoint = "/attachments/{id}/thumbnail"
 	const userEndpoint = "/users"
+	const singleUserEndpoint = "/users/{id}"
+	const currentUserEndpoint = "/users/me"
+	const userExportEndpoint = "/users/me/export"
+	const billingEndpoint = "/users/me/billing"
+	const draftsEndpoint = "/users/me/drafts"
+	const bookmarksEndpoint = "/users/me/bookmarks"
+	const userListsEndpoint = "/users/{id}/lists"
+	const listsEndpoint = "/lists"
+	const singleListEndpoint = "/lists/{id}"
+	const listMembersEndpoint = "/lists/{id}/members"
+	const singleListMemberEndpoint = "/lists/{id}/members/{userId}"
+	const listTimelineEndpoint = "/lists/{id}/chirps"
+	const singleDraftEndpoint = "/users/me/drafts/{id}"
+	const followEndpoint = "/users/{id}/follow"
+	const followersEndpoint = "/users/{id}/followers"
+	const followingEndpoint = "/users/{id}/following"
+	const blockEndpoint = "/users/{id}/block"
+	const muteEndpoint = "/users/{id}/mute"
+	const blocksEndpoint = "/users/me/blocks"
+	const mutesEndpoint = "/users/me/mutes"
+	const timelineEndpoint = "/timeline"
+	const streamEndpoint = "/stream"
+	const streamWebSocketEndpoint = "/stream/ws"
+	const searchChirpsEndpoint = "/search/chirps"
+	const searchUsersEndpoint = "/search/users"
+	const notificationsEndpoint = "/notifications"
+	const notificationsReadEndpoint = "/notifications/read"
+	const singleNotificationReadEndpoint = "/notifications/{id}/read"
+	const notificationPreferencesEndpoint = "/notifications/preferences"
 	const loginEndpoint = "/login"
+	const twoFactorLoginEndpoint = "/login/2fa"
+	const twoFactorEndpoint = "/users/me/2fa"
+	const twoFactorConfirmEndpoint = "/users/me/2fa/confirm"
+	const apiKeysEndpoint = "/users/me/keys"
+	const singleApiKeyEndpoint = "/users/me/keys/{id}"
 	const refreshEndpoint = "/refresh"
 	const revokeEndpoint = "/revoke"
 	const polkaHook = "/polka/webhooks"
+	const webhookEndpoint = "/webhooks/{provider}"
+	const userWebhooksEndpoint = "/users/me/webhooks"
+	const userSingleWebhookEndpoint = "/users/me/webhooks/{id}"
+	const userWebhookDeliveriesEndpoint = "/users/me/webhooks/{id}/deliveries"
+	const userWebhookRedeliverEndpoint = "/users/me/webhooks/{id}/deliveries/{deliveryId}/redeliver"
+	const adminWebhooksEndpoint = "/webhooks/endpoints"
+	const adminSingleWebhookEndpoint = "/webhooks/endpoints/{id}"
+	const adminWebhookDeliveriesEndpoint = "/webhooks/endpoints/{id}/deliveries"
+	const adminWebhookRedeliverEndpoint = "/webhooks/endpoints/{id}/deliveries/{deliveryId}/redeliver"
+	const webhookEventsEndpoint = "/webhooks/events"
+	const singleWebhookEventEndpoint = "/webhooks/events/{id}"
+	const replayWebhookEventEndpoint = "/webhooks/events/{id}/replay"
 
 	godotenv.Load()
 
@@ -32,12 +98,99 @@ func main() {
 		log.Fatal(err)
 	}
 
+	bcryptCost := 0
+
+	if os.Getenv("BCRYPT_COST") != "" {
+		bcryptCost, err = strconv.Atoi(os.Getenv("BCRYPT_COST"))
+		if err != nil {
+			log.Fatalf("Invalid BCRYPT_COST: %v", err)
+		}
+	}
+
+	hasher, err := password.NewHasher(os.Getenv("PASSWORD_HASHER"), bcryptCost)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dbConn.SetPasswordHasher(hasher)
+
+	deletionPolicy := database.DeletionPolicy(os.Getenv("ACCOUNT_DELETION_POLICY"))
+
+	switch deletionPolicy {
+	case "":
+		deletionPolicy = database.DeletionPolicyDelete
+	case database.DeletionPolicyDelete, database.DeletionPolicyAnonymize:
+	default:
+		log.Fatalf("Unknown ACCOUNT_DELETION_POLICY: %v", deletionPolicy)
+	}
+
+	plans := entitlements.Default()
+
+	if os.Getenv("PLANS_CONFIG") != "" {
+		plans, err = entitlements.Load(os.Getenv("PLANS_CONFIG"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	webhookProviders := webhooks.NewRegistry()
+	webhookProviders.Register(webhooks.Polka{
+		ApiKey:        os.Getenv("POLKA_KEY"),
+		SigningSecret: os.Getenv("POLKA_SIGNING_SECRET"),
+		Nonces:        dbConn,
+	})
+
+	hub := stream.NewHub(stream.DefaultBuffer)
+	dbConn.AddChirpListener(chirpPublisher{hub: hub})
+
+	searchIndex, err := buildSearchIndex(dbConn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbConn.AddChirpListener(chirpIndexer{index: searchIndex})
+
+	userIndex, err := buildUserIndex(dbConn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbConn.AddUserListener(userIndexer{index: userIndex})
+
+	blobStore, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbConn.AddAttachmentListener(blobCleaner{store: blobStore})
+
+	// Only for local development, where linked pages may be on localhost
+	unfurlAllowPrivate := os.Getenv("UNFURL_ALLOW_PRIVATE") == "true"
+
+	if unfurlAllowPrivate {
+		log.Printf("Warning: link previews may fetch from private addresses")
+	}
+
+	unfurler := unfurl.New(unfurl.Options{AllowPrivate: unfurlAllowPrivate})
+	dbConn.AddChirpListener(linkUnfurler{unfurler: unfurler})
+
 	config := apiConfig{
-		serverHits: 0,
-		jwtSecret:  os.Getenv("JWT_SECRET"),
-		DbConn:     dbConn,
+		serverHits:            0,
+		jwtSecret:             os.Getenv("JWT_SECRET"),
+		accountDeletionPolicy: deletionPolicy,
+		plans:                 plans,
+		limiter:               ratelimit.NewLimiter(),
+		twoFactorLimiter:      ratelimit.NewLimiter(),
+		webhookProviders:      webhookProviders,
+		hub:                   hub,
+		searchIndex:           searchIndex,
+		userIndex:             userIndex,
+		blobStore:             blobStore,
+		unfurler:              unfurler,
+		DbConn:                dbConn,
 	}
 
+	dbConn.SetChirpEventBuilder(config.chirpCreatedEvent)
+	dbConn.SetChirpDeletedEventBuilder(chirpDeletedEvent)
+
 	appRouter := chi.NewRouter()
 	fsHandler := config.metrics(http.StripPrefix(appEndpoint, http.FileServer(http.Dir(dirRoot))))
 
@@ -48,23 +201,120 @@ func main() {
 	apiRouter.Get(chirpEndpoint, config.readChirp)
 	apiRouter.Get(singleChirpEndpoint, config.readChirp)
 	apiRouter.Post(chirpEndpoint, config.createChirp)
+	apiRouter.Put(singleChirpEndpoint, config.updateChirp)
 	apiRouter.Delete(singleChirpEndpoint, config.deleteChirp)
+	apiRouter.Get(threadEndpoint, config.readThread)
+	apiRouter.Post(likeEndpoint, config.likeChirp)
+	apiRouter.Delete(likeEndpoint, config.unlikeChirp)
+	apiRouter.Post(rechirpEndpoint, config.rechirpChirp)
+	apiRouter.Delete(rechirpEndpoint, config.unrechirpChirp)
+	apiRouter.Post(votesEndpoint, config.voteInPoll)
+	apiRouter.Post(bookmarkEndpoint, config.bookmarkChirp)
+	apiRouter.Delete(bookmarkEndpoint, config.unbookmarkChirp)
+	apiRouter.Get(bookmarksEndpoint, config.readBookmarks)
+	apiRouter.Get(likedChirpsEndpoint, config.readLikedChirps)
+	apiRouter.Get(mentionsEndpoint, config.readMentions)
+	apiRouter.Get(hashtagEndpoint, config.readHashtagChirps)
+
+	// Drafts and scheduled chirps
+	apiRouter.Get(draftsEndpoint, config.readUnpublishedChirps)
+	apiRouter.Put(singleDraftEndpoint, config.updateUnpublishedChirp)
+	apiRouter.Delete(singleDraftEndpoint, config.deleteUnpublishedChirp)
+
+	// Attachments
+	apiRouter.Post(attachmentEndpoint, config.uploadAttachment)
+	apiRouter.Get(singleAttachmentEndpoint, config.readAttachment)
+	apiRouter.Get(attachmentThumbnailEndpoint, config.readAttachmentThumbnail)
 
 	// Users
 	apiRouter.Post(userEndpoint, config.createUser)
-	apiRouter.Get(userEndpoint, config.readUser)
 	apiRouter.Put(userEndpoint, config.updateUser)
+	apiRouter.Get(singleUserEndpoint, config.readUser)
+	apiRouter.Get(currentUserEndpoint, config.readCurrentUser)
+	apiRouter.Put(currentUserEndpoint, config.updateProfile)
+	apiRouter.Delete(currentUserEndpoint, config.deleteUser)
+	apiRouter.Get(userExportEndpoint, config.exportUser)
+	apiRouter.Get(billingEndpoint, config.readBillingHistory)
+	apiRouter.Post(twoFactorEndpoint, config.enrollTwoFactor)
+	apiRouter.Post(twoFactorConfirmEndpoint, config.confirmTwoFactor)
+	apiRouter.Delete(twoFactorEndpoint, config.disableTwoFactor)
+
+	// Follows
+	apiRouter.Post(followEndpoint, config.followUser)
+	apiRouter.Delete(followEndpoint, config.unfollowUser)
+	apiRouter.Get(followersEndpoint, config.readFollowers)
+	apiRouter.Get(followingEndpoint, config.readFollowing)
+	apiRouter.Get(timelineEndpoint, config.readTimeline)
+
+	// Blocks and mutes
+	apiRouter.Post(blockEndpoint, config.blockUser)
+	apiRouter.Delete(blockEndpoint, config.unblockUser)
+	apiRouter.Post(muteEndpoint, config.muteUser)
+	apiRouter.Delete(muteEndpoint, config.unmuteUser)
+	apiRouter.Get(blocksEndpoint, config.readBlocked)
+	apiRouter.Get(mutesEndpoint, config.readMuted)
+
+	// Lists
+	apiRouter.Post(listsEndpoint, config.createList)
+	apiRouter.Get(userListsEndpoint, config.readUserLists)
+	apiRouter.Get(singleListEndpoint, config.readList)
+	apiRouter.Put(singleListEndpoint, config.updateList)
+	apiRouter.Delete(singleListEndpoint, config.deleteList)
+	apiRouter.Get(listMembersEndpoint, config.readListMembers)
+	apiRouter.Put(singleListMemberEndpoint, config.addListMember)
+	apiRouter.Delete(singleListMemberEndpoint, config.removeListMember)
+	apiRouter.Get(listTimelineEndpoint, config.readListTimeline)
+
+	// Search
+	apiRouter.Get(searchChirpsEndpoint, config.searchChirps)
+	apiRouter.Get(searchUsersEndpoint, config.searchUsers)
+
+	// Streaming
+	apiRouter.Get(streamEndpoint, config.streamChirps)
+	apiRouter.Get(streamWebSocketEndpoint, config.streamChirpsWebSocket)
+
+	// Notifications
+	apiRouter.Get(notificationsEndpoint, config.readNotifications)
+	apiRouter.Post(notificationsReadEndpoint, config.markAllNotificationsRead)
+	apiRouter.Post(singleNotificationReadEndpoint, config.markNotificationRead)
+	apiRouter.Get(notificationPreferencesEndpoint, config.readNotificationPreferences)
+	apiRouter.Put(notificationPreferencesEndpoint, config.updateNotificationPreferences)
+
+	// API keys
+	apiRouter.Post(apiKeysEndpoint, config.createApiKey)
+	apiRouter.Get(apiKeysEndpoint, config.readApiKeys)
+	apiRouter.Delete(singleApiKeyEndpoint, config.revokeApiKey)
 
 	// Auth
 	apiRouter.Post(loginEndpoint, config.authUser)
+	apiRouter.Post(twoFactorLoginEndpoint, config.authUserTwoFactor)
 	apiRouter.Post(refreshEndpoint, config.refreshToken)
 	apiRouter.Post(revokeEndpoint, config.revokeToken)
 
 	// Webhooks
 	apiRouter.Post(polkaHook, config.upgradeUser)
+	apiRouter.Post(webhookEndpoint, config.receiveWebhook)
+
+	// Outbound webhooks
+	apiRouter.Post(userWebhooksEndpoint, config.createWebhookEndpoint(config.userWebhookOwner))
+	apiRouter.Get(userWebhooksEndpoint, config.readWebhookEndpoints(config.userWebhookOwner))
+	apiRouter.Delete(userSingleWebhookEndpoint, config.deleteWebhookEndpoint(config.userWebhookOwner))
+	apiRouter.Get(userWebhookDeliveriesEndpoint, config.readWebhookDeliveries(config.userWebhookOwner))
+	apiRouter.Post(userWebhookRedeliverEndpoint, config.redeliverWebhook(config.userWebhookOwner))
 
 	adminRouter := chi.NewRouter()
 	adminRouter.Get(metricsEndpoint, config.hits)
+	adminRouter.Group(func(protected chi.Router) {
+		protected.Use(adminOnly)
+		protected.Get(webhookEventsEndpoint, config.readWebhookEvents)
+		protected.Get(singleWebhookEventEndpoint, config.readWebhookEvent)
+		protected.Post(replayWebhookEventEndpoint, config.replayWebhookEvent)
+		protected.Post(adminWebhooksEndpoint, config.createWebhookEndpoint(adminWebhookOwner))
+		protected.Get(adminWebhooksEndpoint, config.readWebhookEndpoints(adminWebhookOwner))
+		protected.Delete(adminSingleWebhookEndpoint, config.deleteWebhookEndpoint(adminWebhookOwner))
+		protected.Get(adminWebhookDeliveriesEndpoint, config.readWebhookDeliveries(adminWebhookOwner))
+		protected.Post(adminWebhookRedeliverEndpoint, config.redeliverWebhook(adminWebhookOwner))
+	})
 
 	// Done a bit differently to the boot.dev example
 	// They just use router in the same way as mux
@@ -82,6 +332,12 @@ func main() {
 		Handler: appRouter,
 	}
 
+	go config.expireSubscriptions(subscriptionExpiryInterval)
+	go outbound.NewDispatcher(dbConn, webhookDispatchInterval).Run()
+	go config.publishScheduledChirps(scheduledPublishInterval)
+	go config.expireUploads(uploadExpiryInterval)
+	unfurler.Run()
+
 	log.Printf("Now serving on port: %v", port)
 	log.Fatal(server.ListenAndServe())
 }